@@ -1,8 +1,16 @@
 module github.com/hakluke/hakstore/cmd/hakstore-client
 
-go 1.16
+go 1.18
 
 require (
 	github.com/hakluke/hakstore/pkg/hakstoreclient v0.0.0-20210626233245-16838d202a07
 	gopkg.in/yaml.v2 v2.4.0
 )
+
+require (
+	github.com/jinzhu/inflection v1.0.0 // indirect
+	github.com/jinzhu/now v1.1.2 // indirect
+	gorm.io/gorm v1.21.11 // indirect
+)
+
+replace github.com/hakluke/hakstore/pkg/hakstoreclient => ../../pkg/hakstoreclient
@@ -87,11 +87,23 @@ func main() {
 		hakstoreclient.IPsCLI(c)
 	case "vulns":
 		hakstoreclient.VulnsCLI(c)
+	case "reports":
+		hakstoreclient.ReportsCLI(c)
+	case "urls":
+		hakstoreclient.UrlsCLI(c)
+	case "certs":
+		hakstoreclient.CertsCLI(c)
+	case "cloud":
+		hakstoreclient.CloudCLI(c)
+	case "graph":
+		hakstoreclient.GraphCLI(c)
+	case "import":
+		hakstoreclient.ImportCLI(c)
 	case "jobs":
 		hakstoreclient.JobsCLI(c)
 	// no valid subcommand found - default to showing a message and exiting
 	default:
-		fmt.Println("Subcommand missing or incorrect. Hint: hakstore-client {platforms|programs|rootdomains|subdomains|ips|vulns|jobs}")
+		fmt.Println("Subcommand missing or incorrect. Hint: hakstore-client {platforms|programs|rootdomains|subdomains|ips|vulns|reports|urls|certs|cloud|graph|import|jobs}")
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// burpMessage is a request or response in a Burp export, which is base64 encoded unless the export was made without
+// that option
+type burpMessage struct {
+	Base64 bool   `xml:"base64,attr"`
+	Method string `xml:"method,attr"`
+	Data   string `xml:",chardata"`
+}
+
+// text decodes a request or response. Bytes Postgres can't store in a text column are dropped, so binary responses
+// don't get the whole item rejected.
+func (m burpMessage) text() string {
+	data := m.Data
+	if m.Base64 {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+		if err != nil {
+			return ""
+		}
+		data = string(decoded)
+	}
+	return strings.ToValidUTF8(strings.ReplaceAll(data, "\x00", ""), "")
+}
+
+// burpHost is the host of a Burp issue or item along with the IP Burp connected to
+type burpHost struct {
+	IP   string `xml:"ip,attr"`
+	Name string `xml:",chardata"`
+}
+
+// burpIssue is an issue in Burp's issues XML export. The host is a URL without a path, e.g. https://tesla.com, and
+// the descriptive fields hold HTML.
+type burpIssue struct {
+	SerialNumber                 string   `xml:"serialNumber"`
+	Type                         string   `xml:"type"`
+	Name                         string   `xml:"name"`
+	Host                         burpHost `xml:"host"`
+	Path                         string   `xml:"path"`
+	Location                     string   `xml:"location"`
+	Severity                     string   `xml:"severity"`
+	Confidence                   string   `xml:"confidence"`
+	IssueBackground              string   `xml:"issueBackground"`
+	RemediationBackground        string   `xml:"remediationBackground"`
+	References                   string   `xml:"references"`
+	VulnerabilityClassifications string   `xml:"vulnerabilityClassifications"`
+	IssueDetail                  string   `xml:"issueDetail"`
+	IssueDetailItems             []string `xml:"issueDetailItems>issueDetailItem"`
+	RemediationDetail            string   `xml:"remediationDetail"`
+	RequestResponses             []struct {
+		Request  burpMessage `xml:"request"`
+		Response burpMessage `xml:"response"`
+	} `xml:"requestresponse"`
+}
+
+// burpItem is a request in Burp's sitemap or proxy history XML export
+type burpItem struct {
+	URL     string      `xml:"url"`
+	Host    burpHost    `xml:"host"`
+	Method  string      `xml:"method"`
+	Request burpMessage `xml:"request"`
+}
+
+var (
+	burpTags        = regexp.MustCompile(`<[^>]*>`)
+	burpBreaks      = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</ul>|</h\d>`)
+	burpBlankLines  = regexp.MustCompile(`\n\s*\n\s*\n+`)
+	burpLinks       = regexp.MustCompile(`href\s*=\s*["']([^"']+)["']`)
+	burpCWE         = regexp.MustCompile(`CWE-\d+`)
+	burpParameter   = regexp.MustCompile(`\[(\S+) (?:\w+ )?(?:parameter|cookie)\]`)
+	burpListItems   = regexp.MustCompile(`(?i)<li>`)
+	burpContentType = regexp.MustCompile(`(?im)^content-type:\s*application/x-www-form-urlencoded`)
+)
+
+// burpText turns the HTML Burp writes its descriptions in into plain text
+func burpText(value string) string {
+	value = burpBreaks.ReplaceAllString(value, "\n")
+	value = burpListItems.ReplaceAllString(value, "\n- ")
+	value = html.UnescapeString(burpTags.ReplaceAllString(value, ""))
+	return strings.TrimSpace(burpBlankLines.ReplaceAllString(value, "\n\n"))
+}
+
+// burpSeverity maps a Burp severity and confidence to a hakstore severity. Burp has no critical, and tentative
+// findings are dropped a level since Burp isn't sure they are real. False positives return false.
+func burpSeverity(severity string, confidence string) (int, bool) {
+	var level int
+	switch strings.ToLower(strings.TrimSpace(severity)) {
+	case "false positive":
+		return 0, false
+	case "high":
+		level = 2
+	case "medium":
+		level = 3
+	case "low":
+		level = 4
+	default:
+		level = 5
+	}
+	if strings.EqualFold(strings.TrimSpace(confidence), "tentative") && level < 5 {
+		level++
+	}
+	return level, true
+}
+
+// burpVuln turns a Burp issue into a vuln. The check ID is Burp's issue type, and it matched at the issue's location,
+// which is its path and the parameter or header it was found in.
+func burpVuln(issue burpIssue) Vuln {
+	host := strings.TrimSuffix(strings.TrimSpace(issue.Host.Name), "/")
+	path := strings.TrimSpace(issue.Path)
+	location := strings.TrimSpace(issue.Location)
+	checkID := strings.TrimSpace(issue.Type)
+	if checkID == "" {
+		checkID = strings.Trim(nonAlphanumeric.ReplaceAllString(strings.ToLower(issue.Name), "-"), "-")
+	}
+	matchedAt := host + path
+	if location != "" {
+		matchedAt = host + location
+	}
+
+	var sections []string
+	if detail := burpText(issue.IssueDetail); detail != "" {
+		sections = append(sections, detail)
+	}
+	if len(issue.IssueDetailItems) > 0 {
+		var items []string
+		for _, item := range issue.IssueDetailItems {
+			items = append(items, "- "+burpText(item))
+		}
+		sections = append(sections, strings.Join(items, "\n"))
+	}
+	if background := burpText(issue.IssueBackground); background != "" {
+		sections = append(sections, background)
+	}
+	remediation := burpText(issue.RemediationDetail)
+	if remediation == "" {
+		remediation = burpText(issue.RemediationBackground)
+	}
+	if remediation != "" {
+		sections = append(sections, "Remediation: "+remediation)
+	}
+	sections = append(sections, fmt.Sprintf("Burp severity: %s, confidence: %s", issue.Severity, issue.Confidence))
+
+	severity, _ := burpSeverity(issue.Severity, issue.Confidence)
+	vuln := Vuln{
+		Title:       strings.TrimSpace(issue.Name),
+		Description: strings.Join(sections, "\n\n"),
+		Severity:    severity,
+		CheckID:     "burp:" + checkID,
+		MatchedAt:   matchedAt,
+		URL:         host + path,
+		CWE:         burpCWE.FindString(issue.VulnerabilityClassifications),
+	}
+	for _, link := range burpLinks.FindAllStringSubmatch(issue.References, -1) {
+		vuln.References = append(vuln.References, html.UnescapeString(link[1]))
+	}
+	if match := burpParameter.FindStringSubmatch(location); match != nil {
+		vuln.Parameter = match[1]
+	}
+	if len(issue.RequestResponses) > 0 {
+		vuln.Request = issue.RequestResponses[0].Request.text()
+		vuln.Response = issue.RequestResponses[0].Response.text()
+	}
+	if vuln.Title == "" {
+		vuln.Title = vuln.CheckID
+	}
+	return vuln
+}
+
+// burpFormParameters is the names of the parameters in a request's form encoded body, Burp's URLs only have the ones
+// in the query
+func burpFormParameters(request string) []string {
+	separator := strings.Index(request, "\r\n\r\n")
+	if separator == -1 || !burpContentType.MatchString(request[:separator]) {
+		return nil
+	}
+	values, err := url.ParseQuery(strings.TrimSpace(request[separator+4:]))
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for name := range values {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Imports Burp Suite XML exports, either the issues export or the sitemap (or proxy history) export. Issues become
+// vulns linked to the subdomain or IP they were found on, with the first request and response Burp recorded, while
+// false positives are skipped. Sitemap requests become endpoints. With ?program= only hosts in that program's scope
+// are imported, and ?notify=false turns off the Slack notifications for new vulns.
+func importBurp(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	program, err := importProgram(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	notify := r.URL.Query().Get("notify") != "false"
+
+	summary := newImportSummary()
+	subdomains := make(map[string]*Subdomain)
+	skippedHosts := make(map[string]string)
+	export := ""
+	decoder := xml.NewDecoder(importBody(r))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			summary.Rejected = append(summary.Rejected, Reject{Item: "input", Reason: "Could not read the export: " + err.Error()})
+			break
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "issues", "items":
+			export = start.Name.Local
+		case "issue":
+			var issue burpIssue
+			err = decoder.DecodeElement(&issue, &start)
+			if err != nil {
+				summary.Rejected = append(summary.Rejected, Reject{Item: "issue", Reason: err.Error()})
+				continue
+			}
+			importBurpIssue(&summary, issue, program, notify)
+		case "item":
+			var item burpItem
+			err = decoder.DecodeElement(&item, &start)
+			if err != nil {
+				summary.Rejected = append(summary.Rejected, Reject{Item: "item", Reason: err.Error()})
+				continue
+			}
+			importBurpItem(&summary, item, program, subdomains, skippedHosts)
+		}
+	}
+	summary.syncIPs()
+	if export == "" && len(summary.Rejected) == 0 {
+		writeError(w, http.StatusBadRequest, "Not a Burp issues or items export.")
+		return
+	}
+	json.NewEncoder(w).Encode(summary)
+}
+
+// importBurpIssue stores an issue from a Burp issues export as a vuln
+func importBurpIssue(summary *ImportSummary, issue burpIssue, program string, notify bool) {
+	vuln := burpVuln(issue)
+	item := vuln.Title + " " + vuln.MatchedAt
+	if _, ok := burpSeverity(issue.Severity, issue.Confidence); !ok {
+		summary.skip("vulns", item, "marked as a false positive in Burp")
+		return
+	}
+	host := importHostname(issue.Host.Name)
+	if host == "" {
+		summary.Rejected = append(summary.Rejected, Reject{Item: item, Reason: "issue has no host"})
+		return
+	}
+	if !importVulnHost(summary, &vuln, host, issue.Host.IP, "burp", program, item) {
+		return
+	}
+	created, err := storeVuln(&vuln, notify)
+	if err != nil {
+		summary.Rejected = append(summary.Rejected, Reject{Item: item, Reason: err.Error()})
+		return
+	}
+	if created {
+		summary.record("vulns", ImportCreated)
+	} else {
+		summary.record("vulns", ImportUpdated)
+	}
+}
+
+// importBurpItem stores a request from a Burp sitemap export as an endpoint. Sitemaps repeat hosts a lot, so the
+// subdomains already imported or skipped are passed in to be reused.
+func importBurpItem(summary *ImportSummary, item burpItem, program string, subdomains map[string]*Subdomain, skippedHosts map[string]string) {
+	request := item.Request.text()
+	method := item.Method
+	if method == "" {
+		method = item.Request.Method
+	}
+	endpoint := Endpoint{URL: item.URL, Method: method, Sources: []string{"burp"}, Parameters: burpFormParameters(request)}
+	err := normaliseEndpoint(&endpoint)
+	if err != nil {
+		summary.Rejected = append(summary.Rejected, Reject{Item: item.URL, Reason: err.Error()})
+		return
+	}
+	if reason, ok := skippedHosts[endpoint.Host]; ok {
+		summary.skip("endpoints", endpoint.URL, endpoint.Host+" skipped: "+reason)
+		return
+	}
+
+	if addr, err := parseIP(endpoint.Host); err == nil {
+		if program == "" {
+			endpoint.ProgramID = ipProgram(addr.String())
+		} else {
+			var count int64
+			db.Table("program_ips").Where("ip_id = ? AND program_id = ?", addr.String(), program).Count(&count)
+			if count == 0 {
+				skippedHosts[endpoint.Host] = "IP isn't in program " + program
+				summary.skip("endpoints", endpoint.URL, endpoint.Host+" skipped: "+skippedHosts[endpoint.Host])
+				return
+			}
+			endpoint.ProgramID = program
+		}
+	} else {
+		subdomain, ok := subdomains[endpoint.Host]
+		if !ok {
+			imported, outcome, reason, err := importSubdomain(endpoint.Host, []string{"burp"}, program)
+			if err != nil {
+				skippedHosts[endpoint.Host] = err.Error()
+				summary.Rejected = append(summary.Rejected, Reject{Item: endpoint.URL, Reason: err.Error()})
+				return
+			}
+			if outcome == ImportSkipped {
+				skippedHosts[endpoint.Host] = reason
+				summary.skip("endpoints", endpoint.URL, endpoint.Host+" skipped: "+reason)
+				return
+			}
+			summary.record("subdomains", outcome)
+			if item.Host.IP != "" {
+				if _, outcome, err := importIP(summary, item.Host.IP, 0, "", imported); err == nil {
+					summary.record("ips", outcome)
+				}
+			}
+			subdomain = &imported
+			subdomains[endpoint.Host] = subdomain
+		}
+		endpoint.SubdomainID = subdomain.ID
+		endpoint.ProgramID = subdomain.ProgramID
+	}
+
+	created, err := saveEndpoint(&endpoint)
+	if err != nil {
+		summary.Rejected = append(summary.Rejected, Reject{Item: endpoint.URL, Reason: err.Error()})
+		return
+	}
+	if created {
+		summary.record("endpoints", ImportCreated)
+	} else {
+		summary.record("endpoints", ImportUpdated)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/xml"
+	"reflect"
+	"testing"
+)
+
+func TestBurpSeverity(t *testing.T) {
+	tests := []struct {
+		severity   string
+		confidence string
+		want       int
+		wantOK     bool
+	}{
+		{severity: "High", confidence: "Certain", want: 2, wantOK: true},
+		{severity: "Medium", confidence: "Firm", want: 3, wantOK: true},
+		{severity: "low", confidence: "Tentative", want: 5, wantOK: true},
+		{severity: "Information", confidence: "Tentative", want: 5, wantOK: true},
+		{severity: "High", confidence: "tentative", want: 3, wantOK: true},
+		{severity: "False positive", confidence: "Certain"},
+	}
+	for _, test := range tests {
+		t.Run(test.severity+" "+test.confidence, func(t *testing.T) {
+			got, ok := burpSeverity(test.severity, test.confidence)
+			if ok != test.wantOK || (ok && got != test.want) {
+				t.Errorf("burpSeverity(%q, %q) = %d, %v, want %d, %v", test.severity, test.confidence, got, ok, test.want, test.wantOK)
+			}
+		})
+	}
+}
+
+func TestBurpVuln(t *testing.T) {
+	tests := []struct {
+		name  string
+		issue string
+		want  Vuln
+	}{
+		{
+			name: "issue with a parameter",
+			issue: `<issue>
+  <type>2097920</type>
+  <name>Cross-site scripting (reflected)</name>
+  <host ip="192.0.2.1">https://www.tesla.com/</host>
+  <path><![CDATA[/search]]></path>
+  <location><![CDATA[/search [q URL parameter]]]></location>
+  <severity>High</severity>
+  <confidence>Firm</confidence>
+  <issueBackground><![CDATA[<p>Reflected XSS &amp; friends.</p>]]></issueBackground>
+  <remediationBackground><![CDATA[Encode output.]]></remediationBackground>
+  <references><![CDATA[<ul><li><a href="https://portswigger.net/web-security/cross-site-scripting?a=1&amp;b=2">XSS</a></li></ul>]]></references>
+  <vulnerabilityClassifications><![CDATA[<ul><li><a href="https://cwe.mitre.org/data/definitions/79.html">CWE-79: XSS</a></li></ul>]]></vulnerabilityClassifications>
+  <issueDetail><![CDATA[The value of the <b>q</b> parameter is copied into the page.]]></issueDetail>
+  <requestresponse>
+    <request base64="true"><![CDATA[R0VUIC9zZWFyY2g/cT14IEhUVFAvMS4xDQoNCg==]]></request>
+    <response base64="false"><![CDATA[HTTP/1.1 200 OK]]></response>
+  </requestresponse>
+</issue>`,
+			want: Vuln{
+				Title:       "Cross-site scripting (reflected)",
+				Description: "The value of the q parameter is copied into the page.\n\nReflected XSS & friends.\n\nRemediation: Encode output.\n\nBurp severity: High, confidence: Firm",
+				Severity:    2,
+				CheckID:     "burp:2097920",
+				MatchedAt:   "https://www.tesla.com/search [q URL parameter]",
+				URL:         "https://www.tesla.com/search",
+				CWE:         "CWE-79",
+				References:  StringList{"https://portswigger.net/web-security/cross-site-scripting?a=1&b=2"},
+				Parameter:   "q",
+				Request:     "GET /search?q=x HTTP/1.1\r\n\r\n",
+				Response:    "HTTP/1.1 200 OK",
+			},
+		},
+		{
+			name: "issue without a type",
+			issue: `<issue>
+  <name>Strict transport security not enforced</name>
+  <host>https://tesla.com</host>
+  <path>/</path>
+  <severity>Information</severity>
+  <confidence>Certain</confidence>
+</issue>`,
+			want: Vuln{
+				Title:       "Strict transport security not enforced",
+				Description: "Burp severity: Information, confidence: Certain",
+				Severity:    5,
+				CheckID:     "burp:strict-transport-security-not-enforced",
+				MatchedAt:   "https://tesla.com/",
+				URL:         "https://tesla.com/",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var issue burpIssue
+			err := xml.Unmarshal([]byte(test.issue), &issue)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := burpVuln(issue); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("burpVuln() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
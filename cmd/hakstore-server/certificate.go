@@ -0,0 +1,293 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Certificate is a structure to store a TLS certificate, keyed on its SHA256 fingerprint. Certificates imported from
+// a CT log without a fingerprint, e.g. from crt.sh, are keyed on their source and log ID instead, like crtsh-1234.
+type Certificate struct {
+	gorm.Model
+	ID        string               `json:"id" gorm:"PrimaryKey"`
+	Subject   string               `json:"subject"`
+	Issuer    string               `json:"issuer" gorm:"index:idx_certificates_issuer_serial"`
+	Serial    string               `json:"serial" gorm:"index:idx_certificates_issuer_serial"`
+	NotBefore time.Time            `json:"notbefore"`
+	NotAfter  time.Time            `json:"notafter" gorm:"index"`
+	SANs      StringList           `json:"sans"`
+	LogID     string               `json:"logid,omitempty"`
+	Source    string               `json:"source,omitempty" gorm:"index"`
+	Bindings  []CertificateBinding `json:"bindings"`
+}
+
+// CertificateBinding records which certificate a host serves on a port. Each host and port has one binding, which
+// moves to the new certificate when the host starts serving a different one. Port 0 binds a subdomain to the latest
+// certificate logged for it in a CT log.
+type CertificateBinding struct {
+	gorm.Model
+	CertificateID string    `json:"certificate" gorm:"index"`
+	Host          string    `json:"host" gorm:"uniqueIndex:idx_certificate_bindings_host_port"`
+	Port          int       `json:"port" gorm:"uniqueIndex:idx_certificate_bindings_host_port"`
+	SubdomainID   string    `json:"subdomain" gorm:"index"`
+	IPID          string    `json:"ip" gorm:"index"`
+	ProgramID     string    `json:"program" gorm:"index"`
+	LastSeen      time.Time `json:"lastseen"`
+}
+
+// certificateSubmission is a certificate seen on a host and port. The certificate can either be given as PEM, or
+// as already parsed fields.
+type certificateSubmission struct {
+	Certificate
+	PEM  string `json:"pem"`
+	Host string `json:"host"`
+	Port int    `json:"port"`
+}
+
+// Get all certificates. These can be filtered with ?program=, ?host=, ?source=, e.g. crtsh, and ?expiring=days, which
+// returns the certificates that expire within that many days, soonest first
+func getCertificates(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	query := db
+	if program := r.URL.Query().Get("program"); program != "" {
+		query = query.Where("id IN (?)", db.Model(&CertificateBinding{}).Select("certificate_id").Where("program_id = ?", program))
+	}
+	if host := r.URL.Query().Get("host"); host != "" {
+		if addr, err := parseIP(host); err == nil {
+			host = addr.String()
+		} else {
+			host = lookupHostname(host)
+		}
+		query = query.Where("id IN (?)", db.Model(&CertificateBinding{}).Select("certificate_id").Where("host = ?", host))
+	}
+	if source := r.URL.Query().Get("source"); source != "" {
+		query = query.Where("source = ?", source)
+	}
+	if expiring := r.URL.Query().Get("expiring"); expiring != "" {
+		days, err := strconv.Atoi(expiring)
+		if err != nil || days < 0 {
+			writeError(w, http.StatusBadRequest, "expiring must be a number of days")
+			return
+		}
+		query = query.Where("not_after < ?", time.Now().AddDate(0, 0, days)).Order("not_after")
+	}
+	var certificates []Certificate
+	query.Preload("Bindings").Find(&certificates)
+	json.NewEncoder(w).Encode(certificates)
+}
+
+// Get a specific certificate
+func getCertificate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var certificate Certificate
+	vars := mux.Vars(r)
+	db.Where("ID = ?", normaliseFingerprint(vars["id"])).Preload("Bindings").Find(&certificate)
+	json.NewEncoder(w).Encode(&certificate)
+}
+
+// Creates new certificates and binds them to the host and port they were seen on, accepts batches. Certificates that
+// can't be parsed or were seen on hosts that aren't in scope are rejected individually.
+func createCertificates(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var submissions []certificateSubmission
+	_ = json.NewDecoder(r.Body).Decode(&submissions)
+
+	stored := []Certificate{}
+	rejected := []Reject{}
+	for i, submission := range submissions {
+		item := submission.Host + ":" + strconv.Itoa(submission.Port)
+		certificate, err := storeCertificate(submission)
+		if err != nil {
+			rejected = append(rejected, rejectAt(i, item, err.Error()))
+			continue
+		}
+		stored = append(stored, certificate)
+	}
+	writeBatch(w, r, stored, rejected)
+}
+
+// storeCertificate stores a submitted certificate and binds it to the host and port it was seen on
+func storeCertificate(submission certificateSubmission) (Certificate, error) {
+	certificate := submission.Certificate
+	if submission.PEM != "" {
+		parsed, err := parseCertificatePEM(submission.PEM)
+		if err != nil {
+			return certificate, err
+		}
+		certificate = parsed
+	}
+	certificate.ID = normaliseFingerprint(certificate.ID)
+	if len(certificate.ID) != sha256.Size*2 {
+		return certificate, fmt.Errorf("certificate needs a pem or a sha256 fingerprint")
+	}
+	if submission.Port < 1 || submission.Port > 65535 {
+		return certificate, fmt.Errorf("port must be between 1 and 65535")
+	}
+	var sans []string
+	for _, san := range certificate.SANs {
+		sans = append(sans, strings.TrimSuffix(strings.ToLower(strings.TrimSpace(san)), "."))
+	}
+	certificate.SANs = mergeStrings(nil, sans)
+
+	binding := CertificateBinding{CertificateID: certificate.ID, Port: submission.Port, LastSeen: time.Now()}
+	if addr, err := parseIP(submission.Host); err == nil {
+		var ip IP
+		err = db.Where("id = ?", addr.String()).First(&ip).Error
+		if err != nil {
+			return certificate, fmt.Errorf("IP %s is not stored", addr.String())
+		}
+		var programs int64
+		db.Table("program_ips").Where("ip_id = ?", ip.ID).Count(&programs)
+		if programs == 0 {
+			return certificate, fmt.Errorf("IP %s isn't in a program", ip.ID)
+		}
+		binding.Host = ip.ID
+		binding.IPID = ip.ID
+		binding.ProgramID = ipProgram(ip.ID)
+	} else {
+		name, _, err := normaliseHostname(submission.Host)
+		if err != nil {
+			return certificate, err
+		}
+		subdomain, err := findOrCreateSubdomain(name)
+		if err != nil {
+			return certificate, err
+		}
+		binding.Host = subdomain.ID
+		binding.SubdomainID = subdomain.ID
+		binding.ProgramID = subdomain.ProgramID
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Omit("Bindings").Clauses(clause.OnConflict{DoNothing: true}).Create(&certificate).Error
+		if err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "host"}, {Name: "port"}},
+			DoUpdates: clause.AssignmentColumns([]string{"certificate_id", "subdomain_id", "ip_id", "program_id", "last_seen"}),
+		}).Create(&binding).Error
+	})
+	if err != nil {
+		return certificate, err
+	}
+	db.Where("ID = ?", certificate.ID).Preload("Bindings").Find(&certificate)
+	return certificate, nil
+}
+
+// parseCertificatePEM reads the first certificate in a PEM block, which is the leaf when given a whole chain
+func parseCertificatePEM(data string) (Certificate, error) {
+	var certificate Certificate
+	block, _ := pem.Decode([]byte(data))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return certificate, fmt.Errorf("pem does not contain a certificate")
+	}
+	parsed, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return certificate, fmt.Errorf("could not parse certificate: %v", err)
+	}
+	fingerprint := sha256.Sum256(parsed.Raw)
+	certificate.ID = hex.EncodeToString(fingerprint[:])
+	certificate.Subject = parsed.Subject.String()
+	certificate.Issuer = parsed.Issuer.String()
+	certificate.Serial = parsed.SerialNumber.Text(16)
+	certificate.NotBefore = parsed.NotBefore
+	certificate.NotAfter = parsed.NotAfter
+	certificate.SANs = append(certificate.SANs, parsed.DNSNames...)
+	for _, ip := range parsed.IPAddresses {
+		certificate.SANs = append(certificate.SANs, ip.String())
+	}
+	return certificate, nil
+}
+
+// normaliseFingerprint turns fingerprints written like AB:CD:EF into the stored form, abcdef
+func normaliseFingerprint(fingerprint string) string {
+	return strings.ToLower(strings.NewReplacer(":", "", " ", "").Replace(strings.TrimSpace(fingerprint)))
+}
+
+// Get the hostnames in certificate SANs that aren't stored as subdomains yet, but fall under one of our rootdomains.
+// They are returned as subdomains ready to be imported, and can be filtered with ?program=
+func getUnknownCertificateNames(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	query := db
+	if program := r.URL.Query().Get("program"); program != "" {
+		query = query.Where("id IN (?)", db.Model(&CertificateBinding{}).Select("certificate_id").Where("program_id = ?", program))
+	}
+	var certificates []Certificate
+	query.Select("id", "sans").Find(&certificates)
+
+	var names []string
+	wildcards := make(map[string]bool)
+	for _, certificate := range certificates {
+		for _, san := range certificate.SANs {
+			if _, err := parseIP(san); err == nil {
+				continue
+			}
+			name, wildcard, err := normaliseHostname(san)
+			if err != nil {
+				continue
+			}
+			if _, seen := wildcards[name]; !seen {
+				names = append(names, name)
+			}
+			wildcards[name] = wildcards[name] || wildcard
+		}
+	}
+
+	// look up the names that are already stored in chunks, rather than one query per name
+	stored := make(map[string]bool)
+	for start := 0; start < len(names); start += 1000 {
+		end := start + 1000
+		if end > len(names) {
+			end = len(names)
+		}
+		var ids []string
+		db.Model(&Subdomain{}).Where("id IN ?", names[start:end]).Pluck("id", &ids)
+		for _, id := range ids {
+			stored[id] = true
+		}
+	}
+
+	suggestions := []Subdomain{}
+	rootdomains := rootDomainFinder{}
+	for _, name := range names {
+		if stored[name] {
+			continue
+		}
+		rootdomain, err := rootdomains.find(name)
+		if err != nil {
+			continue
+		}
+		suggestions = append(suggestions, Subdomain{ID: name, Wildcard: wildcards[name], RootDomainID: rootdomain.ID})
+	}
+	json.NewEncoder(w).Encode(suggestions)
+}
+
+// Deletes a certificate
+func deleteCertificate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := normaliseFingerprint(vars["id"])
+	var certificate Certificate
+	db.Where("ID = ?", id).Find(&certificate)
+	deleteCertificateLocal(certificate)
+	var certificates []Certificate
+	db.Find(&certificates)
+	json.NewEncoder(w).Encode(certificates)
+}
+
+func deleteCertificateLocal(certificate Certificate) {
+	db.Unscoped().Where("certificate_id = ?", certificate.ID).Delete(&CertificateBinding{})
+	db.Unscoped().Delete(&certificate)
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// CloudAsset is a structure to store assets that aren't hostnames, like storage buckets, GitHub orgs, Slack
+// workspaces and mobile apps. An asset is identified by its provider, kind and identifier, e.g. aws, s3, tesla-assets.
+type CloudAsset struct {
+	gorm.Model
+	ID         int        `json:"id" gorm:"PrimaryKey;autoIncrement"`
+	Provider   string     `json:"provider" gorm:"uniqueIndex:idx_cloud_assets_identity"`
+	Kind       string     `json:"kind" gorm:"uniqueIndex:idx_cloud_assets_identity"`
+	Identifier string     `json:"identifier" gorm:"uniqueIndex:idx_cloud_assets_identity"`
+	ProgramID  string     `json:"program" gorm:"index"`
+	Access     string     `json:"access" gorm:"index;default:unknown"`
+	Attributes StringMap  `json:"attributes"`
+	Tags       StringList `json:"tags"`
+	Vulns      []*Vuln    `json:"vulns,omitempty" gorm:"many2many:cloud_asset_vulns;"`
+}
+
+// cloudAccessStatuses describe who can get at a cloud asset. Unclaimed means the asset is referenced but doesn't
+// exist, so anyone could register it.
+var cloudAccessStatuses = []string{"unknown", "private", "authenticated", "public_read", "public_write", "unclaimed"}
+
+// cloudAssetUpdate holds the fields of a cloud asset that can be changed through the API, fields that are nil are
+// left alone. Attributes are merged in and keys with an empty value are removed.
+type cloudAssetUpdate struct {
+	ProgramID  *string           `json:"program"`
+	Access     *string           `json:"access"`
+	Attributes map[string]string `json:"attributes"`
+	Tags       *[]string         `json:"tags"`
+	AddTags    []string          `json:"addtags"`
+	RemoveTags []string          `json:"removetags"`
+}
+
+// BeforeSave keeps the provider and kind lowercase so the same asset can't be stored twice
+func (a *CloudAsset) BeforeSave(tx *gorm.DB) (err error) {
+	normaliseCloudAsset(a)
+	return nil
+}
+
+// normaliseCloudAsset trims the identity of a cloud asset and lowercases its provider and kind
+func normaliseCloudAsset(a *CloudAsset) {
+	a.Provider = strings.ToLower(strings.TrimSpace(a.Provider))
+	a.Kind = strings.ToLower(strings.TrimSpace(a.Kind))
+	a.Identifier = strings.TrimSpace(a.Identifier)
+}
+
+// Get all cloud assets. These can be filtered with ?program=, ?provider=, ?kind=, ?access= and ?tag=
+func getCloudAssets(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	query := db
+	for _, filter := range []string{"program", "provider", "kind", "access"} {
+		if value := r.URL.Query().Get(filter); value != "" {
+			column := filter
+			if filter == "program" {
+				column = "program_id"
+			} else {
+				value = strings.ToLower(value)
+			}
+			query = query.Where(column+" = ?", value)
+		}
+	}
+	if tag := r.URL.Query().Get("tag"); tag != "" {
+		// tags are stored as a JSON list, so look for the quoted tag
+		quoted, _ := json.Marshal(tag)
+		query = query.Where("tags LIKE ?", "%"+escapeLike(string(quoted))+"%")
+	}
+	var assets []CloudAsset
+	query.Find(&assets)
+	json.NewEncoder(w).Encode(assets)
+}
+
+// Get a specific cloud asset
+func getCloudAsset(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var asset CloudAsset
+	vars := mux.Vars(r)
+	db.Where("ID = ?", vars["id"]).Preload("Vulns").Find(&asset)
+	json.NewEncoder(w).Encode(&asset)
+}
+
+// Creates new cloud assets, accepts batches. An asset that is already stored has its program and access status
+// updated, and its attributes and tags merged in.
+func createCloudAssets(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var assets []CloudAsset
+	_ = json.NewDecoder(r.Body).Decode(&assets)
+
+	stored := []CloudAsset{}
+	rejected := []Reject{}
+	for i, asset := range assets {
+		item := asset.Provider + "/" + asset.Kind + "/" + asset.Identifier
+		err := saveCloudAsset(&asset)
+		if err != nil {
+			rejected = append(rejected, rejectAt(i, item, err.Error()))
+			continue
+		}
+		stored = append(stored, asset)
+	}
+	writeBatch(w, r, stored, rejected)
+}
+
+// checkCloudAsset normalises a cloud asset and makes sure it can be stored, without writing anything
+func checkCloudAsset(asset *CloudAsset) error {
+	normaliseCloudAsset(asset)
+	if asset.Provider == "" || asset.Kind == "" || asset.Identifier == "" {
+		return fmt.Errorf("a cloud asset needs a provider, kind and identifier")
+	}
+	if asset.Access != "" && !contains(cloudAccessStatuses, asset.Access) {
+		return fmt.Errorf("unknown access status %q, allowed statuses are: %s", asset.Access, strings.Join(cloudAccessStatuses, ", "))
+	}
+	if asset.ProgramID != "" {
+		var count int64
+		db.Model(&Program{}).Where("id = ?", asset.ProgramID).Count(&count)
+		if count == 0 {
+			return fmt.Errorf("program %s does not exist", asset.ProgramID)
+		}
+	}
+	asset.Tags = mergeStrings(nil, asset.Tags)
+	asset.Vulns = nil
+	return nil
+}
+
+// saveCloudAsset validates a cloud asset and stores it, or merges it into the stored asset with the same identity
+func saveCloudAsset(asset *CloudAsset) error {
+	err := checkCloudAsset(asset)
+	if err != nil {
+		return err
+	}
+
+	var existing CloudAsset
+	err = db.Where("provider = ? AND kind = ? AND identifier = ?", asset.Provider, asset.Kind, asset.Identifier).First(&existing).Error
+	if err != nil {
+		asset.ID = 0
+		if asset.Access == "" {
+			asset.Access = "unknown"
+		}
+		return db.Create(asset).Error
+	}
+
+	if asset.ProgramID != "" {
+		existing.ProgramID = asset.ProgramID
+	}
+	if asset.Access != "" {
+		existing.Access = asset.Access
+	}
+	if existing.Attributes == nil {
+		existing.Attributes = StringMap{}
+	}
+	for key, value := range asset.Attributes {
+		existing.Attributes[key] = value
+	}
+	existing.Tags = mergeStrings(existing.Tags, asset.Tags)
+	*asset = existing
+	return db.Model(asset).Select("program_id", "access", "attributes", "tags").Updates(asset).Error
+}
+
+// Updates a cloud asset. Only the fields present in the request body are changed.
+func updateCloudAsset(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	vars := mux.Vars(r)
+	var asset CloudAsset
+	err := db.Where("ID = ?", vars["id"]).First(&asset).Error
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Cloud asset not found.")
+		return
+	}
+
+	var update cloudAssetUpdate
+	_ = json.NewDecoder(r.Body).Decode(&update)
+	if update.ProgramID != nil {
+		if *update.ProgramID != "" {
+			var count int64
+			db.Model(&Program{}).Where("id = ?", *update.ProgramID).Count(&count)
+			if count == 0 {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("Program %q does not exist.", *update.ProgramID))
+				return
+			}
+		}
+		asset.ProgramID = *update.ProgramID
+	}
+	if update.Access != nil {
+		if !contains(cloudAccessStatuses, *update.Access) {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Unknown access status %q.", *update.Access))
+			return
+		}
+		asset.Access = *update.Access
+	}
+	if len(update.Attributes) > 0 && asset.Attributes == nil {
+		asset.Attributes = StringMap{}
+	}
+	for key, value := range update.Attributes {
+		if value == "" {
+			delete(asset.Attributes, key)
+		} else {
+			asset.Attributes[key] = value
+		}
+	}
+	if update.Tags != nil {
+		asset.Tags = mergeStrings(nil, *update.Tags)
+	}
+	asset.Tags = mergeStrings(asset.Tags, update.AddTags)
+	var tags []string
+	for _, tag := range asset.Tags {
+		if !contains(update.RemoveTags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	asset.Tags = mergeStrings(nil, tags)
+
+	db.Model(&asset).Select("program_id", "access", "attributes", "tags").Updates(&asset)
+	json.NewEncoder(w).Encode(&asset)
+}
+
+// Deletes a cloud asset
+func deleteCloudAsset(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	var asset CloudAsset
+	db.Where("ID = ?", id).Find(&asset)
+	deleteCloudAssetLocal(asset)
+	var assets []CloudAsset
+	db.Find(&assets)
+	json.NewEncoder(w).Encode(assets)
+}
+
+// Deletes relationships and then removes the model
+func deleteCloudAssetLocal(asset CloudAsset) {
+	db.Exec("DELETE FROM cloud_asset_vulns WHERE cloud_asset_id = ?", asset.ID)
+	db.Unscoped().Delete(&asset)
+}
+
+// resolveVulnCloudAssets swaps the cloud assets sent with a vuln for the stored ones, so gorm only writes the join
+// rows. Assets can be referred to by ID, or by provider, kind and identifier, in which case they are only checked
+// here and left for saveVulnCloudAssets to store once the vuln itself is known to be valid and new.
+func resolveVulnCloudAssets(vuln *Vuln) error {
+	var resolved []*CloudAsset
+	for _, asset := range vuln.CloudAssets {
+		if asset == nil {
+			continue
+		}
+		var stored CloudAsset
+		if asset.ID != 0 {
+			err := db.Where("id = ?", asset.ID).First(&stored).Error
+			if err != nil {
+				return fmt.Errorf("cloud asset %d does not exist", asset.ID)
+			}
+		} else {
+			stored = *asset
+			if stored.ProgramID == "" {
+				stored.ProgramID = vuln.ProgramID
+			}
+			err := checkCloudAsset(&stored)
+			if err != nil {
+				return err
+			}
+			stored.ID = 0
+		}
+		resolved = append(resolved, &stored)
+	}
+	vuln.CloudAssets = resolved
+	return nil
+}
+
+// saveVulnCloudAssets stores the cloud assets that resolveVulnCloudAssets referred to by provider, kind and
+// identifier, creating the ones that don't exist yet
+func saveVulnCloudAssets(vuln *Vuln) error {
+	for _, asset := range vuln.CloudAssets {
+		if asset.ID != 0 {
+			continue
+		}
+		err := saveCloudAsset(asset)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
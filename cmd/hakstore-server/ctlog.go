@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ctCertificate is a certificate read from a CT log dump, with the names on it as they were logged
+type ctCertificate struct {
+	Names       []string
+	CommonName  string
+	Issuer      string
+	Serial      string
+	NotBefore   time.Time
+	NotAfter    time.Time
+	Fingerprint string
+	LogID       string
+	Source      string
+}
+
+// crtshEntry is an entry of crt.sh's JSON output. name_value has the names on the certificate, one per line.
+type crtshEntry struct {
+	ID           json.Number `json:"id"`
+	IssuerName   string      `json:"issuer_name"`
+	CommonName   string      `json:"common_name"`
+	NameValue    string      `json:"name_value"`
+	SerialNumber string      `json:"serial_number"`
+	NotBefore    string      `json:"not_before"`
+	NotAfter     string      `json:"not_after"`
+}
+
+// certstreamMessage is a message from certstream. Captures are either whole messages or just their data.
+type certstreamMessage struct {
+	MessageType string          `json:"message_type"`
+	Data        json.RawMessage `json:"data"`
+}
+
+// certstreamData is the data of a certstream certificate_update message
+type certstreamData struct {
+	CertIndex json.Number `json:"cert_index"`
+	LeafCert  *struct {
+		Subject struct {
+			Aggregated string `json:"aggregated"`
+			CN         string `json:"CN"`
+		} `json:"subject"`
+		Issuer struct {
+			Aggregated string `json:"aggregated"`
+		} `json:"issuer"`
+		SerialNumber string   `json:"serial_number"`
+		NotBefore    float64  `json:"not_before"`
+		NotAfter     float64  `json:"not_after"`
+		SHA256       string   `json:"sha256"`
+		AllDomains   []string `json:"all_domains"`
+	} `json:"leaf_cert"`
+}
+
+// crtshTimeLayouts are the layouts crt.sh writes certificate dates in, always in UTC
+var crtshTimeLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04:05.999999", time.RFC3339}
+
+func parseCrtshTime(value string) time.Time {
+	for _, layout := range crtshTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// parseCTEntry reads a crt.sh entry or a certstream message. Certstream messages that aren't certificate updates,
+// e.g. heartbeats, return nil.
+func parseCTEntry(raw json.RawMessage) (*ctCertificate, error) {
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(raw, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := fields["name_value"]; ok {
+		var entry crtshEntry
+		err = json.Unmarshal(raw, &entry)
+		if err != nil {
+			return nil, err
+		}
+		return &ctCertificate{
+			Names:      strings.Split(entry.NameValue, "\n"),
+			CommonName: entry.CommonName,
+			Issuer:     entry.IssuerName,
+			Serial:     ctSerial(entry.SerialNumber),
+			NotBefore:  parseCrtshTime(entry.NotBefore),
+			NotAfter:   parseCrtshTime(entry.NotAfter),
+			LogID:      entry.ID.String(),
+			Source:     "crtsh",
+		}, nil
+	}
+
+	data := raw
+	if _, ok := fields["message_type"]; ok {
+		var message certstreamMessage
+		err = json.Unmarshal(raw, &message)
+		if err != nil {
+			return nil, err
+		}
+		if message.MessageType != "certificate_update" {
+			return nil, nil
+		}
+		data = message.Data
+	} else if _, ok := fields["leaf_cert"]; !ok {
+		return nil, fmt.Errorf("not a crt.sh entry or certstream message")
+	}
+	var update certstreamData
+	err = json.Unmarshal(data, &update)
+	if err != nil {
+		return nil, err
+	}
+	if update.LeafCert == nil {
+		return nil, fmt.Errorf("certstream message has no leaf_cert")
+	}
+	leaf := update.LeafCert
+	return &ctCertificate{
+		Names:       leaf.AllDomains,
+		CommonName:  leaf.Subject.CN,
+		Issuer:      leaf.Issuer.Aggregated,
+		Serial:      ctSerial(leaf.SerialNumber),
+		NotBefore:   time.Unix(int64(leaf.NotBefore), 0).UTC(),
+		NotAfter:    time.Unix(int64(leaf.NotAfter), 0).UTC(),
+		Fingerprint: normaliseFingerprint(leaf.SHA256),
+		LogID:       update.CertIndex.String(),
+		Source:      "certstream",
+	}, nil
+}
+
+// ctSerial writes a logged serial number the way parsed certificates store it, lowercase hex without leading zeros
+func ctSerial(serial string) string {
+	serial = strings.TrimLeft(strings.ToLower(strings.NewReplacer(":", "", " ", "").Replace(serial)), "0")
+	if serial == "" {
+		return "0"
+	}
+	return serial
+}
+
+// parseCTLog reads a CT log dump, either a JSON array like crt.sh's output or one JSON object per line like a
+// certstream capture, and calls found with each certificate in it. Entries that can't be read are returned as
+// rejects.
+func parseCTLog(reader io.Reader, found func(certificate ctCertificate)) ([]Reject, error) {
+	rejected := []Reject{}
+	handle := func(item string, raw json.RawMessage) {
+		certificate, err := parseCTEntry(raw)
+		if err != nil {
+			rejected = append(rejected, Reject{Item: item, Reason: err.Error()})
+			return
+		}
+		if certificate != nil {
+			found(*certificate)
+		}
+	}
+
+	buffered := bufio.NewReader(reader)
+	first, err := firstNonSpace(buffered)
+	if err == io.EOF {
+		return rejected, nil
+	}
+	if err != nil {
+		return rejected, err
+	}
+
+	if first == '[' {
+		decoder := json.NewDecoder(buffered)
+		_, err = decoder.Token()
+		if err != nil {
+			return rejected, err
+		}
+		for entry := 1; decoder.More(); entry++ {
+			var raw json.RawMessage
+			err = decoder.Decode(&raw)
+			if err != nil {
+				return rejected, err
+			}
+			handle(fmt.Sprintf("entry %d", entry), raw)
+		}
+		return rejected, nil
+	}
+
+	scanner := bufio.NewScanner(buffered)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		handle("line "+strconv.Itoa(line), json.RawMessage(append([]byte(nil), text...)))
+	}
+	return rejected, scanner.Err()
+}
+
+// firstNonSpace peeks at the first character of a reader that isn't whitespace, without consuming it
+func firstNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		if !strings.ContainsRune(" \t\r\n", rune(b[0])) {
+			return b[0], nil
+		}
+		reader.ReadByte()
+	}
+}
+
+// ctName turns a name logged on a certificate into the hostname it covers, wildcards cover the name they're on. Names
+// that aren't hostnames, e.g. email addresses and IPs, return false.
+func ctName(name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.Contains(name, "@") {
+		return "", false
+	}
+	if _, err := parseIP(name); err == nil {
+		return "", false
+	}
+	host, _, err := normaliseHostname(name)
+	if err != nil {
+		return "", false
+	}
+	return host, true
+}
+
+// Imports certificate transparency log dumps, either crt.sh's JSON output or certstream captures with one message per
+// line. The names on each certificate have wildcards stripped and duplicates removed, and those under a rootdomain of
+// a program become subdomains. Names under no rootdomain, or under one that isn't in a program, are skipped. With
+// ?program= only names in that program's scope are imported. Certificates with at least one imported name are stored
+// and bound to those subdomains on port 0, which always points at the latest certificate logged for the subdomain.
+func importCTLog(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	program, err := importProgram(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	summary := newImportSummary()
+	subdomains := make(map[string]*Subdomain)
+	skippedNames := make(map[string]bool)
+	rejected, err := parseCTLog(importBody(r), func(logged ctCertificate) {
+		seen := make(map[string]bool)
+		var names []*Subdomain
+		for _, name := range logged.Names {
+			host, ok := ctName(name)
+			if !ok || seen[host] || skippedNames[host] {
+				continue
+			}
+			seen[host] = true
+
+			subdomain, ok := subdomains[host]
+			if !ok {
+				rootdomain, err := findRootDomain(host)
+				if err != nil {
+					skippedNames[host] = true
+					summary.skip("subdomains", host, err.Error())
+					continue
+				}
+				if rootdomain.ProgramID == "" {
+					skippedNames[host] = true
+					summary.skip("subdomains", host, "rootdomain "+rootdomain.ID+" isn't in a program")
+					continue
+				}
+				imported, outcome, reason, err := importSubdomain(host, []string{logged.Source}, program)
+				if err != nil {
+					skippedNames[host] = true
+					summary.Rejected = append(summary.Rejected, Reject{Item: host, Reason: err.Error()})
+					continue
+				}
+				if outcome == ImportSkipped {
+					skippedNames[host] = true
+					summary.skip("subdomains", imported.ID, reason)
+					continue
+				}
+				summary.record("subdomains", outcome)
+				subdomain = &imported
+				subdomains[host] = subdomain
+			}
+			names = append(names, subdomain)
+		}
+		if len(names) == 0 {
+			return
+		}
+
+		certificate, outcome, err := storeLoggedCertificate(logged)
+		if err != nil {
+			summary.Rejected = append(summary.Rejected, Reject{Item: logged.Source + " " + logged.LogID, Reason: err.Error()})
+			return
+		}
+		summary.record("certificates", outcome)
+		for _, subdomain := range names {
+			err = bindLoggedCertificate(certificate, *subdomain)
+			if err != nil {
+				summary.Rejected = append(summary.Rejected, Reject{Item: subdomain.ID + " " + certificate.ID, Reason: err.Error()})
+			}
+		}
+	})
+	summary.Rejected = append(summary.Rejected, rejected...)
+	if err != nil {
+		summary.Rejected = append(summary.Rejected, Reject{Item: "input", Reason: "Could not read the rest of the log: " + err.Error()})
+	}
+	json.NewEncoder(w).Encode(summary)
+}
+
+// storeLoggedCertificate stores a certificate read from a CT log, or adds the logged names to the stored one. A
+// precertificate and the certificate issued from it share an issuer and serial, so they are stored once.
+func storeLoggedCertificate(logged ctCertificate) (Certificate, string, error) {
+	var sans []string
+	for _, name := range logged.Names {
+		sans = append(sans, strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), "."))
+	}
+
+	var existing Certificate
+	found := false
+	if logged.Fingerprint != "" {
+		found = db.Where("id = ?", logged.Fingerprint).Limit(1).Find(&existing).RowsAffected > 0
+	}
+	if !found && logged.Serial != "" {
+		found = db.Where("issuer = ? AND serial = ?", logged.Issuer, logged.Serial).Limit(1).Find(&existing).RowsAffected > 0
+	}
+	if found {
+		existing.SANs = mergeStrings(existing.SANs, sans)
+		if existing.LogID == "" {
+			existing.LogID = logged.LogID
+			existing.Source = logged.Source
+		}
+		err := db.Model(&existing).Select("sans", "log_id", "source").Updates(&existing).Error
+		return existing, ImportUpdated, err
+	}
+
+	certificate := Certificate{
+		ID:        logged.Fingerprint,
+		Issuer:    logged.Issuer,
+		Serial:    logged.Serial,
+		NotBefore: logged.NotBefore,
+		NotAfter:  logged.NotAfter,
+		SANs:      mergeStrings(nil, sans),
+		LogID:     logged.LogID,
+		Source:    logged.Source,
+	}
+	if logged.CommonName != "" {
+		certificate.Subject = "CN=" + logged.CommonName
+	}
+	if certificate.ID == "" {
+		if logged.LogID == "" {
+			return certificate, "", fmt.Errorf("certificate has no fingerprint or log ID")
+		}
+		certificate.ID = logged.Source + "-" + logged.LogID
+	}
+	return certificate, ImportCreated, db.Omit("Bindings").Create(&certificate).Error
+}
+
+// bindLoggedCertificate binds a logged certificate to a subdomain on port 0. The binding only moves to a certificate
+// issued after the one it points at, so importing an older dump doesn't roll it back.
+func bindLoggedCertificate(certificate Certificate, subdomain Subdomain) error {
+	now := time.Now()
+	var binding CertificateBinding
+	if db.Where("host = ? AND port = 0", subdomain.ID).Limit(1).Find(&binding).RowsAffected == 0 {
+		return db.Create(&CertificateBinding{
+			CertificateID: certificate.ID,
+			Host:          subdomain.ID,
+			SubdomainID:   subdomain.ID,
+			ProgramID:     subdomain.ProgramID,
+			LastSeen:      now,
+		}).Error
+	}
+	if binding.CertificateID != certificate.ID {
+		var bound Certificate
+		db.Where("id = ?", binding.CertificateID).Limit(1).Find(&bound)
+		if bound.ID != "" && !certificate.NotBefore.After(bound.NotBefore) {
+			return nil
+		}
+		binding.CertificateID = certificate.ID
+	}
+	binding.ProgramID = subdomain.ProgramID
+	binding.LastSeen = now
+	return db.Model(&binding).Select("certificate_id", "program_id", "last_seen").Updates(&binding).Error
+}
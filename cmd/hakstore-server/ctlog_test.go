@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseCTEntry(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    *ctCertificate
+		wantErr bool
+	}{
+		{
+			name: "crt.sh entry",
+			raw: `{"issuer_name": "C=US, O=Let's Encrypt, CN=R3", "common_name": "www.tesla.com", "name_value": "tesla.com\nwww.tesla.com",
+				"id": 4412338391, "serial_number": "03e2a9c2b0c5fbb1e4e3f31ae4f6b8c2d1f0", "not_before": "2021-05-01T12:00:00", "not_after": "2021-07-30T12:00:00"}`,
+			want: &ctCertificate{
+				Names:      []string{"tesla.com", "www.tesla.com"},
+				CommonName: "www.tesla.com",
+				Issuer:     "C=US, O=Let's Encrypt, CN=R3",
+				Serial:     "3e2a9c2b0c5fbb1e4e3f31ae4f6b8c2d1f0",
+				NotBefore:  time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC),
+				NotAfter:   time.Date(2021, 7, 30, 12, 0, 0, 0, time.UTC),
+				LogID:      "4412338391",
+				Source:     "crtsh",
+			},
+		},
+		{
+			name: "certstream message",
+			raw: `{"message_type": "certificate_update", "data": {"cert_index": 123, "leaf_cert": {"subject": {"CN": "*.tesla.com"},
+				"issuer": {"aggregated": "/C=US/O=Let's Encrypt/CN=R3"}, "serial_number": "0A1B", "not_before": 1619870400,
+				"not_after": 1627646400, "sha256": "AB:CD:EF", "all_domains": ["*.tesla.com", "tesla.com"]}}}`,
+			want: &ctCertificate{
+				Names:       []string{"*.tesla.com", "tesla.com"},
+				CommonName:  "*.tesla.com",
+				Issuer:      "/C=US/O=Let's Encrypt/CN=R3",
+				Serial:      "a1b",
+				NotBefore:   time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC),
+				NotAfter:    time.Date(2021, 7, 30, 12, 0, 0, 0, time.UTC),
+				Fingerprint: "abcdef",
+				LogID:       "123",
+				Source:      "certstream",
+			},
+		},
+		{
+			name: "certstream heartbeat",
+			raw:  `{"message_type": "heartbeat", "timestamp": 1619870400}`,
+		},
+		{
+			name:    "certstream data without a leaf certificate",
+			raw:     `{"leaf_cert": null, "cert_index": 1}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown object",
+			raw:     `{"host": "www.tesla.com"}`,
+			wantErr: true,
+		},
+		{
+			name:    "not an object",
+			raw:     `["www.tesla.com"]`,
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseCTEntry(json.RawMessage(test.raw))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("parseCTEntry() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseCTEntry() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCTSerial(t *testing.T) {
+	tests := []struct {
+		serial string
+		want   string
+	}{
+		{serial: "03E2A9", want: "3e2a9"},
+		{serial: "03:e2:a9", want: "3e2a9"},
+		{serial: "00", want: "0"},
+	}
+	for _, test := range tests {
+		t.Run(test.serial, func(t *testing.T) {
+			if got := ctSerial(test.serial); got != test.want {
+				t.Errorf("ctSerial(%q) = %q, want %q", test.serial, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// cvssWeights holds the weight of each value of each CVSS v3 base metric. PR is handled separately because its
+// weights depend on the scope.
+var cvssWeights = map[string]map[string]float64{
+	"AV": {"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.2},
+	"AC": {"L": 0.77, "H": 0.44},
+	"UI": {"N": 0.85, "R": 0.62},
+	"C":  {"H": 0.56, "L": 0.22, "N": 0},
+	"I":  {"H": 0.56, "L": 0.22, "N": 0},
+	"A":  {"H": 0.56, "L": 0.22, "N": 0},
+}
+
+// cvssBaseScore calculates the CVSS v3 base score of a vector like CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H.
+// Temporal and environmental metrics are allowed in the vector but don't affect the result.
+func cvssBaseScore(vector string) (float64, error) {
+	parts := strings.Split(strings.TrimSpace(vector), "/")
+	if parts[0] != "CVSS:3.0" && parts[0] != "CVSS:3.1" {
+		return 0, fmt.Errorf("CVSS vector %q must start with CVSS:3.0 or CVSS:3.1", vector)
+	}
+	metrics := make(map[string]string)
+	for _, part := range parts[1:] {
+		metric := strings.SplitN(part, ":", 2)
+		if len(metric) != 2 {
+			return 0, fmt.Errorf("CVSS vector %q has a malformed metric %q", vector, part)
+		}
+		metrics[metric[0]] = metric[1]
+	}
+
+	weights := make(map[string]float64)
+	for _, metric := range []string{"AV", "AC", "UI", "C", "I", "A"} {
+		weight, ok := cvssWeights[metric][metrics[metric]]
+		if !ok {
+			return 0, fmt.Errorf("CVSS vector %q is missing the %s metric or has an invalid value for it", vector, metric)
+		}
+		weights[metric] = weight
+	}
+	scope := metrics["S"]
+	if scope != "U" && scope != "C" {
+		return 0, fmt.Errorf("CVSS vector %q is missing the S metric or has an invalid value for it", vector)
+	}
+	switch {
+	case metrics["PR"] == "N":
+		weights["PR"] = 0.85
+	case metrics["PR"] == "L" && scope == "U":
+		weights["PR"] = 0.62
+	case metrics["PR"] == "L" && scope == "C":
+		weights["PR"] = 0.68
+	case metrics["PR"] == "H" && scope == "U":
+		weights["PR"] = 0.27
+	case metrics["PR"] == "H" && scope == "C":
+		weights["PR"] = 0.5
+	default:
+		return 0, fmt.Errorf("CVSS vector %q is missing the PR metric or has an invalid value for it", vector)
+	}
+
+	iss := 1 - (1-weights["C"])*(1-weights["I"])*(1-weights["A"])
+	var impact float64
+	if scope == "U" {
+		impact = 6.42 * iss
+	} else {
+		impact = 7.52*(iss-0.029) - 3.25*math.Pow(iss-0.02, 15)
+	}
+	exploitability := 8.22 * weights["AV"] * weights["AC"] * weights["PR"] * weights["UI"]
+
+	if impact <= 0 {
+		return 0, nil
+	}
+	if scope == "U" {
+		return cvssRoundUp(math.Min(impact+exploitability, 10)), nil
+	}
+	return cvssRoundUp(math.Min(1.08*(impact+exploitability), 10)), nil
+}
+
+// cvssRoundUp rounds up to one decimal place the way the CVSS v3.1 specification does, avoiding floating point errors
+func cvssRoundUp(value float64) float64 {
+	scaled := int(math.Round(value * 100000))
+	if scaled%10000 == 0 {
+		return float64(scaled) / 100000
+	}
+	return float64(scaled/10000+1) / 10
+}
+
+// severityFromCVSS maps a CVSS score onto hakstore's severities, 1 being critical and 5 informational
+func severityFromCVSS(score float64) int {
+	switch {
+	case score >= 9:
+		return 1
+	case score >= 7:
+		return 2
+	case score >= 4:
+		return 3
+	case score > 0:
+		return 4
+	}
+	return 5
+}
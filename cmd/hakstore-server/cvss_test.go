@@ -0,0 +1,55 @@
+package main
+
+import "testing"
+
+func TestCVSSBaseScore(t *testing.T) {
+	tests := []struct {
+		vector  string
+		want    float64
+		wantErr bool
+	}{
+		{vector: "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H", want: 9.8},
+		{vector: "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:C/C:H/I:H/A:H", want: 10},
+		{vector: "CVSS:3.1/AV:N/AC:L/PR:N/UI:R/S:C/C:L/I:L/A:N", want: 6.1},
+		{vector: "CVSS:3.0/AV:L/AC:H/PR:H/UI:R/S:U/C:L/I:N/A:N", want: 1.8},
+		{vector: "CVSS:3.1/AV:N/AC:L/PR:L/UI:N/S:U/C:H/I:N/A:N/E:P/RL:O", want: 6.5},
+		{vector: "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:N/I:N/A:N", want: 0},
+		{vector: "CVSS:2.0/AV:N/AC:L/Au:N/C:P/I:P/A:P", wantErr: true},
+		{vector: "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H", wantErr: true},
+		{vector: "CVSS:3.1/AV:X/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H", wantErr: true},
+		{vector: "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/C:H/I:H/A:H", wantErr: true},
+		{vector: "CVSS:3.1/AV:N/AC:L/PR/UI:N/S:U/C:H/I:H/A:H", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.vector, func(t *testing.T) {
+			got, err := cvssBaseScore(test.vector)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("cvssBaseScore() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("cvssBaseScore() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSeverityFromCVSS(t *testing.T) {
+	tests := []struct {
+		score float64
+		want  int
+	}{
+		{score: 10, want: 1},
+		{score: 9, want: 1},
+		{score: 8.9, want: 2},
+		{score: 7, want: 2},
+		{score: 4, want: 3},
+		{score: 3.9, want: 4},
+		{score: 0.1, want: 4},
+		{score: 0, want: 5},
+	}
+	for _, test := range tests {
+		if got := severityFromCVSS(test.score); got != test.want {
+			t.Errorf("severityFromCVSS(%v) = %d, want %d", test.score, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// DNSRecord is a DNS record of a subdomain, e.g. from a zone file. The value is normalised for the record type, so
+// names have no trailing dot and MX records are "preference exchange".
+type DNSRecord struct {
+	gorm.Model
+	ID          int       `json:"id" gorm:"PrimaryKey;autoIncrement"`
+	SubdomainID string    `json:"subdomain" gorm:"uniqueIndex:idx_dns_records_record"`
+	Type        string    `json:"type" gorm:"uniqueIndex:idx_dns_records_record"`
+	Value       string    `json:"value" gorm:"uniqueIndex:idx_dns_records_record"`
+	TTL         int       `json:"ttl" gorm:"column:ttl"`
+	Source      string    `json:"source"`
+	FirstSeen   time.Time `json:"firstseen"`
+	LastSeen    time.Time `json:"lastseen"`
+}
+
+// zoneRecordTypes are the record types that are imported from zone files
+var zoneRecordTypes = []string{"A", "AAAA", "CNAME", "MX", "TXT", "NS"}
+
+// Get all DNS records. These can be filtered with ?subdomain=, ?type= and ?value=, and to a program's subdomains with
+// ?program=
+func getDNSRecords(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	query := db
+	if subdomain := r.URL.Query().Get("subdomain"); subdomain != "" {
+		query = query.Where("subdomain_id = ?", subdomain)
+	}
+	if recordType := r.URL.Query().Get("type"); recordType != "" {
+		query = query.Where("type = ?", strings.ToUpper(recordType))
+	}
+	if value := r.URL.Query().Get("value"); value != "" {
+		query = query.Where("value = ?", value)
+	}
+	if program := r.URL.Query().Get("program"); program != "" {
+		query = query.Where("subdomain_id IN (?)", db.Model(&Subdomain{}).Select("id").Where("program_id = ?", program))
+	}
+	var records []DNSRecord
+	query.Order("subdomain_id, type, value").Find(&records)
+	json.NewEncoder(w).Encode(records)
+}
+
+// Deletes a DNS record
+func deleteDNSRecord(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	db.Unscoped().Where("ID = ?", vars["id"]).Delete(&DNSRecord{})
+	var records []DNSRecord
+	db.Find(&records)
+	json.NewEncoder(w).Encode(records)
+}
+
+// zoneRecord is a resource record read from a zone file, with its owner name made absolute
+type zoneRecord struct {
+	Name  string
+	TTL   int
+	Type  string
+	Value string
+	Line  int
+}
+
+// zoneLine is a logical line of a zone file, parentheses can spread one over several lines of text
+type zoneLine struct {
+	tokens []string
+	// blankOwner is set when the line starts with whitespace, meaning the record has the previous record's owner
+	blankOwner bool
+	number     int
+}
+
+// zoneLines splits a zone file into logical lines of tokens. Comments are dropped, parentheses join lines, and quoted
+// strings are kept as a single token with their quotes so TXT records can tell them apart.
+func zoneLines(reader io.Reader) ([]zoneLine, error) {
+	var lines []zoneLine
+	var current zoneLine
+	depth := 0
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	number := 0
+	for scanner.Scan() {
+		number++
+		text := scanner.Text()
+		if depth == 0 {
+			current = zoneLine{number: number, blankOwner: len(text) > 0 && (text[0] == ' ' || text[0] == '\t')}
+		}
+
+		var token strings.Builder
+		inQuotes, hasToken := false, false
+		flush := func() {
+			if hasToken {
+				current.tokens = append(current.tokens, token.String())
+			}
+			token.Reset()
+			hasToken = false
+		}
+	characters:
+		for i := 0; i < len(text); i++ {
+			c := text[i]
+			switch {
+			case inQuotes:
+				token.WriteByte(c)
+				if c == '\\' && i+1 < len(text) {
+					i++
+					token.WriteByte(text[i])
+				} else if c == '"' {
+					inQuotes = false
+				}
+			case c == '"':
+				flush()
+				token.WriteByte(c)
+				inQuotes, hasToken = true, true
+			case c == ';':
+				break characters
+			case c == '(':
+				flush()
+				depth++
+			case c == ')':
+				flush()
+				if depth == 0 {
+					return nil, fmt.Errorf("line %d: unbalanced )", number)
+				}
+				depth--
+			case c == ' ' || c == '\t' || c == '\r':
+				flush()
+			default:
+				token.WriteByte(c)
+				hasToken = true
+			}
+		}
+		if inQuotes {
+			return nil, fmt.Errorf("line %d: unterminated quoted string", number)
+		}
+		flush()
+		if depth == 0 && len(current.tokens) > 0 {
+			lines = append(lines, current)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced ( starting on line %d", current.number)
+	}
+	return lines, nil
+}
+
+// parseZoneTTL reads a TTL, either in seconds or with BIND's units like 1h30m
+func parseZoneTTL(value string) (int, bool) {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return seconds, seconds >= 0
+	}
+	units := map[byte]int{'s': 1, 'm': 60, 'h': 3600, 'd': 86400, 'w': 604800}
+	total, number := 0, ""
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c >= '0' && c <= '9' {
+			number += string(c)
+			continue
+		}
+		unit, ok := units[c|0x20]
+		if !ok || number == "" {
+			return 0, false
+		}
+		n, _ := strconv.Atoi(number)
+		total += n * unit
+		number = ""
+	}
+	return total, number == "" && value != ""
+}
+
+// zoneName makes a name from a zone file absolute, @ being the origin and names without a trailing dot being relative
+// to it. The result is lowercase without the trailing dot.
+func zoneName(name string, origin string) (string, error) {
+	if name == "@" {
+		if origin == "" {
+			return "", fmt.Errorf("@ used with no $ORIGIN, set one with ?origin=")
+		}
+		return origin, nil
+	}
+	if strings.HasSuffix(name, ".") {
+		return strings.ToLower(strings.TrimSuffix(name, ".")), nil
+	}
+	if origin == "" {
+		return "", fmt.Errorf("relative name %s with no $ORIGIN, set one with ?origin=", name)
+	}
+	return strings.ToLower(name) + "." + origin, nil
+}
+
+// parseZone reads the records of an RFC 1035 zone file, or the output of dig axfr which is in the same format.
+// Records of types that aren't imported are returned too, so they can be counted. origin is the zone's origin if the
+// file doesn't set one with $ORIGIN, and is otherwise taken from the first SOA record.
+func parseZone(reader io.Reader, origin string) ([]zoneRecord, []Reject, error) {
+	lines, err := zoneLines(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	origin = strings.ToLower(strings.TrimSuffix(origin, "."))
+	defaultTTL := 0
+	owner := ""
+	var records []zoneRecord
+	var rejected []Reject
+	reject := func(line zoneLine, reason string) {
+		rejected = append(rejected, Reject{Item: fmt.Sprintf("line %d", line.number), Reason: reason})
+	}
+
+	for _, line := range lines {
+		tokens := line.tokens
+		switch strings.ToUpper(tokens[0]) {
+		case "$ORIGIN":
+			if len(tokens) < 2 || !strings.HasSuffix(tokens[1], ".") {
+				reject(line, "$ORIGIN needs an absolute name")
+				continue
+			}
+			origin = strings.ToLower(strings.TrimSuffix(tokens[1], "."))
+			continue
+		case "$TTL":
+			ttl, ok := 0, len(tokens) > 1
+			if ok {
+				ttl, ok = parseZoneTTL(tokens[1])
+			}
+			if !ok {
+				reject(line, "invalid $TTL")
+				continue
+			}
+			defaultTTL = ttl
+			continue
+		case "$INCLUDE", "$GENERATE":
+			reject(line, tokens[0]+" isn't supported")
+			continue
+		}
+
+		if !line.blankOwner {
+			// the owner is made absolute straight away, so a later $ORIGIN doesn't change the records that repeat it
+			owner, err = zoneName(tokens[0], origin)
+			tokens = tokens[1:]
+			if err != nil {
+				reject(line, err.Error())
+				continue
+			}
+		}
+		if owner == "" {
+			reject(line, "record has no owner name")
+			continue
+		}
+		record := zoneRecord{Name: owner, TTL: defaultTTL, Line: line.number}
+		// the TTL and class are both optional and can come in either order
+		for len(tokens) > 0 {
+			class := strings.ToUpper(tokens[0])
+			if ttl, ok := parseZoneTTL(tokens[0]); ok && tokens[0][0] >= '0' && tokens[0][0] <= '9' {
+				record.TTL = ttl
+			} else if class != "IN" && class != "CH" && class != "HS" && class != "CS" {
+				break
+			}
+			tokens = tokens[1:]
+		}
+		if len(tokens) == 0 {
+			reject(line, "record has no type")
+			continue
+		}
+		record.Type, tokens = strings.ToUpper(tokens[0]), tokens[1:]
+
+		if origin == "" && record.Type == "SOA" {
+			origin = owner
+		}
+		if !contains(zoneRecordTypes, record.Type) {
+			records = append(records, record)
+			continue
+		}
+		if len(tokens) == 0 {
+			reject(line, record.Type+" record has no data")
+			continue
+		}
+
+		switch record.Type {
+		case "A", "AAAA":
+			addr, err := parseIP(tokens[0])
+			if err != nil || (record.Type == "A") != addr.Is4() {
+				reject(line, fmt.Sprintf("%q is not a valid %s address", tokens[0], record.Type))
+				continue
+			}
+			record.Value = addr.String()
+		case "CNAME", "NS":
+			record.Value, err = zoneName(tokens[0], origin)
+		case "MX":
+			if len(tokens) < 2 {
+				reject(line, "MX record needs a preference and an exchange")
+				continue
+			}
+			var exchange string
+			exchange, err = zoneName(tokens[1], origin)
+			record.Value = tokens[0] + " " + exchange
+		case "TXT":
+			// the strings of a TXT record are joined, the same way SPF and DKIM records spread over several are read
+			var text strings.Builder
+			for _, token := range tokens {
+				if unquoted, err := strconv.Unquote(token); err == nil {
+					token = unquoted
+				}
+				text.WriteString(token)
+			}
+			record.Value = text.String()
+		}
+		if err != nil {
+			reject(line, err.Error())
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, rejected, nil
+}
+
+// Imports a zone file, or the output of a zone transfer (dig axfr). Every owner name becomes a subdomain under the
+// rootdomain it falls under, its A, AAAA, CNAME, MX, TXT and NS records are stored against it, and the addresses of
+// A and AAAA records become IPs associated with it. ?origin= is the zone's origin when the file has no $ORIGIN or SOA
+// record, and ?source= tags the subdomains and records with where the zone came from, e.g. axfr:ns1.tesla.com
+// (zone by default). With ?program= only names in that program's scope are imported.
+func importZone(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	program, err := importProgram(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	source := strings.TrimSpace(r.URL.Query().Get("source"))
+	if source == "" {
+		source = "zone"
+	}
+
+	records, rejected, err := parseZone(importBody(r), r.URL.Query().Get("origin"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Could not read the zone: "+err.Error())
+		return
+	}
+	summary := newImportSummary()
+	summary.Rejected = append(summary.Rejected, rejected...)
+
+	subdomains := make(map[string]*Subdomain)
+	skippedNames := make(map[string]string)
+	skippedTypes := make(map[string]bool)
+	nameservers := make(map[string][]*net.NS)
+	for _, record := range records {
+		if !contains(zoneRecordTypes, record.Type) {
+			if !skippedTypes[record.Type] {
+				skippedTypes[record.Type] = true
+				summary.Skipped = append(summary.Skipped, Reject{Item: record.Type, Reason: "records of this type aren't imported"})
+			}
+			summary.record("records", ImportSkipped)
+			continue
+		}
+		if reason, ok := skippedNames[record.Name]; ok {
+			summary.skip("records", fmt.Sprintf("line %d", record.Line), record.Name+" skipped: "+reason)
+			continue
+		}
+
+		subdomain, ok := subdomains[record.Name]
+		if !ok {
+			imported, outcome, reason, err := importSubdomain(record.Name, []string{source}, program)
+			if err != nil {
+				skippedNames[record.Name] = err.Error()
+				summary.Rejected = append(summary.Rejected, Reject{Item: record.Name, Reason: err.Error()})
+				summary.record("records", ImportSkipped)
+				continue
+			}
+			if outcome == ImportSkipped {
+				skippedNames[record.Name] = reason
+				summary.skip("subdomains", imported.ID, reason)
+				summary.skip("records", fmt.Sprintf("line %d", record.Line), imported.ID+" skipped: "+reason)
+				continue
+			}
+			summary.record("subdomains", outcome)
+			subdomain = &imported
+			subdomains[record.Name] = subdomain
+		}
+
+		outcome, err := storeDNSRecord(DNSRecord{SubdomainID: subdomain.ID, Type: record.Type, Value: record.Value, TTL: record.TTL, Source: source})
+		if err != nil {
+			summary.Rejected = append(summary.Rejected, Reject{Item: fmt.Sprintf("line %d", record.Line), Reason: err.Error()})
+			continue
+		}
+		summary.record("records", outcome)
+
+		switch record.Type {
+		case "A", "AAAA":
+			_, outcome, err := importIP(&summary, record.Value, 0, "", *subdomain)
+			if err != nil {
+				summary.Rejected = append(summary.Rejected, Reject{Item: record.Value, Reason: err.Error()})
+				continue
+			}
+			summary.record("ips", outcome)
+		case "CNAME":
+			// resolved CNAMEs are stored with the trailing dot, so zone CNAMEs are too
+			if cname := record.Value + "."; subdomain.CNAME != cname {
+				subdomain.CNAME = cname
+				db.Model(subdomain).Update("CNAME", cname)
+				queueTakeoverCheck(*subdomain)
+			}
+		case "NS":
+			nameservers[subdomain.ID] = append(nameservers[subdomain.ID], &net.NS{Host: record.Value + "."})
+		}
+	}
+
+	// nameservers are kept the same way updateDNSData keeps the resolved ones
+	for id, list := range nameservers {
+		jsonNameservers, err := json.Marshal(list)
+		if err == nil {
+			db.Model(&Subdomain{}).Where("id = ?", id).Update("nameservers", string(jsonNameservers))
+		}
+	}
+	summary.syncIPs()
+	json.NewEncoder(w).Encode(summary)
+}
+
+// storeDNSRecord stores a DNS record, or marks the stored one as seen again and updates its TTL and source
+func storeDNSRecord(record DNSRecord) (string, error) {
+	now := time.Now()
+	var existing DNSRecord
+	err := db.Where("subdomain_id = ? AND type = ? AND value = ?", record.SubdomainID, record.Type, record.Value).First(&existing).Error
+	if err == nil {
+		existing.TTL = record.TTL
+		existing.Source = record.Source
+		existing.LastSeen = now
+		err = db.Model(&existing).Select("ttl", "source", "last_seen").Updates(&existing).Error
+		return ImportUpdated, err
+	}
+	record.FirstSeen = now
+	record.LastSeen = now
+	return ImportCreated, db.Create(&record).Error
+}
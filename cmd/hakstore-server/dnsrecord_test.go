@@ -0,0 +1,106 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseZoneTTL(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   int
+		wantOK bool
+	}{
+		{value: "3600", want: 3600, wantOK: true},
+		{value: "0", want: 0, wantOK: true},
+		{value: "1h30m", want: 5400, wantOK: true},
+		{value: "1W2D", want: 777600, wantOK: true},
+		{value: "-1"},
+		{value: "1h30"},
+		{value: "h"},
+		{value: "1y"},
+		{value: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			got, ok := parseZoneTTL(test.value)
+			if ok != test.wantOK || (ok && got != test.want) {
+				t.Errorf("parseZoneTTL(%q) = %d, %v, want %d, %v", test.value, got, ok, test.want, test.wantOK)
+			}
+		})
+	}
+}
+
+func TestParseZone(t *testing.T) {
+	tests := []struct {
+		name         string
+		zone         string
+		origin       string
+		want         []zoneRecord
+		wantRejected []string
+		wantErr      bool
+	}{
+		{
+			name: "bind zone",
+			zone: `$ORIGIN Tesla.com.
+$TTL 1h
+@	IN	SOA	ns1 hostmaster (
+		2021010101 ; serial
+		3600 900 604800 300 )
+	IN	NS	ns1
+www	300	IN	A	192.0.2.1
+	IN	AAAA	2001:db8::1
+shop	IN	CNAME	shops.myshopify.com.
+@	MX	10 mail
+@	TXT	"v=spf1 " "include:_spf.google.com ~all"
+`,
+			want: []zoneRecord{
+				{Name: "tesla.com", TTL: 3600, Type: "SOA", Line: 3},
+				{Name: "tesla.com", TTL: 3600, Type: "NS", Value: "ns1.tesla.com", Line: 6},
+				{Name: "www.tesla.com", TTL: 300, Type: "A", Value: "192.0.2.1", Line: 7},
+				{Name: "www.tesla.com", TTL: 3600, Type: "AAAA", Value: "2001:db8::1", Line: 8},
+				{Name: "shop.tesla.com", TTL: 3600, Type: "CNAME", Value: "shops.myshopify.com", Line: 9},
+				{Name: "tesla.com", TTL: 3600, Type: "MX", Value: "10 mail.tesla.com", Line: 10},
+				{Name: "tesla.com", TTL: 3600, Type: "TXT", Value: "v=spf1 include:_spf.google.com ~all", Line: 11},
+			},
+		},
+		{
+			name:   "dig axfr with an origin",
+			zone:   "tesla.com.\t300\tIN\tA\t192.0.2.1\nwww\t300\tIN\tA\t192.0.2.2\n",
+			origin: "tesla.com.",
+			want: []zoneRecord{
+				{Name: "tesla.com", TTL: 300, Type: "A", Value: "192.0.2.1", Line: 1},
+				{Name: "www.tesla.com", TTL: 300, Type: "A", Value: "192.0.2.2", Line: 2},
+			},
+		},
+		{
+			name:         "bad records are rejected",
+			zone:         "www.tesla.com. IN A 2001:db8::1\nrelative IN A 192.0.2.1\n$INCLUDE other.zone\nmail.tesla.com. IN MX 10\n",
+			wantRejected: []string{"line 1", "line 2", "line 3", "line 4"},
+		},
+		{
+			name:    "unbalanced parentheses",
+			zone:    "tesla.com. IN SOA ns1 hostmaster ( 1 2 3 4 5\n",
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, rejected, err := parseZone(strings.NewReader(test.zone), test.origin)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("parseZone() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseZone() = %+v, want %+v", got, test.want)
+			}
+			var items []string
+			for _, reject := range rejected {
+				items = append(items, reject.Item)
+			}
+			if !reflect.DeepEqual(items, test.wantRejected) {
+				t.Errorf("parseZone() rejected %+v, want %v", rejected, test.wantRejected)
+			}
+		})
+	}
+}
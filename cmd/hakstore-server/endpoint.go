@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// Endpoint is a structure to store a URL found by crawlers and archive sources. Endpoints are deduplicated on their
+// normalised URL and method, so the same page seen with different parameter values is stored once.
+type Endpoint struct {
+	gorm.Model
+	ID          int        `json:"id" gorm:"PrimaryKey;autoIncrement"`
+	URL         string     `json:"url" gorm:"uniqueIndex:idx_endpoints_url_method"`
+	Method      string     `json:"method" gorm:"uniqueIndex:idx_endpoints_url_method"`
+	Host        string     `json:"host" gorm:"index"`
+	SubdomainID string     `json:"subdomain" gorm:"index"`
+	ProgramID   string     `json:"program" gorm:"index"`
+	Path        string     `json:"path" gorm:"index"`
+	Parameters  StringList `json:"parameters"`
+	Sources     StringList `json:"sources"`
+	FirstSeen   time.Time  `json:"firstseen"`
+	LastSeen    time.Time  `json:"lastseen"`
+}
+
+// Get all endpoints. These can be filtered with ?program=, ?subdomain=, ?host=, ?path= (a path prefix) and
+// ?parameter=, e.g. ?program=tesla&parameter=redirect
+func getEndpoints(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	query := db
+	for _, filter := range []string{"program", "subdomain"} {
+		if value := r.URL.Query().Get(filter); value != "" {
+			query = query.Where(filter+"_id = ?", value)
+		}
+	}
+	if host := r.URL.Query().Get("host"); host != "" {
+		query = query.Where("host = ?", lookupHostname(host))
+	}
+	if prefix := r.URL.Query().Get("path"); prefix != "" {
+		query = query.Where("path LIKE ?", escapeLike(prefix)+"%")
+	}
+	if parameter := r.URL.Query().Get("parameter"); parameter != "" {
+		// parameters are stored as a JSON list, so look for the quoted name
+		quoted, _ := json.Marshal(parameter)
+		query = query.Where("parameters LIKE ?", "%"+escapeLike(string(quoted))+"%")
+	}
+	var endpoints []Endpoint
+	query.Order("url").Find(&endpoints)
+	json.NewEncoder(w).Encode(endpoints)
+}
+
+// escapeLike escapes the wildcards in a string so it can be used literally in a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// Get a specific endpoint
+func getEndpoint(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var endpoint Endpoint
+	vars := mux.Vars(r)
+	db.Where("ID = ?", vars["id"]).Find(&endpoint)
+	json.NewEncoder(w).Encode(&endpoint)
+}
+
+// Creates new endpoints, accepts batches. Endpoints that were already stored have their parameters and sources
+// merged in and their lastseen time bumped. Endpoints on hosts that aren't in scope are rejected individually.
+func createEndpoints(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var endpoints []Endpoint
+	_ = json.NewDecoder(r.Body).Decode(&endpoints)
+
+	// merge duplicates within the batch first so each endpoint is only written once
+	batch := []*Endpoint{}
+	index := make(map[string]*Endpoint)
+	positions := make(map[*Endpoint][]int)
+	rejected := []Reject{}
+	for i := range endpoints {
+		endpoint := endpoints[i]
+		raw := endpoint.URL
+		err := normaliseEndpoint(&endpoint)
+		if err != nil {
+			rejected = append(rejected, rejectAt(i, raw, err.Error()))
+			continue
+		}
+		key := endpoint.Method + " " + endpoint.URL
+		if existing, ok := index[key]; ok {
+			existing.Parameters = mergeStrings(existing.Parameters, endpoint.Parameters)
+			existing.Sources = mergeStrings(existing.Sources, endpoint.Sources)
+			positions[existing] = append(positions[existing], i)
+			continue
+		}
+		index[key] = &endpoint
+		positions[&endpoint] = []int{i}
+		batch = append(batch, &endpoint)
+	}
+
+	stored := []Endpoint{}
+	for _, endpoint := range batch {
+		err := linkEndpointHost(endpoint)
+		if err == nil {
+			_, err = saveEndpoint(endpoint)
+		}
+		if err != nil {
+			// merged duplicates are rejected at every position they were sent at
+			for _, i := range positions[endpoint] {
+				rejected = append(rejected, rejectAt(i, endpoint.URL, err.Error()))
+			}
+			continue
+		}
+		stored = append(stored, *endpoint)
+	}
+	writeBatch(w, r, stored, rejected)
+}
+
+// normaliseEndpoint normalises an endpoint's URL so that equivalent URLs are stored once. The scheme and host are
+// lowercased, default ports, fragments and parameter values are dropped and the parameter names are sorted. The
+// names are added to the endpoint's parameters, along with any given in the request body.
+func normaliseEndpoint(endpoint *Endpoint) error {
+	u, err := url.Parse(strings.TrimSpace(endpoint.URL))
+	if err != nil {
+		return fmt.Errorf("invalid url")
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url must be http or https")
+	}
+
+	hostname := u.Hostname()
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if addr, err := parseIP(strings.Trim(hostname, "[]")); err == nil {
+		hostname = addr.String()
+	} else {
+		var wildcard bool
+		hostname, wildcard, err = normaliseHostname(hostname)
+		if err != nil {
+			return err
+		}
+		if wildcard {
+			return fmt.Errorf("url can't have a wildcard host")
+		}
+	}
+	host := hostname
+	if strings.Contains(hostname, ":") {
+		host = "[" + hostname + "]"
+	}
+	if port != "" {
+		host = net.JoinHostPort(hostname, port)
+	}
+
+	p := u.EscapedPath()
+	if p == "" {
+		p = "/"
+	} else {
+		trailing := strings.HasSuffix(p, "/") && p != "/"
+		p = path.Clean(p)
+		if trailing {
+			p += "/"
+		}
+	}
+
+	var names []string
+	for name := range u.Query() {
+		names = append(names, name)
+	}
+	names = mergeStrings(nil, names)
+	query := ""
+	if len(names) > 0 {
+		escaped := make([]string, len(names))
+		for i, name := range names {
+			escaped[i] = url.QueryEscape(name)
+		}
+		query = "?" + strings.Join(escaped, "&")
+	}
+
+	endpoint.URL = u.Scheme + "://" + host + p + query
+	endpoint.Host = hostname
+	endpoint.Path = p
+	endpoint.Parameters = mergeStrings(names, endpoint.Parameters)
+	endpoint.Sources = mergeStrings(nil, endpoint.Sources)
+	endpoint.Method = strings.ToUpper(strings.TrimSpace(endpoint.Method))
+	if endpoint.Method == "" {
+		endpoint.Method = "GET"
+	}
+	return nil
+}
+
+// linkEndpointHost links an endpoint to the subdomain and program of its host. Hosts that fall under a rootdomain
+// but haven't been stored yet are added as subdomains.
+func linkEndpointHost(endpoint *Endpoint) error {
+	if _, err := parseIP(endpoint.Host); err == nil {
+		endpoint.ProgramID = ipProgram(endpoint.Host)
+		return nil
+	}
+
+	subdomain, err := findOrCreateSubdomain(endpoint.Host)
+	if err != nil {
+		return err
+	}
+	endpoint.SubdomainID = subdomain.ID
+	endpoint.ProgramID = subdomain.ProgramID
+	return nil
+}
+
+// saveEndpoint stores a normalised endpoint, or merges it into the stored one with the same URL and method. It
+// returns whether the endpoint was created.
+func saveEndpoint(endpoint *Endpoint) (bool, error) {
+	now := time.Now()
+	var existing Endpoint
+	err := db.Where("url = ? AND method = ?", endpoint.URL, endpoint.Method).First(&existing).Error
+	if err == nil {
+		existing.Parameters = mergeStrings(existing.Parameters, endpoint.Parameters)
+		existing.Sources = mergeStrings(existing.Sources, endpoint.Sources)
+		existing.SubdomainID = endpoint.SubdomainID
+		existing.ProgramID = endpoint.ProgramID
+		existing.LastSeen = now
+		err = db.Model(&existing).Select("parameters", "sources", "subdomain_id", "program_id", "last_seen").Updates(&existing).Error
+		*endpoint = existing
+		return false, err
+	}
+	endpoint.ID = 0
+	endpoint.FirstSeen = now
+	endpoint.LastSeen = now
+	return true, db.Create(endpoint).Error
+}
+
+// mergeStrings returns the sorted union of two lists, leaving out empty strings
+func mergeStrings(a []string, b []string) []string {
+	seen := make(map[string]bool)
+	merged := []string{}
+	for _, list := range [][]string{a, b} {
+		for _, s := range list {
+			s = strings.TrimSpace(s)
+			if s == "" || seen[s] {
+				continue
+			}
+			seen[s] = true
+			merged = append(merged, s)
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// Deletes an endpoint
+func deleteEndpoint(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	var endpoint Endpoint
+	db.Where("ID = ?", id).Find(&endpoint)
+	db.Unscoped().Delete(&endpoint)
+	var endpoints []Endpoint
+	db.Find(&endpoints)
+	json.NewEncoder(w).Encode(endpoints)
+}
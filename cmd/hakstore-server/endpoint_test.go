@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormaliseEndpoint(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint Endpoint
+		want     Endpoint
+		wantErr  bool
+	}{
+		{
+			name:     "default port, fragment and parameter values",
+			endpoint: Endpoint{URL: " HTTPS://WWW.Tesla.com:443/a/../search?q=1&b=2#top", Method: "post"},
+			want: Endpoint{
+				URL: "https://www.tesla.com/search?b&q", Host: "www.tesla.com", Path: "/search", Method: "POST",
+				Parameters: []string{"b", "q"}, Sources: []string{},
+			},
+		},
+		{
+			name:     "non-default port, trailing slash and body parameters",
+			endpoint: Endpoint{URL: "http://tesla.com:8080/api/", Parameters: []string{"token", ""}, Sources: []string{"burp", "burp"}},
+			want: Endpoint{
+				URL: "http://tesla.com:8080/api/", Host: "tesla.com", Path: "/api/", Method: "GET",
+				Parameters: []string{"token"}, Sources: []string{"burp"},
+			},
+		},
+		{
+			name:     "IPv6 host without a path",
+			endpoint: Endpoint{URL: "https://[2001:DB8::1]"},
+			want: Endpoint{
+				URL: "https://[2001:db8::1]/", Host: "2001:db8::1", Path: "/", Method: "GET",
+				Parameters: []string{}, Sources: []string{},
+			},
+		},
+		{
+			name:     "IPv6 host with a port",
+			endpoint: Endpoint{URL: "http://[2001:db8::1]:8080/"},
+			want: Endpoint{
+				URL: "http://[2001:db8::1]:8080/", Host: "2001:db8::1", Path: "/", Method: "GET",
+				Parameters: []string{}, Sources: []string{},
+			},
+		},
+		{
+			name:     "not http",
+			endpoint: Endpoint{URL: "ftp://tesla.com/"},
+			wantErr:  true,
+		},
+		{
+			name:     "wildcard host",
+			endpoint: Endpoint{URL: "https://*.tesla.com/"},
+			wantErr:  true,
+		},
+		{
+			name:     "invalid host",
+			endpoint: Endpoint{URL: "https://tesla/"},
+			wantErr:  true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			endpoint := test.endpoint
+			err := normaliseEndpoint(&endpoint)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("normaliseEndpoint() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(endpoint, test.want) {
+				t.Errorf("normaliseEndpoint() = %+v, want %+v", endpoint, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// GraphNode is an asset in the relationship graph. IDs are the asset type and the asset's own ID, e.g.
+// subdomain:www.tesla.com, so assets of different types can't collide.
+type GraphNode struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Label   string `json:"label"`
+	Program string `json:"program,omitempty"`
+}
+
+// GraphEdge is a relationship between two assets in the graph, e.g. a subdomain resolving to an IP
+type GraphEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Type   string `json:"type"`
+}
+
+// Graph is the response of /api/graph. Truncated is set when the node limit was hit before the depth limit.
+type Graph struct {
+	Nodes     []GraphNode `json:"nodes"`
+	Edges     []GraphEdge `json:"edges"`
+	Truncated bool        `json:"truncated"`
+}
+
+// The node types that can be used as a seed with ?seed=type:id
+var graphNodeTypes = []string{"program", "rootdomain", "subdomain", "ip", "cname", "nameserver", "vuln", "cloudasset"}
+
+// graphBuilder walks outwards from the seed assets, keeping track of what has been added so every node and edge is
+// only in the graph once
+type graphBuilder struct {
+	graph    Graph
+	nodes    map[string]bool
+	edges    map[string]bool
+	maxNodes int
+}
+
+// addNode adds a node if it isn't in the graph yet, it returns false if the node isn't in the graph because the
+// node limit has been reached
+func (g *graphBuilder) addNode(node GraphNode) bool {
+	if g.nodes[node.ID] {
+		return true
+	}
+	if len(g.graph.Nodes) >= g.maxNodes {
+		g.graph.Truncated = true
+		return false
+	}
+	g.nodes[node.ID] = true
+	g.graph.Nodes = append(g.graph.Nodes, node)
+	return true
+}
+
+// addEdge adds an edge if it isn't in the graph yet
+func (g *graphBuilder) addEdge(source string, target string, edgeType string) {
+	key := source + "|" + target + "|" + edgeType
+	if g.edges[key] {
+		return
+	}
+	g.edges[key] = true
+	g.graph.Edges = append(g.graph.Edges, GraphEdge{Source: source, Target: target, Type: edgeType})
+}
+
+// graphLink is a neighbour of a node, along with the edge joining them. Outgoing is false when the edge points from
+// the neighbour to the node.
+type graphLink struct {
+	Node     GraphNode
+	Type     string
+	Outgoing bool
+}
+
+// Builds a graph of how assets are connected, starting at a program (?program=) or any asset (?seed=type:id, e.g.
+// seed=ip:1.2.3.4) and following relationships up to ?depth= hops away (default 2, max 5). The graph stops growing
+// at ?limit= nodes (default 1000).
+func getGraph(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	depth := 2
+	if value := r.URL.Query().Get("depth"); value != "" {
+		var err error
+		depth, err = strconv.Atoi(value)
+		if err != nil || depth < 0 || depth > 5 {
+			writeError(w, http.StatusBadRequest, "depth must be a number from 0 to 5.")
+			return
+		}
+	}
+	limit := 1000
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive number.")
+			return
+		}
+	}
+
+	seed := r.URL.Query().Get("seed")
+	if program := r.URL.Query().Get("program"); program != "" {
+		seed = "program:" + program
+	}
+	if seed == "" {
+		writeError(w, http.StatusBadRequest, "A program or seed is required.")
+		return
+	}
+	node, err := graphSeed(seed)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	builder := graphBuilder{
+		graph:    Graph{Nodes: []GraphNode{}, Edges: []GraphEdge{}},
+		nodes:    make(map[string]bool),
+		edges:    make(map[string]bool),
+		maxNodes: limit,
+	}
+	builder.addNode(node)
+	frontier := []GraphNode{node}
+	expanded := make(map[string]bool)
+	for hop := 0; hop < depth && len(frontier) > 0; hop++ {
+		var next []GraphNode
+		for _, current := range frontier {
+			if expanded[current.ID] {
+				continue
+			}
+			expanded[current.ID] = true
+			for _, link := range graphNeighbours(current) {
+				known := builder.nodes[link.Node.ID]
+				if !builder.addNode(link.Node) {
+					continue
+				}
+				if link.Outgoing {
+					builder.addEdge(current.ID, link.Node.ID, link.Type)
+				} else {
+					builder.addEdge(link.Node.ID, current.ID, link.Type)
+				}
+				if !known {
+					next = append(next, link.Node)
+				}
+			}
+		}
+		frontier = next
+	}
+	json.NewEncoder(w).Encode(builder.graph)
+}
+
+// graphSeed looks up the asset a graph starts from, given as type:id
+func graphSeed(seed string) (GraphNode, error) {
+	parts := strings.SplitN(seed, ":", 2)
+	if len(parts) != 2 || parts[1] == "" || !contains(graphNodeTypes, parts[0]) {
+		return GraphNode{}, fmt.Errorf("seed must be type:id, where type is one of: %s", strings.Join(graphNodeTypes, ", "))
+	}
+	nodeType, id := parts[0], parts[1]
+	switch nodeType {
+	case "program":
+		var count int64
+		db.Model(&Program{}).Where("id = ?", id).Count(&count)
+		if count > 0 {
+			return programNode(id), nil
+		}
+	case "rootdomain":
+		id = lookupHostname(id)
+		var rootdomain RootDomain
+		if db.Where("id = ?", id).First(&rootdomain).Error == nil {
+			return rootDomainNode(rootdomain), nil
+		}
+	case "subdomain":
+		id = lookupHostname(id)
+		var subdomain Subdomain
+		if db.Where("id = ?", id).First(&subdomain).Error == nil {
+			return subdomainNode(subdomain), nil
+		}
+	case "ip":
+		var ip IP
+		if addr, err := parseIP(id); err == nil {
+			id = addr.String()
+		}
+		if db.Where("id = ?", id).First(&ip).Error == nil {
+			return ipNode(ip), nil
+		}
+	case "vuln":
+		var vuln Vuln
+		if db.Where("id = ?", id).First(&vuln).Error == nil {
+			return vulnNode(vuln), nil
+		}
+	case "cloudasset":
+		var asset CloudAsset
+		if db.Where("id = ?", id).First(&asset).Error == nil {
+			return cloudAssetNode(asset), nil
+		}
+	case "cname", "nameserver":
+		// these aren't stored as their own models, so any hostname is a valid seed
+		return GraphNode{ID: nodeType + ":" + graphHostname(id), Type: nodeType, Label: graphHostname(id)}, nil
+	}
+	return GraphNode{}, fmt.Errorf("%s %s not found", nodeType, id)
+}
+
+// graphHostname normalises the hostnames of CNAME targets and nameservers, which come back from DNS with a trailing dot
+func graphHostname(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
+
+func programNode(id string) GraphNode {
+	return GraphNode{ID: "program:" + id, Type: "program", Label: id, Program: id}
+}
+
+func rootDomainNode(rootdomain RootDomain) GraphNode {
+	return GraphNode{ID: "rootdomain:" + rootdomain.ID, Type: "rootdomain", Label: rootdomain.ID, Program: rootdomain.ProgramID}
+}
+
+func subdomainNode(subdomain Subdomain) GraphNode {
+	return GraphNode{ID: "subdomain:" + subdomain.ID, Type: "subdomain", Label: subdomain.ID, Program: subdomain.ProgramID}
+}
+
+func ipNode(ip IP) GraphNode {
+	return GraphNode{ID: "ip:" + ip.ID, Type: "ip", Label: ip.ID}
+}
+
+func vulnNode(vuln Vuln) GraphNode {
+	label := vuln.Title
+	if label == "" {
+		label = "Vuln " + strconv.Itoa(vuln.ID)
+	}
+	return GraphNode{ID: "vuln:" + strconv.Itoa(vuln.ID), Type: "vuln", Label: label, Program: vuln.ProgramID}
+}
+
+func cloudAssetNode(asset CloudAsset) GraphNode {
+	return GraphNode{ID: "cloudasset:" + strconv.Itoa(asset.ID), Type: "cloudasset", Label: asset.Provider + "/" + asset.Kind + "/" + asset.Identifier, Program: asset.ProgramID}
+}
+
+// cnameNode is the target of a CNAME. A target that is a subdomain we store is linked to that subdomain instead.
+func cnameNode(target string) GraphNode {
+	target = graphHostname(target)
+	var subdomain Subdomain
+	if db.Where("id = ?", target).First(&subdomain).Error == nil {
+		return subdomainNode(subdomain)
+	}
+	return GraphNode{ID: "cname:" + target, Type: "cname", Label: target}
+}
+
+func nameserverNode(name string) GraphNode {
+	name = graphHostname(name)
+	return GraphNode{ID: "nameserver:" + name, Type: "nameserver", Label: name}
+}
+
+// subdomainNameservers reads the nameservers of a subdomain, which are stored as the JSON of the DNS lookup
+func subdomainNameservers(subdomain Subdomain) []string {
+	var records []struct{ Host string }
+	json.Unmarshal([]byte(subdomain.Nameservers), &records)
+	var nameservers []string
+	for _, record := range records {
+		if record.Host != "" {
+			nameservers = append(nameservers, graphHostname(record.Host))
+		}
+	}
+	return nameservers
+}
+
+// graphNeighbours finds every asset directly connected to a node
+func graphNeighbours(node GraphNode) []graphLink {
+	var links []graphLink
+	id := strings.SplitN(node.ID, ":", 2)[1]
+	switch node.Type {
+	case "program":
+		var rootdomains []RootDomain
+		db.Where("program_id = ?", id).Find(&rootdomains)
+		for _, rootdomain := range rootdomains {
+			links = append(links, graphLink{Node: rootDomainNode(rootdomain), Type: "scope", Outgoing: true})
+		}
+		var assets []CloudAsset
+		db.Where("program_id = ?", id).Find(&assets)
+		for _, asset := range assets {
+			links = append(links, graphLink{Node: cloudAssetNode(asset), Type: "owns", Outgoing: true})
+		}
+		var ips []IP
+		db.Where("id IN (?)", db.Table("program_ips").Select("ip_id").Where("program_id = ?", id)).Find(&ips)
+		for _, ip := range ips {
+			links = append(links, graphLink{Node: ipNode(ip), Type: "scope", Outgoing: true})
+		}
+
+	case "rootdomain":
+		var rootdomain RootDomain
+		db.Where("id = ?", id).First(&rootdomain)
+		if rootdomain.ProgramID != "" {
+			links = append(links, graphLink{Node: programNode(rootdomain.ProgramID), Type: "scope"})
+		}
+		var subdomains []Subdomain
+		db.Where("root_domain_id = ?", id).Find(&subdomains)
+		for _, subdomain := range subdomains {
+			links = append(links, graphLink{Node: subdomainNode(subdomain), Type: "subdomain", Outgoing: true})
+		}
+		for _, nameserver := range rootdomain.Nameservers {
+			links = append(links, graphLink{Node: nameserverNode(nameserver), Type: "nameserver", Outgoing: true})
+		}
+
+	case "subdomain":
+		var subdomain Subdomain
+		db.Where("id = ?", id).Preload("IPs").First(&subdomain)
+		if subdomain.RootDomainID != "" {
+			var rootdomain RootDomain
+			if db.Where("id = ?", subdomain.RootDomainID).First(&rootdomain).Error == nil {
+				links = append(links, graphLink{Node: rootDomainNode(rootdomain), Type: "subdomain"})
+			}
+		}
+		for _, ip := range subdomain.IPs {
+			links = append(links, graphLink{Node: ipNode(*ip), Type: "resolves", Outgoing: true})
+		}
+		if graphHostname(subdomain.CNAME) != "" && graphHostname(subdomain.CNAME) != subdomain.ID {
+			links = append(links, graphLink{Node: cnameNode(subdomain.CNAME), Type: "cname", Outgoing: true})
+		}
+		for _, nameserver := range subdomainNameservers(subdomain) {
+			links = append(links, graphLink{Node: nameserverNode(nameserver), Type: "nameserver", Outgoing: true})
+		}
+		// subdomains that CNAME to this one
+		var aliases []Subdomain
+		db.Where("cname IN ?", []string{id, id + "."}).Find(&aliases)
+		for _, alias := range aliases {
+			links = append(links, graphLink{Node: subdomainNode(alias), Type: "cname"})
+		}
+		var vulns []Vuln
+		db.Joins("JOIN subdomain_vulns ON subdomain_vulns.vuln_id = vulns.id").Where("subdomain_vulns.subdomain_id = ?", id).Find(&vulns)
+		for _, vuln := range vulns {
+			links = append(links, graphLink{Node: vulnNode(vuln), Type: "affects"})
+		}
+
+	case "ip":
+		var ip IP
+		db.Where("id = ?", id).Preload("Subdomains").Preload("Programs").First(&ip)
+		for _, subdomain := range ip.Subdomains {
+			links = append(links, graphLink{Node: subdomainNode(*subdomain), Type: "resolves"})
+		}
+		for _, program := range ip.Programs {
+			links = append(links, graphLink{Node: programNode(program.ID), Type: "scope"})
+		}
+		var vulns []Vuln
+		db.Joins("JOIN ip_vulns ON ip_vulns.vuln_id = vulns.id").Where("ip_vulns.ip_id = ?", id).Find(&vulns)
+		for _, vuln := range vulns {
+			links = append(links, graphLink{Node: vulnNode(vuln), Type: "affects"})
+		}
+
+	case "cname":
+		var subdomains []Subdomain
+		db.Where("cname IN ?", []string{id, id + "."}).Find(&subdomains)
+		for _, subdomain := range subdomains {
+			links = append(links, graphLink{Node: subdomainNode(subdomain), Type: "cname"})
+		}
+
+	case "nameserver":
+		var subdomains []Subdomain
+		db.Where("nameservers LIKE ? OR nameservers LIKE ?", "%\"Host\":\""+escapeLike(id)+".\"%", "%\"Host\":\""+escapeLike(id)+"\"%").Find(&subdomains)
+		for _, subdomain := range subdomains {
+			links = append(links, graphLink{Node: subdomainNode(subdomain), Type: "nameserver"})
+		}
+		var rootdomains []RootDomain
+		db.Where("nameservers LIKE ?", "%\""+escapeLike(id)+"\"%").Find(&rootdomains)
+		for _, rootdomain := range rootdomains {
+			links = append(links, graphLink{Node: rootDomainNode(rootdomain), Type: "nameserver"})
+		}
+
+	case "vuln":
+		var vuln Vuln
+		db.Where("id = ?", id).Preload("Subdomains").Preload("IPs").Preload("CloudAssets").First(&vuln)
+		for _, subdomain := range vuln.Subdomains {
+			links = append(links, graphLink{Node: subdomainNode(*subdomain), Type: "affects", Outgoing: true})
+		}
+		for _, ip := range vuln.IPs {
+			links = append(links, graphLink{Node: ipNode(*ip), Type: "affects", Outgoing: true})
+		}
+		for _, asset := range vuln.CloudAssets {
+			links = append(links, graphLink{Node: cloudAssetNode(*asset), Type: "affects", Outgoing: true})
+		}
+
+	case "cloudasset":
+		var asset CloudAsset
+		db.Where("id = ?", id).Preload("Vulns").First(&asset)
+		if asset.ProgramID != "" {
+			links = append(links, graphLink{Node: programNode(asset.ProgramID), Type: "owns"})
+		}
+		for _, vuln := range asset.Vulns {
+			links = append(links, graphLink{Node: vulnNode(*vuln), Type: "affects"})
+		}
+	}
+	return links
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// hostnameProfile maps internationalised names to punycode. Label rules are checked by validateHostname instead of
+// idna's strict mode, because underscores (e.g. _dmarc.example.com) are common in real DNS data.
+var hostnameProfile = idna.New(idna.MapForLookup(), idna.StrictDomainName(false), idna.Transitional(false))
+
+// normaliseHostname turns a hostname from user or tool input into the form it is stored in: trimmed, lowercase,
+// without a trailing dot and in punycode. A leading "*." is stripped and reported through the wildcard return value.
+func normaliseHostname(name string) (host string, wildcard bool, err error) {
+	host = strings.ToLower(strings.TrimSpace(name))
+	host = strings.TrimSuffix(host, ".")
+	if strings.HasPrefix(host, "*.") {
+		wildcard = true
+		host = strings.TrimPrefix(host, "*.")
+	}
+	if host == "" {
+		return "", false, fmt.Errorf("hostname is empty")
+	}
+
+	host, err = hostnameProfile.ToASCII(host)
+	if err != nil {
+		return "", false, fmt.Errorf("%q is not a valid hostname: %v", name, err)
+	}
+	err = validateHostname(host)
+	if err != nil {
+		return "", false, fmt.Errorf("%q is not a valid hostname: %v", name, err)
+	}
+	return host, wildcard, nil
+}
+
+// validateHostname checks an already normalised hostname against the usual DNS hostname rules
+func validateHostname(host string) error {
+	if len(host) > 253 {
+		return fmt.Errorf("longer than 253 characters")
+	}
+	labels := strings.Split(host, ".")
+	if len(labels) < 2 {
+		return fmt.Errorf("needs at least two labels")
+	}
+	for _, label := range labels {
+		if len(label) == 0 {
+			return fmt.Errorf("contains an empty label")
+		}
+		if len(label) > 63 {
+			return fmt.Errorf("label %q is longer than 63 characters", label)
+		}
+		if strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return fmt.Errorf("label %q starts or ends with a hyphen", label)
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return fmt.Errorf("label %q contains the invalid character %q", label, c)
+			}
+		}
+	}
+	if strings.Trim(labels[len(labels)-1], "0123456789") == "" {
+		return fmt.Errorf("top level domain is numeric, is this an IP address?")
+	}
+	return nil
+}
+
+// isUnderDomain checks whether host is the same as domain or one of its subdomains. Both must be normalised.
+func isUnderDomain(host string, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestNormaliseHostname(t *testing.T) {
+	tests := []struct {
+		name         string
+		want         string
+		wantWildcard bool
+		wantErr      bool
+	}{
+		{name: " WWW.Tesla.com. ", want: "www.tesla.com"},
+		{name: "*.tesla.com", want: "tesla.com", wantWildcard: true},
+		{name: "_dmarc.tesla.com", want: "_dmarc.tesla.com"},
+		{name: "bücher.example", want: "xn--bcher-kva.example"},
+		{name: "", wantErr: true},
+		{name: "localhost", wantErr: true},
+		{name: "192.0.2.1", wantErr: true},
+		{name: "www..tesla.com", wantErr: true},
+		{name: "-www.tesla.com", wantErr: true},
+		{name: "www.tesla.com/path", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, wildcard, err := normaliseHostname(test.name)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("normaliseHostname(%q) error = %v, wantErr %v", test.name, err, test.wantErr)
+			}
+			if got != test.want || wildcard != test.wantWildcard {
+				t.Errorf("normaliseHostname(%q) = %q, %v, want %q, %v", test.name, got, wildcard, test.want, test.wantWildcard)
+			}
+		})
+	}
+}
+
+func TestIsUnderDomain(t *testing.T) {
+	tests := []struct {
+		host   string
+		domain string
+		want   bool
+	}{
+		{host: "tesla.com", domain: "tesla.com", want: true},
+		{host: "www.tesla.com", domain: "tesla.com", want: true},
+		{host: "notesla.com", domain: "tesla.com"},
+		{host: "tesla.com", domain: "www.tesla.com"},
+	}
+	for _, test := range tests {
+		if got := isUnderDomain(test.host, test.domain); got != test.want {
+			t.Errorf("isUnderDomain(%q, %q) = %v, want %v", test.host, test.domain, got, test.want)
+		}
+	}
+}
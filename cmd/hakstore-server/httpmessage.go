@@ -1,7 +1,51 @@
 package main
 
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
 // Message is a structure to use for success/error json response messages
 type Message struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
 }
+
+// Reject describes an item from a batch request that was not stored, and why. Index is the item's position in the
+// batch that was sent, so it can be matched up even when the item was normalised.
+type Reject struct {
+	Index  *int   `json:"index,omitempty"`
+	Item   string `json:"item"`
+	Reason string `json:"reason"`
+}
+
+// rejectAt rejects the item at index in a batch request
+func rejectAt(index int, item string, reason string) Reject {
+	return Reject{Index: &index, Item: item, Reason: reason}
+}
+
+// BatchResponse is returned by endpoints that accept batches when they are called with ?verbose=true, it holds the
+// stored items and any rejected ones
+type BatchResponse struct {
+	Items    interface{} `json:"items"`
+	Rejected []Reject    `json:"rejected"`
+}
+
+// writeError responds with an unsuccessful Message and the given status code
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Message{Success: false, Message: message})
+}
+
+// writeBatch responds to a batch request. The stored items are returned as a JSON array, which is what the batch
+// endpoints have always returned, with the number of rejected items in the X-Rejected-Count header. Clients that want
+// to know why items were rejected ask for a BatchResponse with ?verbose=true.
+func writeBatch(w http.ResponseWriter, r *http.Request, items interface{}, rejected []Reject) {
+	w.Header().Set("X-Rejected-Count", strconv.Itoa(len(rejected)))
+	if r.URL.Query().Get("verbose") == "true" {
+		json.NewEncoder(w).Encode(BatchResponse{Items: items, Rejected: rejected})
+		return
+	}
+	json.NewEncoder(w).Encode(items)
+}
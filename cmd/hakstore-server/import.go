@@ -0,0 +1,453 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// The outcomes of importing a single item
+const (
+	ImportCreated = "created"
+	ImportUpdated = "updated"
+	ImportSkipped = "skipped"
+)
+
+// ImportCount is how many items of one kind an import created, updated and skipped
+type ImportCount struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Skipped int `json:"skipped"`
+}
+
+// ImportSummary is the response of the import endpoints. Counts are keyed by the kind of item, e.g. subdomains.
+// Skipped items are valid but weren't stored, e.g. because they are out of scope, while rejected items are invalid.
+// In a dry run the counts are what would have been stored. Scope imports also list the changes to each program's
+// scope.
+type ImportSummary struct {
+	Counts   map[string]*ImportCount `json:"counts"`
+	Skipped  []Reject                `json:"skipped"`
+	Rejected []Reject                `json:"rejected"`
+	Changes  []ScopeChange           `json:"changes,omitempty"`
+	DryRun   bool                    `json:"dryrun"`
+	// ips are the IPs imported so far, their programs are worked out once for the whole import by syncIPs
+	ips []string
+}
+
+func newImportSummary() ImportSummary {
+	return ImportSummary{Counts: make(map[string]*ImportCount), Skipped: []Reject{}, Rejected: []Reject{}}
+}
+
+// record counts the outcome of importing an item of a kind
+func (s *ImportSummary) record(kind string, outcome string) {
+	count, ok := s.Counts[kind]
+	if !ok {
+		count = &ImportCount{}
+		s.Counts[kind] = count
+	}
+	switch outcome {
+	case ImportCreated:
+		count.Created++
+	case ImportUpdated:
+		count.Updated++
+	case ImportSkipped:
+		count.Skipped++
+	}
+}
+
+// syncIPs works out the programs of the IPs imported so far, importers call it once they have stored everything
+func (s *ImportSummary) syncIPs() {
+	syncIPPrograms(s.ips...)
+	s.ips = nil
+}
+
+// skip counts an item as skipped and records why
+func (s *ImportSummary) skip(kind string, item string, reason string) {
+	s.record(kind, ImportSkipped)
+	s.Skipped = append(s.Skipped, Reject{Item: item, Reason: reason})
+}
+
+// importProgram checks the ?program= of an import request, which limits the import to that program's scope
+func importProgram(r *http.Request) (string, error) {
+	program := r.URL.Query().Get("program")
+	if program == "" {
+		return "", nil
+	}
+	var count int64
+	db.Model(&Program{}).Where("id = ?", program).Count(&count)
+	if count == 0 {
+		return "", fmt.Errorf("Program %q does not exist.", program)
+	}
+	return program, nil
+}
+
+// importSubdomain stores a subdomain found by a tool, or marks an existing one as seen again, and adds the sources
+// to it. Subdomains that don't fall under a stored rootdomain, fall under one outside the program being imported
+// into, or are excluded by the program's out of scope targets, are skipped with the reason returned.
+func importSubdomain(name string, sources []string, program string) (Subdomain, string, string, error) {
+	var subdomain Subdomain
+	name, _, err := normaliseHostname(name)
+	if err != nil {
+		return subdomain, "", "", err
+	}
+
+	err = db.Where("id = ?", name).First(&subdomain).Error
+	if err == nil {
+		if program != "" && subdomain.ProgramID != program {
+			return subdomain, ImportSkipped, "in program " + subdomain.ProgramID, nil
+		}
+		subdomain.Sources = mergeStrings(subdomain.Sources, sources)
+		subdomain.LastSeen = time.Now()
+		subdomain.Stale = false
+		err = db.Model(&subdomain).Select("sources", "last_seen", "stale").Updates(&subdomain).Error
+		return subdomain, ImportUpdated, "", err
+	}
+
+	subdomain = Subdomain{ID: name, Sources: mergeStrings(nil, sources)}
+	err = normaliseSubdomain(&subdomain)
+	if err != nil {
+		return subdomain, ImportSkipped, err.Error(), nil
+	}
+	var rootdomain RootDomain
+	db.Where("id = ?", subdomain.RootDomainID).First(&rootdomain)
+	if program != "" && rootdomain.ProgramID != program {
+		return subdomain, ImportSkipped, "rootdomain " + rootdomain.ID + " is in program " + rootdomain.ProgramID, nil
+	}
+	if target, excluded := outOfScope(rootdomain.ProgramID, subdomain.ID); excluded {
+		return subdomain, ImportSkipped, target.Target + " is out of scope", nil
+	}
+	err = db.Create(&subdomain).Error
+	return subdomain, ImportCreated, "", err
+}
+
+// importIP stores an IP found by a tool and associates it with a subdomain, the same way associateIPWithSubdomain
+// does. The ASN is only overwritten when the tool knows it. The IP's programs are updated by summary.syncIPs.
+func importIP(summary *ImportSummary, address string, asn int, asnName string, subdomain Subdomain) (IP, string, error) {
+	var ip IP
+	addr, err := parseIP(address)
+	if err != nil {
+		return ip, "", err
+	}
+	outcome := ImportUpdated
+	err = db.Where("id = ?", addr.String()).First(&ip).Error
+	if err != nil {
+		ip = IP{ID: addr.String(), ASN: asn, ASNName: asnName}
+		err = db.Create(&ip).Error
+		if err != nil {
+			return ip, "", err
+		}
+		outcome = ImportCreated
+	} else if asn != 0 && (ip.ASN != asn || ip.ASNName != asnName) {
+		ip.ASN = asn
+		ip.ASNName = asnName
+		db.Model(&ip).Select("ASN", "ASNName").Updates(&ip)
+	}
+	db.Model(&subdomain).Association("IPs").Append([]IP{ip})
+	summary.ips = append(summary.ips, ip.ID)
+	return ip, outcome, nil
+}
+
+// importVulnHost links a vuln found by a tool to the IP or subdomain it was found on, storing the subdomain and the
+// IP it resolved to when the tool knows it. Hosts outside the program being imported into are skipped, and false is
+// returned when the vuln shouldn't be stored.
+func importVulnHost(summary *ImportSummary, vuln *Vuln, host string, ip string, source string, program string, item string) bool {
+	if addr, err := parseIP(host); err == nil {
+		if program != "" {
+			var count int64
+			db.Table("program_ips").Where("ip_id = ? AND program_id = ?", addr.String(), program).Count(&count)
+			if count == 0 {
+				summary.skip("vulns", item, "IP "+addr.String()+" isn't in program "+program)
+				return false
+			}
+		}
+		vuln.IPs = []*IP{{ID: addr.String()}}
+		vuln.ProgramID = program
+		return true
+	}
+	subdomain, outcome, reason, err := importSubdomain(host, []string{source}, program)
+	if err != nil {
+		summary.Rejected = append(summary.Rejected, Reject{Item: item, Reason: err.Error()})
+		return false
+	}
+	if outcome == ImportSkipped {
+		summary.skip("vulns", item, subdomain.ID+" skipped: "+reason)
+		return false
+	}
+	summary.record("subdomains", outcome)
+	if ip != "" {
+		if _, outcome, err := importIP(summary, ip, 0, "", subdomain); err == nil {
+			summary.record("ips", outcome)
+		}
+	}
+	vuln.Subdomains = []*Subdomain{{ID: subdomain.ID}}
+	vuln.ProgramID = subdomain.ProgramID
+	return true
+}
+
+// amassRecord is a line of amass' JSON output. Older versions of amass use source instead of sources.
+type amassRecord struct {
+	Name      string   `json:"name"`
+	Domain    string   `json:"domain"`
+	Source    string   `json:"source"`
+	Sources   []string `json:"sources"`
+	Addresses []struct {
+		IP   string `json:"ip"`
+		CIDR string `json:"cidr"`
+		ASN  int    `json:"asn"`
+		Desc string `json:"desc"`
+	} `json:"addresses"`
+}
+
+// Imports the output of amass enum -json, one JSON object per line. Names become subdomains under the rootdomain
+// they fall under and their addresses become IPs associated with them. The sources amass found each name with are
+// recorded as amass:<source>. With ?program= only names in that program's scope are imported.
+func importAmass(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	program, err := importProgram(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	summary := newImportSummary()
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var record amassRecord
+		err := json.Unmarshal([]byte(text), &record)
+		if err != nil {
+			summary.Rejected = append(summary.Rejected, Reject{Item: fmt.Sprintf("line %d", line), Reason: err.Error()})
+			continue
+		}
+
+		sources := []string{}
+		for _, source := range append(record.Sources, record.Source) {
+			if source = strings.ToLower(strings.TrimSpace(source)); source != "" {
+				sources = append(sources, "amass:"+source)
+			}
+		}
+		if len(sources) == 0 {
+			sources = append(sources, "amass")
+		}
+
+		subdomain, outcome, reason, err := importSubdomain(record.Name, sources, program)
+		if err != nil {
+			summary.Rejected = append(summary.Rejected, Reject{Item: record.Name, Reason: err.Error()})
+			continue
+		}
+		if outcome == ImportSkipped {
+			summary.skip("subdomains", subdomain.ID, reason)
+			for range record.Addresses {
+				summary.record("ips", ImportSkipped)
+			}
+			continue
+		}
+		summary.record("subdomains", outcome)
+
+		for _, address := range record.Addresses {
+			_, outcome, err := importIP(&summary, address.IP, address.ASN, address.Desc, subdomain)
+			if err != nil {
+				summary.Rejected = append(summary.Rejected, Reject{Item: address.IP, Reason: err.Error()})
+				continue
+			}
+			summary.record("ips", outcome)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		summary.Rejected = append(summary.Rejected, Reject{Item: fmt.Sprintf("line %d", line+1), Reason: err.Error()})
+	}
+	summary.syncIPs()
+	json.NewEncoder(w).Encode(summary)
+}
+
+// nucleiResult is a line of nuclei's JSONL output. Older versions of nuclei use templateID and matched instead of
+// template-id and matched-at.
+type nucleiResult struct {
+	TemplateID    string `json:"template-id"`
+	OldTemplateID string `json:"templateID"`
+	Info          struct {
+		Name           string      `json:"name"`
+		Severity       string      `json:"severity"`
+		Description    string      `json:"description"`
+		Reference      interface{} `json:"reference"`
+		Classification struct {
+			CVEIDs      interface{} `json:"cve-id"`
+			CWEIDs      interface{} `json:"cwe-id"`
+			CVSSMetrics string      `json:"cvss-metrics"`
+		} `json:"classification"`
+	} `json:"info"`
+	MatcherName      string   `json:"matcher-name"`
+	Host             string   `json:"host"`
+	IP               string   `json:"ip"`
+	MatchedAt        string   `json:"matched-at"`
+	OldMatched       string   `json:"matched"`
+	ExtractedResults []string `json:"extracted-results"`
+	Request          string   `json:"request"`
+	Response         string   `json:"response"`
+	CurlCommand      string   `json:"curl-command"`
+}
+
+// stringOrList reads a field that nuclei writes as either a string or a list of strings
+func stringOrList(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return mergeStrings(nil, strings.Split(v, ","))
+	case []interface{}:
+		var list []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return mergeStrings(nil, list)
+	}
+	return nil
+}
+
+// importHostname pulls the hostname or IP out of the host field of a scanner result, which can be a URL, host:port
+// or a bare hostname
+func importHostname(host string) string {
+	host = strings.TrimSpace(host)
+	if strings.Contains(host, "://") {
+		u, err := url.Parse(host)
+		if err == nil {
+			return u.Hostname()
+		}
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return strings.Trim(host, "[]")
+}
+
+// nucleiVuln turns a nuclei result into a vuln. The check ID is the template ID, with the matcher name when there
+// is one, so different matchers of a template on the same URL stay separate findings.
+func nucleiVuln(result nucleiResult) Vuln {
+	checkID := result.TemplateID
+	if checkID == "" {
+		checkID = result.OldTemplateID
+	}
+	if result.MatcherName != "" {
+		checkID = checkID + ":" + result.MatcherName
+	}
+	matchedAt := result.MatchedAt
+	if matchedAt == "" {
+		matchedAt = result.OldMatched
+	}
+
+	severity := severityFromString(result.Info.Severity)
+	if severity == 0 {
+		severity = 5
+	}
+	description := result.Info.Description
+	if len(result.ExtractedResults) > 0 {
+		if description != "" {
+			description = description + "\n\n"
+		}
+		description = description + "Extracted results: " + strings.Join(result.ExtractedResults, ", ")
+	}
+	title := result.Info.Name
+	if title == "" {
+		title = checkID
+	}
+
+	vuln := Vuln{
+		Title:       title,
+		Description: description,
+		Severity:    severity,
+		CheckID:     checkID,
+		MatchedAt:   matchedAt,
+		CVEs:        StringList(stringOrList(result.Info.Classification.CVEIDs)),
+		References:  StringList(stringOrList(result.Info.Reference)),
+		Request:     result.Request,
+		Response:    result.Response,
+		PoC:         result.CurlCommand,
+	}
+	for i, cve := range vuln.CVEs {
+		vuln.CVEs[i] = strings.ToUpper(cve)
+	}
+	if cwes := stringOrList(result.Info.Classification.CWEIDs); len(cwes) > 0 {
+		vuln.CWE = strings.ToUpper(cwes[0])
+	}
+	// a vector the CVSS calculator can't read would get the whole finding rejected, so it is left out instead
+	if _, err := cvssBaseScore(result.Info.Classification.CVSSMetrics); err == nil {
+		vuln.CVSSVector = result.Info.Classification.CVSSMetrics
+	}
+	if strings.HasPrefix(matchedAt, "http://") || strings.HasPrefix(matchedAt, "https://") {
+		vuln.URL = matchedAt
+	}
+	return vuln
+}
+
+// Imports the output of nuclei -jsonl, one result per line. Each result becomes a vuln linked to the subdomain or IP
+// it was found on, and results that were already imported are bumped instead of stored again. With ?program= only
+// hosts in that program's scope are imported, and ?notify=false turns off the Slack notifications for new vulns,
+// e.g. when backfilling old scans.
+func importNuclei(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	program, err := importProgram(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	notify := r.URL.Query().Get("notify") != "false"
+
+	summary := newImportSummary()
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var result nucleiResult
+		err := json.Unmarshal([]byte(text), &result)
+		if err != nil {
+			summary.Rejected = append(summary.Rejected, Reject{Item: fmt.Sprintf("line %d", line), Reason: err.Error()})
+			continue
+		}
+		vuln := nucleiVuln(result)
+		if vuln.CheckID == "" {
+			summary.Rejected = append(summary.Rejected, Reject{Item: fmt.Sprintf("line %d", line), Reason: "result has no template ID"})
+			continue
+		}
+		item := vuln.CheckID + " " + vuln.MatchedAt
+
+		host := importHostname(result.Host)
+		if host == "" {
+			host = importHostname(vuln.MatchedAt)
+		}
+		if !importVulnHost(&summary, &vuln, host, result.IP, "nuclei", program, item) {
+			continue
+		}
+
+		created, err := storeVuln(&vuln, notify)
+		if err != nil {
+			summary.Rejected = append(summary.Rejected, Reject{Item: item, Reason: err.Error()})
+			continue
+		}
+		if created {
+			summary.record("vulns", ImportCreated)
+		} else {
+			summary.record("vulns", ImportUpdated)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		summary.Rejected = append(summary.Rejected, Reject{Item: fmt.Sprintf("line %d", line+1), Reason: err.Error()})
+	}
+	summary.syncIPs()
+	json.NewEncoder(w).Encode(summary)
+}
@@ -2,26 +2,114 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
+	"net/netip"
+	"strings"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/gorilla/mux"
 )
 
-// IP is a structure to store details about ip addresses
+// IP is a structure to store details about ip addresses. An address can be shared by several programs, e.g. a CDN
+// edge, so its programs aren't set directly but worked out from the subdomains resolving to it and the IP ranges of
+// each program (see syncIPPrograms).
 type IP struct {
 	gorm.Model
 	ID         string       `json:"id" gorm:"PrimaryKey"`
+	Version    int          `json:"version"`
 	Subdomains []*Subdomain `json:"subdomains" gorm:"many2many:subdomain_ips;"`
-	ProgramID  string       `json:"program"`
+	Programs   []*Program   `json:"programs" gorm:"many2many:program_ips;"`
+	ASN        int          `json:"asn"`
+	ASNName    string       `json:"asnname"`
+	Ports      []Port       `json:"ports,omitempty"`
+	// ProgramID is only read when creating IPs, the address is added to that program directly (see linkIPProgram)
+	ProgramID string `json:"program,omitempty" gorm:"-"`
 }
 
-// Get all IPs
+// BeforeSave makes sure the address is always stored in canonical form, along with its version
+func (ip *IP) BeforeSave(tx *gorm.DB) (err error) {
+	addr, err := parseIP(ip.ID)
+	if err != nil {
+		return err
+	}
+	ip.ID = addr.String()
+	ip.Version = ipVersion(addr)
+	return nil
+}
+
+// parseIP parses an IP address from user input. Surrounding whitespace and leading zeros in IPv4 octets are ignored
+// and IPv4-mapped IPv6 addresses are unmapped, so every way of writing an address ends up with the same String().
+func parseIP(s string) (netip.Addr, error) {
+	trimmed := strings.TrimSpace(s)
+	if trimmed == "" {
+		return netip.Addr{}, fmt.Errorf("IP address is empty")
+	}
+	addr, err := netip.ParseAddr(stripLeadingZeros(trimmed))
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("%q is not a valid IP address", s)
+	}
+	if addr.Zone() != "" {
+		return netip.Addr{}, fmt.Errorf("%q has an IPv6 zone, which can't be stored", s)
+	}
+	return addr.Unmap(), nil
+}
+
+// stripLeadingZeros turns dotted quads like 010.000.0.01 into 10.0.0.1, which netip refuses to parse otherwise
+func stripLeadingZeros(s string) string {
+	if strings.Contains(s, ":") {
+		return s
+	}
+	octets := strings.Split(s, ".")
+	if len(octets) != 4 {
+		return s
+	}
+	for i, octet := range octets {
+		trimmed := strings.TrimLeft(octet, "0")
+		if trimmed == "" && octet != "" {
+			trimmed = "0"
+		}
+		octets[i] = trimmed
+	}
+	return strings.Join(octets, ".")
+}
+
+// ipVersion returns 4 or 6 depending on the address family
+func ipVersion(addr netip.Addr) int {
+	if addr.Is4() {
+		return 4
+	}
+	return 6
+}
+
+// Get all IPs. These can be filtered to a CIDR range with ?cidr=10.0.0.0/8, to an address family with ?version=6 or
+// to a program with ?program=
 func getIPs(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
+	query := db
+	if program := r.URL.Query().Get("program"); program != "" {
+		query = query.Where("id IN (?)", db.Table("program_ips").Select("ip_id").Where("program_id = ?", program))
+	}
+	if version := r.URL.Query().Get("version"); version != "" {
+		if version != "4" && version != "6" {
+			writeError(w, http.StatusBadRequest, "IP version must be 4 or 6.")
+			return
+		}
+		query = query.Where("version = ?", version)
+	}
+	if cidr := r.URL.Query().Get("cidr"); cidr != "" {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("%q is not a valid CIDR range.", cidr))
+			return
+		}
+		query = query.Where("CAST(id AS inet) <<= CAST(? AS cidr)", prefix.Masked().String())
+	}
 	var ips []IP
-	db.Find(&ips)
+	query.Find(&ips)
 	json.NewEncoder(w).Encode(ips)
 }
 
@@ -30,17 +118,94 @@ func getIP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var ip IP
 	vars := mux.Vars(r)
-	db.Where("ID = ?", vars["id"]).Find(&ip)
+	id := vars["id"]
+	if addr, err := parseIP(id); err == nil {
+		id = addr.String()
+	}
+	db.Where("ID = ?", id).Preload("Programs").Preload("Ports").Find(&ip)
 	json.NewEncoder(w).Encode(&ip)
 }
 
-// Creates new ips, accepts batches
+// Gets the subdomains that resolve to an IP, each with its program, to see who else is on a shared address
+func getIPSubdomains(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	vars := mux.Vars(r)
+	id := vars["id"]
+	if addr, err := parseIP(id); err == nil {
+		id = addr.String()
+	}
+	subdomains := []Subdomain{}
+	db.Where("id IN (?)", db.Table("subdomain_ips").Select("subdomain_id").Where("ip_id = ?", id)).Order("program_id, id").Find(&subdomains)
+	json.NewEncoder(w).Encode(subdomains)
+}
+
+// Creates new ips, accepts batches. Invalid addresses are rejected individually and the rest are still stored. An IP
+// sent with a program is added to that program directly, as programs are otherwise worked out from subdomains and IP
+// ranges, unless the program lists the address as out of scope.
+// The IPs are returned as they are stored, so addresses that already existed come back with their stored details
+// rather than what was sent.
 func createIPs(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var ips []IP
 	_ = json.NewDecoder(r.Body).Decode(&ips)
-	db.Create(&ips)
-	json.NewEncoder(w).Encode(ips)
+
+	stored := []IP{}
+	rejected := []Reject{}
+	seen := make(map[string]bool)
+	programs := make(map[string]bool)
+	links := make(map[string]string)
+	for i, ip := range ips {
+		addr, err := parseIP(ip.ID)
+		if err != nil {
+			rejected = append(rejected, rejectAt(i, ip.ID, err.Error()))
+			continue
+		}
+		ip.ID = addr.String()
+		if seen[ip.ID] {
+			continue
+		}
+		if ip.ProgramID != "" {
+			if _, checked := programs[ip.ProgramID]; !checked {
+				var count int64
+				db.Model(&Program{}).Where("id = ?", ip.ProgramID).Count(&count)
+				programs[ip.ProgramID] = count > 0
+			}
+			if !programs[ip.ProgramID] {
+				rejected = append(rejected, rejectAt(i, ip.ID, fmt.Sprintf("program %s does not exist", ip.ProgramID)))
+				continue
+			}
+			if target, excluded := outOfScope(ip.ProgramID, ip.ID); excluded {
+				rejected = append(rejected, rejectAt(i, ip.ID, target.Target+" is out of scope"))
+				continue
+			}
+			links[ip.ID] = ip.ProgramID
+		}
+		seen[ip.ID] = true
+		ip.ProgramID = ""
+		stored = append(stored, ip)
+	}
+	var ids []string
+	for _, ip := range stored {
+		ids = append(ids, ip.ID)
+	}
+	if len(stored) > 0 {
+		err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&stored).Error
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Could not store the IPs: "+err.Error())
+			return
+		}
+		for id, program := range links {
+			err = linkIPProgram(id, program)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "Could not add IP "+id+" to program "+program+": "+err.Error())
+				return
+			}
+		}
+		syncIPPrograms(ids...)
+		stored = []IP{}
+		db.Where("id IN ?", ids).Find(&stored)
+	}
+	writeBatch(w, r, stored, rejected)
 }
 
 // Updates a ip
@@ -52,6 +217,9 @@ func updateIP(w http.ResponseWriter, r *http.Request) {
 func deleteIP(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
+	if addr, err := parseIP(id); err == nil {
+		id = addr.String()
+	}
 	var ip IP
 	db.Where("ID = ?", id).Find(&ip)
 	deleteIPLocal(ip)
@@ -60,7 +228,111 @@ func deleteIP(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(ips)
 }
 
+// ipProgram is the program of a stored IP when it belongs to just the one, a shared IP doesn't say which program
+// something found on it is in
+func ipProgram(id string) string {
+	var programs []string
+	db.Table("program_ips").Where("ip_id = ?", id).Pluck("program_id", &programs)
+	if len(programs) == 1 {
+		return programs[0]
+	}
+	return ""
+}
+
 func deleteIPLocal(ip IP) {
 	db.Model(&ip).Association("Subdomains").Clear()
+	db.Model(&ip).Association("Programs").Clear()
+	db.Unscoped().Where("ip_id = ?", ip.ID).Delete(&Port{})
+	db.Unscoped().Where("ip_id = ?", ip.ID).Delete(&CertificateBinding{})
 	db.Unscoped().Delete(&ip)
 }
+
+// canonicaliseStoredIPs is a one-off migration for IPs that were stored before addresses were canonicalised. Each
+// row is renamed to its canonical form, and rows that turn out to be the same address are merged along with their
+// subdomain, vuln and program associations. Rows that couldn't be merged make it return an error, so the migration
+// is tried again on the next start.
+func canonicaliseStoredIPs() error {
+	var ips []IP
+	err := db.Unscoped().Find(&ips).Error
+	if err != nil {
+		return err
+	}
+	ids := make([]string, len(ips))
+	for i, ip := range ips {
+		ids[i] = ip.ID
+	}
+	renames, invalid := storedIPRenames(ids)
+	for _, id := range invalid {
+		log.Printf("Leaving stored IP %q alone because it can't be canonicalised", id)
+	}
+	failed := 0
+	for _, ip := range ips {
+		canonical, ok := renames[ip.ID]
+		if !ok {
+			if addr, err := parseIP(ip.ID); err == nil && ip.Version == 0 {
+				err = db.Unscoped().Model(&IP{}).Where("id = ?", ip.ID).UpdateColumn("version", ipVersion(addr)).Error
+				if err != nil {
+					log.Println("Error setting the version of stored IP", ip.ID, "-", err)
+					failed++
+				}
+			}
+			continue
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			// make sure the canonical row exists, then move every association from the old row onto it
+			err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&IP{ID: canonical}).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Exec("INSERT INTO subdomain_ips (subdomain_id, ip_id) SELECT subdomain_id, ? FROM subdomain_ips WHERE ip_id = ? ON CONFLICT DO NOTHING", canonical, ip.ID).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Exec("INSERT INTO ip_vulns (vuln_id, ip_id) SELECT vuln_id, ? FROM ip_vulns WHERE ip_id = ? ON CONFLICT DO NOTHING", canonical, ip.ID).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Exec("INSERT INTO program_ips (program_id, ip_id, direct) SELECT program_id, ?, direct FROM program_ips WHERE ip_id = ? ON CONFLICT (program_id, ip_id) DO UPDATE SET direct = program_ips.direct OR excluded.direct", canonical, ip.ID).Error
+			if err != nil {
+				return err
+			}
+			for _, table := range []string{"subdomain_ips", "ip_vulns", "program_ips"} {
+				err = tx.Exec("DELETE FROM "+table+" WHERE ip_id = ?", ip.ID).Error
+				if err != nil {
+					return err
+				}
+			}
+			return tx.Exec("DELETE FROM ips WHERE id = ?", ip.ID).Error
+		})
+		if err != nil {
+			log.Println("Error canonicalising stored IP", ip.ID, "-", err)
+			failed++
+			continue
+		}
+		fmt.Println("Canonicalised stored IP", ip.ID, "to", canonical)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d stored IPs could not be canonicalised", failed)
+	}
+	return nil
+}
+
+// storedIPRenames works out which stored IPs canonicaliseStoredIPs renames, mapping each ID that isn't canonical to
+// the address it becomes. IDs that map to the same address end up merged into one row. IDs that can't be parsed are
+// returned separately and left alone.
+func storedIPRenames(ids []string) (map[string]string, []string) {
+	renames := make(map[string]string)
+	var invalid []string
+	for _, id := range ids {
+		addr, err := parseIP(id)
+		if err != nil {
+			invalid = append(invalid, id)
+			continue
+		}
+		if canonical := addr.String(); canonical != id {
+			renames[id] = canonical
+		}
+	}
+	return renames, invalid
+}
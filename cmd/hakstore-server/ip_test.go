@@ -0,0 +1,91 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseIP(t *testing.T) {
+	tests := []struct {
+		s           string
+		want        string
+		wantVersion int
+		wantErr     bool
+	}{
+		{s: "192.0.2.1", want: "192.0.2.1", wantVersion: 4},
+		{s: " 192.0.2.1\n", want: "192.0.2.1", wantVersion: 4},
+		{s: "010.000.0.01", want: "10.0.0.1", wantVersion: 4},
+		{s: "::ffff:192.0.2.1", want: "192.0.2.1", wantVersion: 4},
+		{s: "2001:0DB8:0000:0000:0000:0000:0000:0001", want: "2001:db8::1", wantVersion: 6},
+		{s: "2001:db8::1", want: "2001:db8::1", wantVersion: 6},
+		{s: "::1", want: "::1", wantVersion: 6},
+		{s: "", wantErr: true},
+		{s: "www.tesla.com", wantErr: true},
+		{s: "192.0.2", wantErr: true},
+		{s: "256.0.0.1", wantErr: true},
+		{s: "192.0.2.1/24", wantErr: true},
+		{s: "fe80::1%eth0", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.s, func(t *testing.T) {
+			addr, err := parseIP(test.s)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("parseIP(%q) error = %v, wantErr %v", test.s, err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			if got := addr.String(); got != test.want || ipVersion(addr) != test.wantVersion {
+				t.Errorf("parseIP(%q) = %q, version %d, want %q, version %d", test.s, got, ipVersion(addr), test.want, test.wantVersion)
+			}
+		})
+	}
+}
+
+func TestStripLeadingZeros(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{s: "010.000.0.01", want: "10.0.0.1"},
+		{s: "10.0.0.1", want: "10.0.0.1"},
+		{s: "0.0.0.0", want: "0.0.0.0"},
+		{s: "2001:0db8::0001", want: "2001:0db8::0001"},
+		{s: "010.0.1", want: "010.0.1"},
+	}
+	for _, test := range tests {
+		t.Run(test.s, func(t *testing.T) {
+			if got := stripLeadingZeros(test.s); got != test.want {
+				t.Errorf("stripLeadingZeros(%q) = %q, want %q", test.s, got, test.want)
+			}
+		})
+	}
+}
+
+func TestStoredIPRenames(t *testing.T) {
+	ids := []string{
+		"10.0.0.1",
+		"010.000.0.01",
+		"::ffff:10.0.0.1",
+		"10.000.0.2",
+		"010.0.0.2",
+		"2001:0DB8::0001",
+		"2001:db8::2",
+		"garbage",
+		"fe80::1%eth0",
+	}
+	renames, invalid := storedIPRenames(ids)
+	wantRenames := map[string]string{
+		"010.000.0.01":    "10.0.0.1",
+		"::ffff:10.0.0.1": "10.0.0.1",
+		"10.000.0.2":      "10.0.0.2",
+		"010.0.0.2":       "10.0.0.2",
+		"2001:0DB8::0001": "2001:db8::1",
+	}
+	if !reflect.DeepEqual(renames, wantRenames) {
+		t.Errorf("storedIPRenames() renames = %v, want %v", renames, wantRenames)
+	}
+	if wantInvalid := []string{"garbage", "fe80::1%eth0"}; !reflect.DeepEqual(invalid, wantInvalid) {
+		t.Errorf("storedIPRenames() invalid = %v, want %v", invalid, wantInvalid)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// IPRange is a CIDR range that belongs to a program, e.g. a netblock listed in its scope. Every stored IP inside the
+// range is associated with the program. The same range can belong to more than one program.
+type IPRange struct {
+	gorm.Model
+	ID          int    `json:"id" gorm:"PrimaryKey;autoIncrement"`
+	CIDR        string `json:"cidr" gorm:"column:cidr;uniqueIndex:idx_ip_ranges_cidr_program"`
+	ProgramID   string `json:"program" gorm:"uniqueIndex:idx_ip_ranges_cidr_program"`
+	Description string `json:"description"`
+}
+
+// Get all IP ranges. These can be filtered with ?program= or to the ranges containing an address with ?ip=
+func getIPRanges(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	query := db
+	if program := r.URL.Query().Get("program"); program != "" {
+		query = query.Where("program_id = ?", program)
+	}
+	if ip := r.URL.Query().Get("ip"); ip != "" {
+		addr, err := parseIP(ip)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		query = query.Where("CAST(? AS inet) <<= CAST(cidr AS cidr)", addr.String())
+	}
+	ranges := []IPRange{}
+	query.Find(&ranges)
+	json.NewEncoder(w).Encode(ranges)
+}
+
+// Get a specific IP range
+func getIPRange(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var ipRange IPRange
+	vars := mux.Vars(r)
+	db.Where("ID = ?", vars["id"]).Find(&ipRange)
+	json.NewEncoder(w).Encode(&ipRange)
+}
+
+// Creates new IP ranges, accepts batches. The programs of the stored IPs inside each new range are updated.
+func createIPRanges(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var ranges []IPRange
+	_ = json.NewDecoder(r.Body).Decode(&ranges)
+
+	stored := []IPRange{}
+	rejected := []Reject{}
+	for i, ipRange := range ranges {
+		item := ipRange.CIDR
+		saved, err := saveIPRange(&ipRange)
+		if err != nil {
+			rejected = append(rejected, rejectAt(i, item, err.Error()))
+			continue
+		}
+		if saved {
+			syncIPRangePrograms(ipRange.CIDR)
+		}
+		stored = append(stored, ipRange)
+	}
+	writeBatch(w, r, stored, rejected)
+}
+
+// saveIPRange validates an IP range and stores it, unless the program already has the same range. The range is
+// stored masked, so 10.1.2.3/8 becomes 10.0.0.0/8. It reports whether a new range was stored.
+func saveIPRange(ipRange *IPRange) (bool, error) {
+	prefix, err := netip.ParsePrefix(strings.TrimSpace(ipRange.CIDR))
+	if err != nil {
+		return false, fmt.Errorf("%q is not a valid CIDR range", ipRange.CIDR)
+	}
+	if prefix.Addr().Is4In6() {
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+	}
+	ipRange.CIDR = prefix.Masked().String()
+	if ipRange.ProgramID == "" {
+		return false, fmt.Errorf("an IP range needs a program")
+	}
+	var count int64
+	db.Model(&Program{}).Where("id = ?", ipRange.ProgramID).Count(&count)
+	if count == 0 {
+		return false, fmt.Errorf("program %s does not exist", ipRange.ProgramID)
+	}
+	ipRange.ID = 0
+	result := db.Where(IPRange{CIDR: ipRange.CIDR, ProgramID: ipRange.ProgramID}).Attrs(IPRange{Description: ipRange.Description}).FirstOrCreate(ipRange)
+	return result.RowsAffected > 0, result.Error
+}
+
+// Deletes an IP range, the IPs inside it are removed from the program unless a subdomain or another range of the
+// program still points at them
+func deleteIPRange(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	var ipRange IPRange
+	db.Where("ID = ?", vars["id"]).Find(&ipRange)
+	if ipRange.ID != 0 {
+		db.Unscoped().Delete(&ipRange)
+		syncIPRangePrograms(ipRange.CIDR)
+	}
+	var ranges []IPRange
+	db.Find(&ranges)
+	json.NewEncoder(w).Encode(ranges)
+}
+
+// syncIPRangePrograms updates the programs of every stored IP inside a CIDR range
+func syncIPRangePrograms(cidr string) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return
+	}
+	var ids []string
+	db.Model(&IP{}).Where("CAST(id AS inet) <<= CAST(? AS cidr)", prefix.Masked().String()).Pluck("id", &ids)
+	syncIPPrograms(ids...)
+}
+
+// syncIPPrograms works out which programs each IP belongs to, from the programs of the subdomains that resolve to it
+// and the program IP ranges it falls inside, and replaces its program associations with them. IPs added to a program
+// directly with linkIPProgram keep that program. Callers handling a batch of IPs sync them all in one call.
+func syncIPPrograms(ids ...string) {
+	for _, id := range mergeStrings(nil, ids) {
+		if _, err := parseIP(id); err != nil {
+			continue
+		}
+		subdomainPrograms := db.Model(&Subdomain{}).Select("program_id").Where("id IN (?)", db.Table("subdomain_ips").Select("subdomain_id").Where("ip_id = ?", id))
+		rangePrograms := db.Model(&IPRange{}).Select("program_id").Where("CAST(? AS inet) <<= CAST(cidr AS cidr)", id)
+		err := db.Transaction(func(tx *gorm.DB) error {
+			err := tx.Exec("DELETE FROM program_ips WHERE ip_id = ? AND NOT direct", id).Error
+			if err != nil {
+				return err
+			}
+			return tx.Exec("INSERT INTO program_ips (program_id, ip_id) SELECT id, ? FROM programs WHERE id IN (?) OR id IN (?) ON CONFLICT DO NOTHING", id, subdomainPrograms, rangePrograms).Error
+		})
+		if err != nil {
+			log.Println("Error updating the programs of IP", id+":", err)
+		}
+	}
+}
+
+// linkIPProgram adds a stored IP to a program on its own, e.g. when it was created with a program or found by a port
+// scan of the program, rather than through a subdomain or IP range. Programs that don't exist are ignored.
+func linkIPProgram(id string, program string) error {
+	return db.Exec("INSERT INTO program_ips (program_id, ip_id, direct) SELECT ?, ?, true WHERE EXISTS (SELECT 1 FROM programs WHERE id = ?) ON CONFLICT (program_id, ip_id) DO UPDATE SET direct = true", program, id, program).Error
+}
+
+// addDirectIPPrograms is a one-off migration that adds the direct column to program_ips, the join table gorm manages
+// for the programs of IPs. It marks the IPs added to a program with linkIPProgram, which syncIPPrograms leaves alone.
+func addDirectIPPrograms() error {
+	return db.Exec("ALTER TABLE program_ips ADD COLUMN IF NOT EXISTS direct boolean NOT NULL DEFAULT false").Error
+}
+
+// migrateIPPrograms is a one-off migration for IPs stored when each IP had a single program_id column. Programs that
+// can't be worked out from the IP's subdomains are kept by linking the IP to the program directly, then every IP gets
+// its program associations and the old column is dropped. It does nothing once the column is gone.
+func migrateIPPrograms() {
+	if !db.Migrator().HasColumn(&IP{}, "program_id") {
+		return
+	}
+	var rows []struct {
+		ID        string
+		ProgramID string
+	}
+	db.Table("ips").Select("id, program_id").Where("program_id <> '' AND deleted_at IS NULL").Scan(&rows)
+	for _, row := range rows {
+		var count int64
+		db.Model(&Subdomain{}).Where("program_id = ? AND id IN (?)", row.ProgramID, db.Table("subdomain_ips").Select("subdomain_id").Where("ip_id = ?", row.ID)).Count(&count)
+		if count > 0 {
+			continue
+		}
+		err := linkIPProgram(row.ID, row.ProgramID)
+		if err != nil {
+			log.Println("Could not keep the program of IP", row.ID+":", err)
+		}
+	}
+
+	var ids []string
+	db.Unscoped().Model(&IP{}).Pluck("id", &ids)
+	syncIPPrograms(ids...)
+	err := db.Migrator().DropColumn(&IP{}, "program_id")
+	if err != nil {
+		log.Println("Error dropping the old program_id column of ips:", err)
+		return
+	}
+	fmt.Println("Migrated the programs of", len(ids), "stored IPs")
+}
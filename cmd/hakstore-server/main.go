@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/go-redis/redis"
 	"github.com/gorilla/mux"
@@ -45,6 +46,17 @@ type Config struct {
 		LowWebhook           string `yaml:"lowwebhook" envconfig:"LOW_WEBHOOK"`
 		InformationalWebhook string `yaml:"informationalwebhook" envconfig:"INFORMATIONAL_WEBHOOK"`
 	} `yaml:"slack"`
+	Liveness struct {
+		StaleDays int `yaml:"staledays" envconfig:"STALE_DAYS"`
+	} `yaml:"liveness"`
+	Takeover struct {
+		Fingerprints string `yaml:"fingerprints" envconfig:"TAKEOVER_FINGERPRINTS"`
+		Concurrency  int    `yaml:"concurrency" envconfig:"TAKEOVER_CONCURRENCY"`
+	} `yaml:"takeover"`
+	Alerts struct {
+		Time             string `yaml:"time" envconfig:"ALERT_TIME"`
+		DomainExpiryDays int    `yaml:"domainexpirydays" envconfig:"DOMAIN_EXPIRY_DAYS"`
+	} `yaml:"alerts"`
 }
 
 // GLOBAL VARIABLES
@@ -117,7 +129,11 @@ func main() {
 	r.Use(amw.Middleware)
 
 	// Migrate the schema
-	db.AutoMigrate(&Platform{}, &Program{}, &RootDomain{}, &Subdomain{}, &IP{}, &User{}, &Vuln{})
+	db.AutoMigrate(&Platform{}, &Program{}, &BountyRange{}, &RootDomain{}, &Subdomain{}, &IP{}, &User{}, &Vuln{}, &VulnStatusChange{}, &Report{}, &ReportBonus{}, &Endpoint{}, &Certificate{}, &CertificateBinding{}, &CloudAsset{}, &IPRange{}, &Port{}, &ScopeTarget{}, &DNSRecord{}, &Migration{})
+	runMigration("program-ips-direct", addDirectIPPrograms)
+	migrateIPPrograms()
+	runMigration("canonicalise-stored-ips", canonicaliseStoredIPs)
+	backfillSubdomainLiveness()
 
 	// If no users exist yet, create the first one!
 	var user User
@@ -126,6 +142,17 @@ func main() {
 	fmt.Println("Your admin API Key is", user.Key)
 	fmt.Println("Keep it secret, keep it safe.")
 
+	// Load the fingerprints for subdomain takeover checks
+	err = loadTakeoverFingerprints()
+	if err != nil {
+		fmt.Println("Error loading takeover fingerprints:", err)
+		os.Exit(1)
+	}
+	startTakeoverChecks()
+
+	// Start the scheduled alerts
+	startScheduler()
+
 	// Populate the database with some test data
 	//seedDB()
 
@@ -182,3 +209,32 @@ func seedDB() {
 	db.Create(&rootdomains)
 	db.Create(&subdomains)
 }
+
+// Migration records a one-off data migration that has been run, so it isn't run again on the next start
+type Migration struct {
+	ID        string `gorm:"PrimaryKey"`
+	AppliedAt time.Time
+}
+
+// runMigration runs a one-off data migration unless it has already been run. A migration that fails is logged and
+// tried again on the next start.
+func runMigration(name string, migrate func() error) {
+	var count int64
+	err := db.Model(&Migration{}).Where("id = ?", name).Count(&count).Error
+	if err != nil {
+		log.Println("Could not check whether migration", name, "has run:", err)
+		return
+	}
+	if count > 0 {
+		return
+	}
+	err = migrate()
+	if err != nil {
+		log.Println("Migration", name, "failed, it will be tried again on the next start:", err)
+		return
+	}
+	err = db.Create(&Migration{ID: name, AppliedAt: time.Now()}).Error
+	if err != nil {
+		log.Println("Could not record that migration", name, "has run:", err)
+	}
+}
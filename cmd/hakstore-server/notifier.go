@@ -15,7 +15,7 @@ type slackRequestBody struct {
 }
 
 // SendVulnNotification takes a vulnerability and sends a notification to the appropriate slack channel
-func SendVulnNotification(v Vuln) {
+func SendVulnNotification(v Vuln) error {
 	var webhook string
 	switch v.Severity {
 	case 1:
@@ -51,15 +51,25 @@ func SendVulnNotification(v Vuln) {
 	}
 
 	// Send a slack notification about the vuln
-	SendNotification(webhook, "["+strings.ToUpper(severityString(v.Severity))+"]\nProgram: "+v.ProgramID+"\nHosts: [ "+subsString+" "+ipsString+"]\nDescription: "+v.Description)
+	message := "[" + strings.ToUpper(severityString(v.Severity)) + "]\n"
+	if v.Title != "" {
+		message = message + "Title: " + v.Title + "\n"
+	}
+	message = message + "Program: " + v.ProgramID + "\nHosts: [ " + subsString + " " + ipsString + "]\nDescription: " + v.Description
+	if v.URL != "" {
+		message = message + "\nURL: " + v.URL
+	}
+	return SendNotification(webhook, message)
 }
 
-// SendNotification sends a message to the slack webhook in the config.yml file
-func SendNotification(webhook string, content string) {
+// SendNotification sends a message to the slack webhook in the config.yml file. Failures are logged and returned, so
+// a broken webhook doesn't take down the server while it is creating vulns.
+func SendNotification(webhook string, content string) error {
 	err := SendSlackNotification(webhook, content)
 	if err != nil {
-		log.Fatal(err)
+		log.Println("Error sending Slack notification:", err)
 	}
+	return err
 }
 
 // SendSlackNotification will send a message via slack to a webhook
@@ -0,0 +1,497 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// Port is an open port found on an IP by a port scanner, along with what the scanner learnt about the service
+type Port struct {
+	gorm.Model
+	ID        int       `json:"id" gorm:"PrimaryKey;autoIncrement"`
+	IPID      string    `json:"ip" gorm:"uniqueIndex:idx_ports_ip_port"`
+	Port      int       `json:"port" gorm:"uniqueIndex:idx_ports_ip_port"`
+	Protocol  string    `json:"protocol" gorm:"uniqueIndex:idx_ports_ip_port"`
+	Service   string    `json:"service"`
+	Product   string    `json:"product"`
+	Version   string    `json:"version"`
+	Banner    string    `json:"banner"`
+	FirstSeen time.Time `json:"firstseen"`
+	LastSeen  time.Time `json:"lastseen"`
+}
+
+// Get all open ports. These can be filtered with ?ip=, ?port=, ?service= and ?program=
+func getPorts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	query := db
+	if ip := r.URL.Query().Get("ip"); ip != "" {
+		if addr, err := parseIP(ip); err == nil {
+			ip = addr.String()
+		}
+		query = query.Where("ip_id = ?", ip)
+	}
+	if port := r.URL.Query().Get("port"); port != "" {
+		query = query.Where("port = ?", port)
+	}
+	if service := r.URL.Query().Get("service"); service != "" {
+		query = query.Where("service = ?", strings.ToLower(service))
+	}
+	if program := r.URL.Query().Get("program"); program != "" {
+		query = query.Where("ip_id IN (?)", db.Table("program_ips").Select("ip_id").Where("program_id = ?", program))
+	}
+	var ports []Port
+	query.Order("ip_id, port").Find(&ports)
+	json.NewEncoder(w).Encode(ports)
+}
+
+// Deletes a port, e.g. once it has been closed
+func deletePort(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	db.Unscoped().Where("ID = ?", vars["id"]).Delete(&Port{})
+	var ports []Port
+	db.Find(&ports)
+	json.NewEncoder(w).Encode(ports)
+}
+
+// scannedHost is a host in the output of a port scanner, in the same shape whichever scanner it came from
+type scannedHost struct {
+	Address   string
+	Hostnames []string
+	Ports     []Port
+}
+
+// importScannedHosts stores the hosts found by a port scanner. Each address becomes an IP, given to the program
+// being imported into directly if there is one, or left to the program ranges otherwise. Addresses the program lists
+// as out of scope are skipped along with their ports. Hostnames are only associated with subdomains that are already
+// stored. In a dry run nothing is written, but the summary says what would have been.
+func importScannedHosts(hosts []scannedHost, program string, dryRun bool, summary *ImportSummary) {
+	now := time.Now()
+	var imported []string
+	exclusions := outOfScopeTargets(program)
+	for _, host := range hosts {
+		addr, err := parseIP(host.Address)
+		if err != nil {
+			summary.Rejected = append(summary.Rejected, Reject{Item: host.Address, Reason: err.Error()})
+			continue
+		}
+		ip := IP{ID: addr.String()}
+		if target, excluded := excludedBy(exclusions, ip.ID); excluded {
+			summary.skip("ips", ip.ID, target.Target+" is out of scope for program "+program)
+			continue
+		}
+		outcome := ImportUpdated
+		if db.Where("id = ?", ip.ID).First(&ip).Error != nil {
+			outcome = ImportCreated
+			if !dryRun {
+				err = db.Create(&ip).Error
+				if err != nil {
+					summary.Rejected = append(summary.Rejected, Reject{Item: ip.ID, Reason: err.Error()})
+					continue
+				}
+			}
+		}
+		summary.record("ips", outcome)
+		if program != "" && !dryRun {
+			err := linkIPProgram(ip.ID, program)
+			if err != nil {
+				summary.Rejected = append(summary.Rejected, Reject{Item: ip.ID, Reason: err.Error()})
+			}
+		}
+
+		for _, hostname := range host.Hostnames {
+			name, _, err := normaliseHostname(hostname)
+			if err != nil {
+				continue
+			}
+			var subdomain Subdomain
+			if db.Where("id = ?", name).First(&subdomain).Error != nil {
+				summary.skip("subdomains", name, "not a stored subdomain")
+				continue
+			}
+			if !dryRun {
+				db.Model(&subdomain).Association("IPs").Append([]IP{ip})
+			}
+			summary.record("subdomains", ImportUpdated)
+		}
+		imported = append(imported, ip.ID)
+
+		for _, port := range host.Ports {
+			port.IPID = ip.ID
+			port.Protocol = strings.ToLower(port.Protocol)
+			port.Service = strings.ToLower(port.Service)
+			item := fmt.Sprintf("%s:%d/%s", ip.ID, port.Port, port.Protocol)
+			if port.Port < 1 || port.Port > 65535 {
+				summary.Rejected = append(summary.Rejected, Reject{Item: item, Reason: "port is out of range"})
+				continue
+			}
+			var existing Port
+			err := db.Where("ip_id = ? AND port = ? AND protocol = ?", port.IPID, port.Port, port.Protocol).First(&existing).Error
+			if err != nil {
+				summary.record("ports", ImportCreated)
+				if !dryRun {
+					port.FirstSeen = now
+					port.LastSeen = now
+					db.Create(&port)
+				}
+				continue
+			}
+			summary.record("ports", ImportUpdated)
+			if dryRun {
+				continue
+			}
+			// a scan that didn't fingerprint the service shouldn't wipe out what an earlier scan found
+			existing.LastSeen = now
+			for _, field := range []struct{ stored, scanned *string }{
+				{&existing.Service, &port.Service},
+				{&existing.Product, &port.Product},
+				{&existing.Version, &port.Version},
+				{&existing.Banner, &port.Banner},
+			} {
+				if *field.scanned != "" {
+					*field.stored = *field.scanned
+				}
+			}
+			db.Model(&existing).Select("service", "product", "version", "banner", "last_seen").Updates(&existing)
+		}
+	}
+	if !dryRun {
+		syncIPPrograms(imported...)
+	}
+}
+
+// importScanOptions reads the options shared by the port scanner imports, ?program= and ?dryrun=true
+func importScanOptions(w http.ResponseWriter, r *http.Request) (program string, dryRun bool, ok bool) {
+	program, err := importProgram(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return "", false, false
+	}
+	return program, r.URL.Query().Get("dryrun") == "true", true
+}
+
+// nmapRun is the part of nmap's XML output (-oX) that is imported
+type nmapRun struct {
+	Hosts []struct {
+		Status struct {
+			State string `xml:"state,attr"`
+		} `xml:"status"`
+		Addresses []struct {
+			Addr     string `xml:"addr,attr"`
+			AddrType string `xml:"addrtype,attr"`
+		} `xml:"address"`
+		Hostnames []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"hostnames>hostname"`
+		Ports []struct {
+			Protocol string `xml:"protocol,attr"`
+			PortID   int    `xml:"portid,attr"`
+			State    struct {
+				State string `xml:"state,attr"`
+			} `xml:"state"`
+			Service struct {
+				Name      string `xml:"name,attr"`
+				Product   string `xml:"product,attr"`
+				Version   string `xml:"version,attr"`
+				ExtraInfo string `xml:"extrainfo,attr"`
+			} `xml:"service"`
+			Scripts []struct {
+				ID     string `xml:"id,attr"`
+				Output string `xml:"output,attr"`
+			} `xml:"script"`
+		} `xml:"ports>port"`
+	} `xml:"host"`
+}
+
+// parseNmapXML reads the hosts that were up, and their open ports, from nmap's XML output
+func parseNmapXML(data []byte) ([]scannedHost, error) {
+	var run nmapRun
+	err := xml.Unmarshal(data, &run)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nmap XML: %v", err)
+	}
+	var hosts []scannedHost
+	for _, h := range run.Hosts {
+		if h.Status.State != "" && h.Status.State != "up" {
+			continue
+		}
+		var host scannedHost
+		for _, address := range h.Addresses {
+			if address.AddrType == "ipv4" || address.AddrType == "ipv6" {
+				host.Address = address.Addr
+				break
+			}
+		}
+		if host.Address == "" {
+			continue
+		}
+		for _, hostname := range h.Hostnames {
+			host.Hostnames = append(host.Hostnames, hostname.Name)
+		}
+		for _, p := range h.Ports {
+			if p.State.State != "open" {
+				continue
+			}
+			port := Port{Port: p.PortID, Protocol: p.Protocol, Service: p.Service.Name, Product: p.Service.Product, Version: strings.TrimSpace(p.Service.Version + " " + p.Service.ExtraInfo)}
+			for _, script := range p.Scripts {
+				if script.ID == "banner" {
+					port.Banner = script.Output
+				}
+			}
+			host.Ports = append(host.Ports, port)
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
+
+// parseGrepable reads the grepable output (-oG) of nmap or masscan. Nmap puts every port of a host on one line,
+// masscan writes a line per port and another line per banner, so hosts are merged by address.
+func parseGrepable(data []byte) []scannedHost {
+	var hosts []scannedHost
+	index := make(map[string]int)
+	hostFor := func(address string) *scannedHost {
+		i, ok := index[address]
+		if !ok {
+			i = len(hosts)
+			index[address] = i
+			hosts = append(hosts, scannedHost{Address: address})
+		}
+		return &hosts[i]
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "Host: ") {
+			continue
+		}
+		fields := make(map[string]string)
+		for _, field := range strings.Split(line, "\t") {
+			parts := strings.SplitN(field, ": ", 2)
+			if len(parts) == 2 {
+				fields[parts[0]] = strings.TrimSpace(parts[1])
+			}
+		}
+		// Host: 192.0.2.1 (www.example.com)
+		hostField := strings.Fields(fields["Host"])
+		if len(hostField) == 0 {
+			continue
+		}
+		host := hostFor(hostField[0])
+		if len(hostField) > 1 {
+			if name := strings.Trim(hostField[1], "()"); name != "" && !contains(host.Hostnames, name) {
+				host.Hostnames = append(host.Hostnames, name)
+			}
+		}
+
+		// Ports: 22/open/tcp//ssh//OpenSSH 7.4/, 80/open/tcp//http///
+		for _, entry := range strings.Split(fields["Ports"], ",") {
+			parts := strings.Split(strings.TrimSpace(entry), "/")
+			if len(parts) < 3 || parts[1] != "open" {
+				continue
+			}
+			number, err := strconv.Atoi(parts[0])
+			if err != nil {
+				continue
+			}
+			port := Port{Port: number, Protocol: parts[2]}
+			if len(parts) > 4 {
+				port.Service = parts[4]
+			}
+			if len(parts) > 6 {
+				port.Version = parts[6]
+			}
+			host.Ports = mergePort(host.Ports, port)
+		}
+
+		// masscan banners: Port: 80	Service: http	Banner: nginx
+		if number, err := strconv.Atoi(strings.SplitN(fields["Port"], "/", 2)[0]); err == nil && fields["Banner"] != "" {
+			protocol := "tcp"
+			if parts := strings.SplitN(fields["Port"], "/", 2); len(parts) == 2 {
+				protocol = parts[1]
+			}
+			host.Ports = mergePort(host.Ports, Port{Port: number, Protocol: protocol, Service: fields["Service"], Banner: fields["Banner"]})
+		}
+	}
+	return hosts
+}
+
+// mergePort adds a port to a host's ports, filling in the details of the port if it is already there
+func mergePort(ports []Port, port Port) []Port {
+	for i := range ports {
+		if ports[i].Port == port.Port && ports[i].Protocol == port.Protocol {
+			if port.Service != "" {
+				ports[i].Service = port.Service
+			}
+			if port.Version != "" {
+				ports[i].Version = port.Version
+			}
+			if port.Banner != "" {
+				ports[i].Banner = port.Banner
+			}
+			return ports
+		}
+	}
+	return append(ports, port)
+}
+
+// masscanRecord is an object in masscan's JSON output (-oJ). Ports with a service carry a banner instead of a status.
+type masscanRecord struct {
+	IP    string `json:"ip"`
+	Ports []struct {
+		Port    int    `json:"port"`
+		Proto   string `json:"proto"`
+		Status  string `json:"status"`
+		Service struct {
+			Name   string `json:"name"`
+			Banner string `json:"banner"`
+		} `json:"service"`
+	} `json:"ports"`
+}
+
+// masscanFinished matches the object masscan ends its JSON output with, older versions leave the key unquoted
+var masscanFinished = regexp.MustCompile(`^\{\s*"?finished"?\s*:\s*1\s*\}$`)
+
+// parseMasscanJSON reads masscan's JSON output. Masscan writes a JSON array with an object per line, and older
+// versions leave a trailing comma before the closing bracket, so each line is parsed on its own.
+func parseMasscanJSON(data []byte) ([]scannedHost, []Reject) {
+	var hosts []scannedHost
+	var rejected []Reject
+	index := make(map[string]int)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSuffix(strings.TrimSpace(scanner.Text()), ",")
+		if text == "" || text == "[" || text == "]" || masscanFinished.MatchString(text) {
+			continue
+		}
+		var record masscanRecord
+		err := json.Unmarshal([]byte(text), &record)
+		if err != nil {
+			rejected = append(rejected, Reject{Item: fmt.Sprintf("line %d", line), Reason: err.Error()})
+			continue
+		}
+		i, ok := index[record.IP]
+		if !ok {
+			i = len(hosts)
+			index[record.IP] = i
+			hosts = append(hosts, scannedHost{Address: record.IP})
+		}
+		for _, p := range record.Ports {
+			if p.Status != "" && p.Status != "open" {
+				continue
+			}
+			hosts[i].Ports = mergePort(hosts[i].Ports, Port{Port: p.Port, Protocol: p.Proto, Service: p.Service.Name, Banner: p.Service.Banner})
+		}
+	}
+	return hosts, rejected
+}
+
+// maxImportSize is the largest import request body that is read as a stream. Formats that have to be held in memory
+// whole are limited to maxBufferedImportSize instead, so a few concurrent imports can't use up the server's memory.
+const (
+	maxImportSize         = 512 * 1024 * 1024
+	maxBufferedImportSize = 64 * 1024 * 1024
+)
+
+// importBodyReader reads the body of an import request, failing once more than its limit has been read so an import
+// that is too big is rejected rather than cut short
+type importBodyReader struct {
+	body  io.Reader
+	limit int64
+	read  int64
+}
+
+func (b *importBodyReader) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.read += int64(n)
+	if b.read > b.limit {
+		return 0, fmt.Errorf("the import is larger than the %dMB limit", b.limit/1024/1024)
+	}
+	return n, err
+}
+
+// importBody is the body of an import request, for formats that are read as a stream
+func importBody(r *http.Request) io.Reader {
+	return &importBodyReader{body: r.Body, limit: maxImportSize}
+}
+
+// readImportBody reads the whole body of an import request, for formats that can't be read a line at a time
+func readImportBody(r *http.Request) ([]byte, error) {
+	return ioutil.ReadAll(&importBodyReader{body: r.Body, limit: maxBufferedImportSize})
+}
+
+// Imports nmap's XML output (-oX), or its grepable output (-oG). Hosts that were up become IPs, their open ports
+// are stored with the service details nmap found, and their hostnames are associated with stored subdomains. With
+// ?program= every IP is added to that program, and ?dryrun=true reports what would be stored without storing it.
+func importNmap(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	program, dryRun, ok := importScanOptions(w, r)
+	if !ok {
+		return
+	}
+	data, err := readImportBody(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var hosts []scannedHost
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")) {
+		hosts, err = parseNmapXML(data)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	} else {
+		hosts = parseGrepable(data)
+	}
+	summary := newImportSummary()
+	summary.DryRun = dryRun
+	importScannedHosts(hosts, program, dryRun, &summary)
+	json.NewEncoder(w).Encode(summary)
+}
+
+// Imports masscan's JSON output (-oJ), or its grepable output (-oG). Works the same way as the nmap import.
+func importMasscan(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	program, dryRun, ok := importScanOptions(w, r)
+	if !ok {
+		return
+	}
+	data, err := readImportBody(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	summary := newImportSummary()
+	summary.DryRun = dryRun
+	var hosts []scannedHost
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("[")) || bytes.HasPrefix(trimmed, []byte("{")) {
+		var rejected []Reject
+		hosts, rejected = parseMasscanJSON(data)
+		summary.Rejected = append(summary.Rejected, rejected...)
+	} else {
+		hosts = parseGrepable(data)
+	}
+	importScannedHosts(hosts, program, dryRun, &summary)
+	json.NewEncoder(w).Encode(summary)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseNmapXML(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []scannedHost
+		wantErr bool
+	}{
+		{
+			name: "open ports with services",
+			data: `<?xml version="1.0"?>
+<nmaprun>
+<host><status state="up"/><address addr="192.0.2.1" addrtype="ipv4"/>
+<hostnames><hostname name="www.example.com" type="user"/></hostnames>
+<ports>
+<port protocol="tcp" portid="22"><state state="open"/><service name="ssh" product="OpenSSH" version="7.4"/></port>
+<port protocol="tcp" portid="25"><state state="closed"/><service name="smtp"/></port>
+</ports></host>
+</nmaprun>`,
+			want: []scannedHost{{
+				Address:   "192.0.2.1",
+				Hostnames: []string{"www.example.com"},
+				Ports:     []Port{{Port: 22, Protocol: "tcp", Service: "ssh", Product: "OpenSSH", Version: "7.4"}},
+			}},
+		},
+		{
+			name: "hosts that are down are left out",
+			data: `<nmaprun><host><status state="down"/><address addr="192.0.2.2" addrtype="ipv4"/></host></nmaprun>`,
+		},
+		{
+			name:    "not XML",
+			data:    `<nmaprun><host>`,
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseNmapXML([]byte(test.data))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("parseNmapXML() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseNmapXML() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseGrepable(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []scannedHost
+	}{
+		{
+			name: "nmap",
+			data: "# Nmap 7.80 scan initiated\n" +
+				"Host: 192.0.2.1 (www.example.com)\tStatus: Up\n" +
+				"Host: 192.0.2.1 (www.example.com)\tPorts: 22/open/tcp//ssh//OpenSSH 7.4/, 25/closed/tcp//smtp///, 80/open/tcp//http///\n",
+			want: []scannedHost{{
+				Address:   "192.0.2.1",
+				Hostnames: []string{"www.example.com"},
+				Ports: []Port{
+					{Port: 22, Protocol: "tcp", Service: "ssh", Version: "OpenSSH 7.4"},
+					{Port: 80, Protocol: "tcp", Service: "http"},
+				},
+			}},
+		},
+		{
+			name: "no hosts",
+			data: "# Nmap done\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := parseGrepable([]byte(test.data))
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseGrepable() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseMasscanJSON(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         string
+		want         []scannedHost
+		wantRejected int
+	}{
+		{
+			name: "array with a trailing comma",
+			data: `[
+{   "ip": "192.0.2.1",   "timestamp": "1600000000", "ports": [ {"port": 80, "proto": "tcp", "status": "open", "reason": "syn-ack", "ttl": 54} ] },
+{   "ip": "192.0.2.1",   "timestamp": "1600000001", "ports": [ {"port": 80, "proto": "tcp", "service": {"name": "http", "banner": "nginx"} } ] },
+]`,
+			want: []scannedHost{{
+				Address: "192.0.2.1",
+				Ports:   []Port{{Port: 80, Protocol: "tcp", Service: "http", Banner: "nginx"}},
+			}},
+		},
+		{
+			name: "finished objects are skipped",
+			data: "[\n{\"finished\": 1}\n]\n{finished: 1}\n",
+		},
+		{
+			name:         "a banner mentioning finished is still read",
+			data:         `{"ip": "192.0.2.3", "ports": [ {"port": 21, "proto": "tcp", "service": {"name": "ftp", "banner": "transfer finished"} } ] }`,
+			want:         []scannedHost{{Address: "192.0.2.3", Ports: []Port{{Port: 21, Protocol: "tcp", Service: "ftp", Banner: "transfer finished"}}}},
+			wantRejected: 0,
+		},
+		{
+			name:         "invalid lines are rejected",
+			data:         "{\"ip\": \"192.0.2.4\"\n",
+			wantRejected: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, rejected := parseMasscanJSON([]byte(test.data))
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseMasscanJSON() = %+v, want %+v", got, test.want)
+			}
+			if len(rejected) != test.wantRejected {
+				t.Errorf("parseMasscanJSON() rejected %v, want %d rejects", rejected, test.wantRejected)
+			}
+		})
+	}
+}
+
+func TestReadImportBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		wantErr bool
+	}{
+		{name: "under the limit", size: 1024},
+		{name: "at the limit", size: maxBufferedImportSize},
+		{name: "over the limit", size: maxBufferedImportSize + 1, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/import/nmap", strings.NewReader(strings.Repeat("a", test.size)))
+			data, err := readImportBody(r)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("readImportBody() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !test.wantErr && len(data) != test.size {
+				t.Errorf("readImportBody() read %d bytes, want %d", len(data), test.size)
+			}
+		})
+	}
+
+	r := httptest.NewRequest("POST", "/api/import/ctlog", strings.NewReader(strings.Repeat("a", maxBufferedImportSize+1)))
+	if _, err := ioutil.ReadAll(importBody(r)); err != nil {
+		t.Errorf("importBody() error = %v, streamed imports aren't limited to %d bytes", err, maxBufferedImportSize)
+	}
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 	"gorm.io/gorm"
@@ -11,18 +13,74 @@ import (
 // Program is a structure to store details about bug bounty programs
 type Program struct {
 	gorm.Model
-	ID          string       `json:"id" gorm:"PrimaryKey"`
-	PlatformID  string       `json:"platform"`
-	Subdomains  []Subdomain  `json:"subdomains"`
-	RootDomains []RootDomain `json:"rootdomains"`
-	IPs         []IP         `json:"ips"`
+	ID          string        `json:"id" gorm:"PrimaryKey"`
+	PlatformID  string        `json:"platform"`
+	Name        string        `json:"name"`
+	URL         string        `json:"url"`
+	Policy      string        `json:"policy"`
+	Type        string        `json:"type"`
+	State       string        `json:"state" gorm:"default:active"`
+	SafeHarbour bool          `json:"safeharbour"`
+	LaunchDate  *time.Time    `json:"launchdate"`
+	Bounties    []BountyRange `json:"bounties"`
+	Metadata    StringMap     `json:"metadata"`
+	Subdomains  []Subdomain   `json:"subdomains"`
+	RootDomains []RootDomain  `json:"rootdomains"`
+	IPs         []IP          `json:"ips" gorm:"many2many:program_ips;"`
 }
 
-// Get all Programs
+// BountyRange is what a program pays for a vuln of a certain severity, 1 being critical and 5 informational
+type BountyRange struct {
+	gorm.Model
+	ProgramID string  `json:"program"`
+	Severity  int     `json:"severity"`
+	Min       float64 `json:"min" gorm:"type:numeric(12,2)"`
+	Max       float64 `json:"max" gorm:"type:numeric(12,2)"`
+	Currency  string  `json:"currency"`
+}
+
+// programTypes are the kinds of program, vdp being a vulnerability disclosure program that doesn't pay
+var programTypes = []string{"private", "public", "vdp"}
+
+// programStates are the states a program can be in, only active programs accept reports
+var programStates = []string{"active", "paused", "closed"}
+
+// programUpdate holds the fields of a program that can be changed through the API, fields that are nil are left
+// alone. Bounties replace the existing ones, while metadata is merged in and keys with an empty value are removed.
+type programUpdate struct {
+	PlatformID  *string        `json:"platform"`
+	Name        *string        `json:"name"`
+	URL         *string        `json:"url"`
+	Policy      *string        `json:"policy"`
+	Type        *string        `json:"type"`
+	State       *string        `json:"state"`
+	SafeHarbour *bool          `json:"safeharbour"`
+	LaunchDate  *time.Time     `json:"launchdate"`
+	Bounties    *[]BountyRange `json:"bounties"`
+	Metadata    StringMap      `json:"metadata"`
+}
+
+// Get all Programs. These can be filtered with ?platform=, ?type=, ?state= and ?paid=true, which only returns
+// programs that pay a bounty for at least one severity
 func getPrograms(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
+	query := db
+	for _, filter := range []string{"platform", "type", "state"} {
+		if value := r.URL.Query().Get(filter); value != "" {
+			column := filter
+			if filter == "platform" {
+				column = "platform_id"
+			}
+			query = query.Where(column+" = ?", value)
+		}
+	}
+	if paid := r.URL.Query().Get("paid"); paid == "true" {
+		query = query.Where("id IN (?)", db.Model(&BountyRange{}).Select("program_id").Where("max > 0"))
+	} else if paid == "false" {
+		query = query.Where("id NOT IN (?)", db.Model(&BountyRange{}).Select("program_id").Where("max > 0"))
+	}
 	var programs []Program
-	db.Find(&programs)
+	query.Preload("Bounties").Find(&programs)
 	json.NewEncoder(w).Encode(programs)
 }
 
@@ -31,7 +89,7 @@ func getProgram(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var program Program
 	vars := mux.Vars(r)
-	db.Where("ID = ?", vars["id"]).Preload("RootDomains").Find(&program)
+	db.Where("ID = ?", vars["id"]).Preload("RootDomains").Preload("Bounties").Find(&program)
 	json.NewEncoder(w).Encode(&program)
 }
 
@@ -40,13 +98,142 @@ func createProgram(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var program Program
 	_ = json.NewDecoder(r.Body).Decode(&program)
+	if program.State == "" {
+		program.State = "active"
+	}
+	err := validateProgram(program.Type, program.State, program.Bounties)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	db.FirstOrCreate(&program)
 	json.NewEncoder(w).Encode(program)
 }
 
 // Updates a program
 func updateProgram(w http.ResponseWriter, r *http.Request) {
-	//TODO
+	w.Header().Set("Content-Type", "application/json")
+	vars := mux.Vars(r)
+	var program Program
+	err := db.Where("ID = ?", vars["id"]).First(&program).Error
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Program not found.")
+		return
+	}
+
+	var update programUpdate
+	_ = json.NewDecoder(r.Body).Decode(&update)
+	updates := make(map[string]interface{})
+	if update.PlatformID != nil {
+		updates["platform_id"] = *update.PlatformID
+	}
+	if update.Name != nil {
+		updates["name"] = *update.Name
+	}
+	if update.URL != nil {
+		updates["url"] = *update.URL
+	}
+	if update.Policy != nil {
+		updates["policy"] = *update.Policy
+	}
+	if update.Type != nil {
+		updates["type"] = *update.Type
+	}
+	if update.State != nil {
+		updates["state"] = *update.State
+	}
+	if update.SafeHarbour != nil {
+		updates["safe_harbour"] = *update.SafeHarbour
+	}
+	if update.LaunchDate != nil {
+		updates["launch_date"] = *update.LaunchDate
+	}
+	if update.Metadata != nil {
+		metadata := program.Metadata
+		if metadata == nil {
+			metadata = make(StringMap)
+		}
+		for key, value := range update.Metadata {
+			if value == "" {
+				delete(metadata, key)
+			} else {
+				metadata[key] = value
+			}
+		}
+		updates["metadata"] = metadata
+	}
+
+	var bounties []BountyRange
+	if update.Bounties != nil {
+		bounties = *update.Bounties
+	}
+	programType, state := program.Type, program.State
+	if update.Type != nil {
+		programType = *update.Type
+	}
+	if update.State != nil {
+		state = *update.State
+	}
+	err = validateProgram(programType, state, bounties)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if len(updates) > 0 {
+			err := tx.Model(&program).Updates(updates).Error
+			if err != nil {
+				return err
+			}
+		}
+		if update.Bounties == nil {
+			return nil
+		}
+		err := tx.Unscoped().Where("program_id = ?", program.ID).Delete(&BountyRange{}).Error
+		if err != nil || len(bounties) == 0 {
+			return err
+		}
+		for i := range bounties {
+			bounties[i].ProgramID = program.ID
+		}
+		return tx.Create(&bounties).Error
+	})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	db.Where("ID = ?", program.ID).Preload("RootDomains").Preload("Bounties").Find(&program)
+	json.NewEncoder(w).Encode(&program)
+}
+
+// validateProgram checks the fields of a program that only allow certain values
+func validateProgram(programType string, state string, bounties []BountyRange) error {
+	if programType != "" && !contains(programTypes, programType) {
+		return fmt.Errorf("unknown program type %q, it should be one of %v", programType, programTypes)
+	}
+	if !contains(programStates, state) {
+		return fmt.Errorf("unknown program state %q, it should be one of %v", state, programStates)
+	}
+	for _, bounty := range bounties {
+		if bounty.Severity < 1 || bounty.Severity > 5 {
+			return fmt.Errorf("bounty severity must be between 1 (critical) and 5 (informational)")
+		}
+		if bounty.Max < bounty.Min {
+			return fmt.Errorf("%s bounty maximum is less than its minimum", severityString(bounty.Severity))
+		}
+	}
+	return nil
+}
+
+// contains checks whether a list of strings contains a value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
 }
 
 // Deletes a program
@@ -63,6 +250,15 @@ func deleteProgram(w http.ResponseWriter, r *http.Request) {
 
 func deleteProgramLocal(program Program) {
 	db.Model(&program).Association("IPs").Clear()
+	db.Unscoped().Where("program_id = ?", program.ID).Delete(&IPRange{})
+	db.Unscoped().Where("program_id = ?", program.ID).Delete(&ScopeTarget{})
+	db.Unscoped().Where("program_id = ?", program.ID).Delete(&BountyRange{})
+	db.Unscoped().Where("program_id = ?", program.ID).Delete(&Endpoint{})
+	var assets []CloudAsset
+	db.Where("program_id = ?", program.ID).Find(&assets)
+	for _, asset := range assets {
+		deleteCloudAssetLocal(asset)
+	}
 	var rootdomains []RootDomain
 	db.Model(&program).Association("RootDomains").Find(&rootdomains)
 	for _, s := range rootdomains {
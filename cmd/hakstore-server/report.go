@@ -0,0 +1,318 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// Report is a structure to store details about a report submitted to a bug bounty platform, and what it paid out
+type Report struct {
+	gorm.Model
+	ID               int           `json:"id" gorm:"PrimaryKey;autoIncrement"`
+	ProgramID        string        `json:"program"`
+	PlatformID       string        `json:"platform"`
+	PlatformReportID string        `json:"platformreportid"`
+	SubmittedAt      time.Time     `json:"submittedat"`
+	State            string        `json:"state" gorm:"index;default:new"`
+	Bounty           float64       `json:"bounty" gorm:"type:numeric(12,2)"`
+	Currency         string        `json:"currency"`
+	Bonuses          []ReportBonus `json:"bonuses"`
+	Vulns            []*Vuln       `json:"vulns" gorm:"many2many:report_vulns;"`
+}
+
+// ReportBonus is a payout on top of a report's bounty, e.g. for a good writeup or a retest
+type ReportBonus struct {
+	gorm.Model
+	ReportID int       `json:"report"`
+	Amount   float64   `json:"amount" gorm:"type:numeric(12,2)"`
+	Currency string    `json:"currency"`
+	Reason   string    `json:"reason"`
+	PaidAt   time.Time `json:"paidat"`
+}
+
+// Earnings is the total paid out by a program or platform in one currency
+type Earnings struct {
+	ID       string  `json:"id"`
+	Currency string  `json:"currency"`
+	Reports  int     `json:"reports"`
+	Bounties float64 `json:"bounties"`
+	Bonuses  float64 `json:"bonuses"`
+	Total    float64 `json:"total"`
+}
+
+// reportStates are the states a report can be in on the platform
+var reportStates = []string{"new", "triaged", "resolved", "informative", "not_applicable", "duplicate"}
+
+// reportUpdate holds the fields of a report that can be changed through the API, fields that are nil are left alone
+type reportUpdate struct {
+	PlatformReportID *string    `json:"platformreportid"`
+	SubmittedAt      *time.Time `json:"submittedat"`
+	State            *string    `json:"state"`
+	Bounty           *float64   `json:"bounty"`
+	Currency         *string    `json:"currency"`
+	Vulns            *[]*Vuln   `json:"vulns"`
+}
+
+// Get all reports. These can be filtered with ?program=, ?platform= and ?state=
+func getReports(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	query := db
+	for _, filter := range []string{"program", "platform", "state"} {
+		if value := r.URL.Query().Get(filter); value != "" {
+			column := filter
+			if filter != "state" {
+				column = filter + "_id"
+			}
+			query = query.Where(column+" = ?", value)
+		}
+	}
+	var reports []Report
+	query.Preload("Bonuses").Find(&reports)
+	json.NewEncoder(w).Encode(reports)
+}
+
+// Get a specific report
+func getReport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var report Report
+	vars := mux.Vars(r)
+	db.Where("ID = ?", vars["id"]).Preload("Bonuses").Preload("Vulns").Find(&report)
+	json.NewEncoder(w).Encode(&report)
+}
+
+// Create a new report
+func createReport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var report Report
+	_ = json.NewDecoder(r.Body).Decode(&report)
+
+	var program Program
+	err := db.Where("id = ?", report.ProgramID).First(&program).Error
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Program %q does not exist.", report.ProgramID))
+		return
+	}
+	if report.PlatformID == "" {
+		report.PlatformID = program.PlatformID
+	}
+	if report.State == "" {
+		report.State = "new"
+	}
+	if !contains(reportStates, report.State) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Unknown report state %q.", report.State))
+		return
+	}
+	if report.SubmittedAt.IsZero() {
+		report.SubmittedAt = time.Now()
+	}
+	if report.Currency == "" {
+		report.Currency = "USD"
+	}
+
+	vulns := report.Vulns
+	report.Vulns = nil
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(&report).Error
+		if err != nil {
+			return err
+		}
+		return linkReportVulns(tx, report.ID, vulns)
+	})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	db.Where("ID = ?", report.ID).Preload("Bonuses").Preload("Vulns").Find(&report)
+	json.NewEncoder(w).Encode(report)
+}
+
+// Updates a report. Only the fields present in the request body are changed, and if vulns are given they replace the
+// report's existing vulns.
+func updateReport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	vars := mux.Vars(r)
+	var report Report
+	err := db.Where("ID = ?", vars["id"]).First(&report).Error
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Report not found.")
+		return
+	}
+
+	var update reportUpdate
+	_ = json.NewDecoder(r.Body).Decode(&update)
+	updates := make(map[string]interface{})
+	if update.PlatformReportID != nil {
+		updates["platform_report_id"] = *update.PlatformReportID
+	}
+	if update.SubmittedAt != nil {
+		updates["submitted_at"] = *update.SubmittedAt
+	}
+	if update.State != nil {
+		if !contains(reportStates, *update.State) {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Unknown report state %q.", *update.State))
+			return
+		}
+		updates["state"] = *update.State
+	}
+	if update.Bounty != nil {
+		updates["bounty"] = *update.Bounty
+	}
+	if update.Currency != nil {
+		updates["currency"] = *update.Currency
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if len(updates) > 0 {
+			err := tx.Model(&report).Updates(updates).Error
+			if err != nil {
+				return err
+			}
+		}
+		if update.Vulns == nil {
+			return nil
+		}
+		err := tx.Exec("DELETE FROM report_vulns WHERE report_id = ?", report.ID).Error
+		if err != nil {
+			return err
+		}
+		return linkReportVulns(tx, report.ID, *update.Vulns)
+	})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	db.Where("ID = ?", report.ID).Preload("Bonuses").Preload("Vulns").Find(&report)
+	json.NewEncoder(w).Encode(report)
+}
+
+// linkReportVulns links existing vulns to a report. The join rows are written directly, because letting gorm save the
+// association would run the vulns' create hooks and send out notifications again.
+func linkReportVulns(tx *gorm.DB, reportID int, vulns []*Vuln) error {
+	for _, vuln := range vulns {
+		var count int64
+		tx.Model(&Vuln{}).Where("id = ?", vuln.ID).Count(&count)
+		if count == 0 {
+			return fmt.Errorf("vuln %d does not exist", vuln.ID)
+		}
+		err := tx.Exec("INSERT INTO report_vulns (report_id, vuln_id) VALUES (?, ?) ON CONFLICT DO NOTHING", reportID, vuln.ID).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deletes a report
+func deleteReport(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	var report Report
+	db.Where("ID = ?", id).Find(&report)
+	deleteReportLocal(report)
+	var reports []Report
+	db.Find(&reports)
+	json.NewEncoder(w).Encode(reports)
+}
+
+// Deletes relationships and then removes the model
+func deleteReportLocal(report Report) {
+	db.Exec("DELETE FROM report_vulns WHERE report_id = ?", report.ID)
+	db.Unscoped().Where("report_id = ?", report.ID).Delete(&ReportBonus{})
+	db.Unscoped().Delete(&report)
+}
+
+// Adds a bonus payout to a report
+func createReportBonus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	vars := mux.Vars(r)
+	var report Report
+	err := db.Where("ID = ?", vars["id"]).First(&report).Error
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Report not found.")
+		return
+	}
+
+	var bonus ReportBonus
+	_ = json.NewDecoder(r.Body).Decode(&bonus)
+	if bonus.Amount <= 0 {
+		writeError(w, http.StatusBadRequest, "Bonus amount must be more than 0.")
+		return
+	}
+	bonus.ReportID = report.ID
+	if bonus.Currency == "" {
+		bonus.Currency = report.Currency
+	}
+	if bonus.PaidAt.IsZero() {
+		bonus.PaidAt = time.Now()
+	}
+	db.Create(&bonus)
+	json.NewEncoder(w).Encode(bonus)
+}
+
+// Get the total bounties and bonuses paid out per program and per platform, in each currency
+func getEarnings(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var reports []Report
+	db.Preload("Bonuses").Find(&reports)
+
+	programs := make(map[string]*Earnings)
+	platforms := make(map[string]*Earnings)
+	for _, report := range reports {
+		addReportEarnings(programs, report.ProgramID, report)
+		addReportEarnings(platforms, report.PlatformID, report)
+	}
+
+	json.NewEncoder(w).Encode(map[string][]Earnings{
+		"programs":  sortedEarnings(programs),
+		"platforms": sortedEarnings(platforms),
+	})
+}
+
+// addReportEarnings adds the bounty and bonuses of a report to the running totals for id
+func addReportEarnings(totals map[string]*Earnings, id string, report Report) {
+	if report.Bounty > 0 {
+		earnings := earningsFor(totals, id, report.Currency)
+		earnings.Reports++
+		earnings.Bounties += report.Bounty
+		earnings.Total += report.Bounty
+	}
+	for _, bonus := range report.Bonuses {
+		earnings := earningsFor(totals, id, bonus.Currency)
+		earnings.Bonuses += bonus.Amount
+		earnings.Total += bonus.Amount
+	}
+}
+
+// earningsFor gets the running totals for id in a currency, starting them if they don't exist yet
+func earningsFor(totals map[string]*Earnings, id string, currency string) *Earnings {
+	key := id + "/" + currency
+	if totals[key] == nil {
+		totals[key] = &Earnings{ID: id, Currency: currency}
+	}
+	return totals[key]
+}
+
+// sortedEarnings turns running totals into a list ordered by id and currency, rounded to cents
+func sortedEarnings(totals map[string]*Earnings) []Earnings {
+	earnings := []Earnings{}
+	for _, e := range totals {
+		e.Bounties = math.Round(e.Bounties*100) / 100
+		e.Bonuses = math.Round(e.Bonuses*100) / 100
+		e.Total = math.Round(e.Total*100) / 100
+		earnings = append(earnings, *e)
+	}
+	sort.Slice(earnings, func(i, j int) bool {
+		if earnings[i].ID != earnings[j].ID {
+			return earnings[i].ID < earnings[j].ID
+		}
+		return earnings[i].Currency < earnings[j].Currency
+	})
+	return earnings
+}
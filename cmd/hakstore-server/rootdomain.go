@@ -2,7 +2,11 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"gorm.io/gorm"
@@ -11,16 +15,109 @@ import (
 // RootDomain is a structure to store details about bug bounty rootdomains
 type RootDomain struct {
 	gorm.Model
-	ID         string      `json:"id" gorm:"PrimaryKey"`
-	ProgramID  string      `json:"program"`
-	Subdomains []Subdomain `json:"subdomains"`
+	ID              string      `json:"id" gorm:"PrimaryKey"`
+	ProgramID       string      `json:"program"`
+	Registrar       string      `json:"registrar"`
+	RegistrantOrg   string      `json:"registrantorg" gorm:"index"`
+	RegistrantEmail string      `json:"registrantemail" gorm:"index"`
+	CreationDate    *time.Time  `json:"creationdate"`
+	ExpiryDate      *time.Time  `json:"expirydate" gorm:"index"`
+	Nameservers     StringList  `json:"nameservers"`
+	WhoisUpdatedAt  *time.Time  `json:"whoisupdatedat"`
+	Subdomains      []Subdomain `json:"subdomains"`
 }
 
-// Get all RootDomains
+// findRootDomain finds the stored rootdomain that a normalised hostname falls under. Every parent of the name down
+// to its registrable domain (according to the public suffix list) is a candidate and the most specific one wins, so
+// nested rootdomains like corp.example.co.uk are preferred over example.co.uk.
+func findRootDomain(name string) (RootDomain, error) {
+	var rootdomain RootDomain
+	var registrable string
+	extract := tldomainsCache.Parse(name)
+	if extract.Root != "" && extract.Suffix != "" {
+		registrable = extract.Root + "." + extract.Suffix
+	}
+
+	var candidates []string
+	candidate := name
+	for strings.Contains(candidate, ".") {
+		candidates = append(candidates, candidate)
+		if candidate == registrable {
+			break
+		}
+		candidate = candidate[strings.Index(candidate, ".")+1:]
+	}
+
+	var rootdomains []RootDomain
+	if len(candidates) > 0 {
+		db.Where("id IN ?", candidates).Find(&rootdomains)
+	}
+	if len(rootdomains) == 0 {
+		if registrable == "" {
+			return rootdomain, fmt.Errorf("no rootdomain exists for %s", name)
+		}
+		return rootdomain, fmt.Errorf("no rootdomain exists for %s, create %s (or a more specific rootdomain) first", name, registrable)
+	}
+	for _, r := range rootdomains {
+		if len(r.ID) > len(rootdomain.ID) {
+			rootdomain = r
+		}
+	}
+	return rootdomain, nil
+}
+
+// rootDomainFinder finds the rootdomains of many hostnames within one request, the same way findRootDomain does, but
+// looks up the rootdomains under each registrable domain only once
+type rootDomainFinder map[string][]RootDomain
+
+func (f rootDomainFinder) find(name string) (RootDomain, error) {
+	extract := tldomainsCache.Parse(name)
+	if extract.Root == "" || extract.Suffix == "" {
+		return findRootDomain(name)
+	}
+	registrable := extract.Root + "." + extract.Suffix
+	rootdomains, ok := f[registrable]
+	if !ok {
+		db.Where("id = ? OR id LIKE ?", registrable, "%."+escapeLike(registrable)).Find(&rootdomains)
+		f[registrable] = rootdomains
+	}
+	var rootdomain RootDomain
+	for _, r := range rootdomains {
+		if isUnderDomain(name, r.ID) && len(r.ID) > len(rootdomain.ID) {
+			rootdomain = r
+		}
+	}
+	if rootdomain.ID == "" {
+		return rootdomain, fmt.Errorf("no rootdomain exists for %s, create %s (or a more specific rootdomain) first", name, registrable)
+	}
+	return rootdomain, nil
+}
+
+// Get all RootDomains. These can be filtered with ?registrar=, ?registrantorg=, ?registrantemail= and
+// ?expiring=days, which returns the rootdomains that expire within that many days, soonest first
 func getRootDomains(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
+	query := db
+	filters := map[string]string{
+		"registrar":       "registrar",
+		"registrantorg":   "registrant_org",
+		"registrantemail": "registrant_email",
+	}
+	for filter, column := range filters {
+		if value := r.URL.Query().Get(filter); value != "" {
+			query = query.Where("LOWER("+column+") = LOWER(?)", strings.TrimSpace(value))
+		}
+	}
+	if expiring := r.URL.Query().Get("expiring"); expiring != "" {
+		days, err := strconv.Atoi(expiring)
+		if err != nil || days < 0 {
+			writeError(w, http.StatusBadRequest, "expiring must be a number of days")
+			return
+		}
+		query = query.Where("expiry_date < ?", time.Now().AddDate(0, 0, days)).Order("expiry_date")
+	}
 	var rootdomains []RootDomain
-	db.Find(&rootdomains)
+	query.Find(&rootdomains)
 	json.NewEncoder(w).Encode(rootdomains)
 }
 
@@ -38,6 +135,12 @@ func createRootDomain(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var rootdomain RootDomain
 	_ = json.NewDecoder(r.Body).Decode(&rootdomain)
+	name, _, err := normaliseHostname(rootdomain.ID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	rootdomain.ID = name
 	db.FirstOrCreate(&rootdomain)
 	json.NewEncoder(w).Encode(rootdomain)
 }
@@ -30,6 +30,8 @@ func defineRoutes(r *mux.Router) {
 	r.HandleFunc("/api/rootdomains/{id}", updateRootDomain).Methods("PUT")
 	r.HandleFunc("/api/rootdomains/{id}", deleteRootDomain).Methods("DELETE")
 	r.HandleFunc("/api/rootdomains/{id}/subdomains", getAssociatedSubdomains).Methods("GET")
+	r.HandleFunc("/api/rootdomains/{id}/related", getRelatedRootDomains).Methods("GET")
+	r.HandleFunc("/api/whois", createWhois).Methods("POST")
 
 	// Subdomain routes
 	r.HandleFunc("/api/subdomains", getSubdomains).Methods("GET")
@@ -39,6 +41,14 @@ func defineRoutes(r *mux.Router) {
 	r.HandleFunc("/api/subdomains/{id}", deleteSubdomain).Methods("DELETE")
 	r.HandleFunc("/api/subdomains/recent/{minutes}", getRecentSubdomains).Methods("GET")
 	r.HandleFunc("/api/subdomains/{id}/ips", associateIPWithSubdomain).Methods("POST")
+	r.HandleFunc("/api/subdomains/{id}/dns", refreshSubdomainDNS).Methods("POST")
+	r.HandleFunc("/api/subdomains/{id}/takeover", checkSubdomainTakeover).Methods("POST")
+
+	// Takeover routes
+	r.HandleFunc("/api/takeover", checkTakeovers).Methods("POST")
+	r.HandleFunc("/api/takeover/jobs/{id}", getTakeoverJob).Methods("GET")
+	r.HandleFunc("/api/takeover/fingerprints", getTakeoverFingerprints).Methods("GET")
+	r.HandleFunc("/api/takeover/fingerprints/reload", reloadTakeoverFingerprints).Methods("POST")
 
 	// IP routes
 	r.HandleFunc("/api/ips", getIPs).Methods("GET")
@@ -46,6 +56,25 @@ func defineRoutes(r *mux.Router) {
 	r.HandleFunc("/api/ips/{id}", getIP).Methods("GET")
 	r.HandleFunc("/api/ips/{id}", updateIP).Methods("PUT")
 	r.HandleFunc("/api/ips/{id}", deleteIP).Methods("DELETE")
+	r.HandleFunc("/api/ips/{id}/subdomains", getIPSubdomains).Methods("GET")
+
+	// Port routes
+	r.HandleFunc("/api/ports", getPorts).Methods("GET")
+	r.HandleFunc("/api/ports/{id}", deletePort).Methods("DELETE")
+
+	// IP range routes
+	r.HandleFunc("/api/ipranges", getIPRanges).Methods("GET")
+	r.HandleFunc("/api/ipranges", createIPRanges).Methods("POST")
+	r.HandleFunc("/api/ipranges/{id}", getIPRange).Methods("GET")
+	r.HandleFunc("/api/ipranges/{id}", deleteIPRange).Methods("DELETE")
+
+	// DNS record routes
+	r.HandleFunc("/api/dnsrecords", getDNSRecords).Methods("GET")
+	r.HandleFunc("/api/dnsrecords/{id}", deleteDNSRecord).Methods("DELETE")
+
+	// Scope routes
+	r.HandleFunc("/api/scope", getScopeTargets).Methods("GET")
+	r.HandleFunc("/api/scope/{id}", deleteScopeTarget).Methods("DELETE")
 
 	// Vuln routes
 	r.HandleFunc("/api/vulns", getVulns).Methods("GET")
@@ -54,6 +83,48 @@ func defineRoutes(r *mux.Router) {
 	r.HandleFunc("/api/vulns/{id}", updateVuln).Methods("PUT")
 	r.HandleFunc("/api/vulns/{id}", deleteVuln).Methods("DELETE")
 
+	// Report routes
+	r.HandleFunc("/api/reports", getReports).Methods("GET")
+	r.HandleFunc("/api/reports", createReport).Methods("POST")
+	r.HandleFunc("/api/reports/{id}", getReport).Methods("GET")
+	r.HandleFunc("/api/reports/{id}", updateReport).Methods("PUT")
+	r.HandleFunc("/api/reports/{id}", deleteReport).Methods("DELETE")
+	r.HandleFunc("/api/reports/{id}/bonuses", createReportBonus).Methods("POST")
+	r.HandleFunc("/api/earnings", getEarnings).Methods("GET")
+
+	// Endpoint routes
+	r.HandleFunc("/api/endpoints", getEndpoints).Methods("GET")
+	r.HandleFunc("/api/endpoints", createEndpoints).Methods("POST")
+	r.HandleFunc("/api/endpoints/{id}", getEndpoint).Methods("GET")
+	r.HandleFunc("/api/endpoints/{id}", deleteEndpoint).Methods("DELETE")
+
+	// Certificate routes
+	r.HandleFunc("/api/certificates", getCertificates).Methods("GET")
+	r.HandleFunc("/api/certificates", createCertificates).Methods("POST")
+	r.HandleFunc("/api/certificates/unknown", getUnknownCertificateNames).Methods("GET")
+	r.HandleFunc("/api/certificates/{id}", getCertificate).Methods("GET")
+	r.HandleFunc("/api/certificates/{id}", deleteCertificate).Methods("DELETE")
+
+	// Cloud asset routes
+	r.HandleFunc("/api/cloudassets", getCloudAssets).Methods("GET")
+	r.HandleFunc("/api/cloudassets", createCloudAssets).Methods("POST")
+	r.HandleFunc("/api/cloudassets/{id}", getCloudAsset).Methods("GET")
+	r.HandleFunc("/api/cloudassets/{id}", updateCloudAsset).Methods("PUT")
+	r.HandleFunc("/api/cloudassets/{id}", deleteCloudAsset).Methods("DELETE")
+
+	// Graph routes
+	r.HandleFunc("/api/graph", getGraph).Methods("GET")
+
+	// Import routes
+	r.HandleFunc("/api/import/amass", importAmass).Methods("POST")
+	r.HandleFunc("/api/import/nuclei", importNuclei).Methods("POST")
+	r.HandleFunc("/api/import/nmap", importNmap).Methods("POST")
+	r.HandleFunc("/api/import/masscan", importMasscan).Methods("POST")
+	r.HandleFunc("/api/import/scope", importScope).Methods("POST")
+	r.HandleFunc("/api/import/zone", importZone).Methods("POST")
+	r.HandleFunc("/api/import/ctlog", importCTLog).Methods("POST")
+	r.HandleFunc("/api/import/burp", importBurp).Methods("POST")
+
 	// Job routes
 	r.HandleFunc("/api/jobs", createJobs).Methods("POST")
 }
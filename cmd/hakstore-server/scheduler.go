@@ -1,29 +1,38 @@
-// currently this is just the example from https://github.com/go-co-op/gocron - going to update to do proper scheduled tasks
-
 package main
 
 import (
-	"fmt"
+	"log"
 	"time"
 
 	"github.com/go-co-op/gocron"
 )
 
-func task() {
-	fmt.Println("I am running task.")
-}
-
-func taskWithParams(a int, b string) {
-	fmt.Println(a, b)
-}
-
-func example() {
+// startScheduler starts the scheduled tasks in the background. Stale subdomains are marked every hour, and the daily
+// alerts run at the time set in the alerts section of the config file, or 09:00 if it isn't set.
+func startScheduler() {
 	location, err := time.LoadLocation(config.Database.TimeZone)
 	if err != nil {
-		print("Error occured, most likely due to an invalid location in the config file:", err)
+		log.Println("Error loading the timezone for scheduled alerts, most likely due to an invalid location in the config file:", err)
+		location = time.Local
+	}
+	at := config.Alerts.Time
+	if at == "" {
+		at = "09:00"
 	}
 
+	// the stale check runs hourly, so catch up on anything that went stale while the server was down
+	markStaleSubdomains()
+
 	s := gocron.NewScheduler(location)
-	s.Every(1).Day().At("19:46:00").Do(task)
+	_, err = s.Every(1).Day().At(at).Do(notifyExpiringRootDomains)
+	if err != nil {
+		log.Println("Error scheduling rootdomain expiry alerts:", err)
+		return
+	}
+	_, err = s.Every(1).Hour().Do(markStaleSubdomains)
+	if err != nil {
+		log.Println("Error scheduling stale subdomain checks:", err)
+		return
+	}
 	s.StartAsync()
 }
@@ -0,0 +1,617 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// The kinds of scope target. Domains and wildcards become rootdomains and CIDRs become IP ranges when they are in
+// scope, other targets like mobile apps are only recorded.
+const (
+	ScopeDomain   = "domain"
+	ScopeWildcard = "wildcard"
+	ScopeCIDR     = "cidr"
+	ScopeOther    = "other"
+)
+
+// ScopeTarget is an entry in a program's scope as the platform lists it, e.g. *.tesla.com or 10.0.0.0/8. Targets
+// that are out of scope are kept too, so names and addresses the program has excluded can be skipped.
+type ScopeTarget struct {
+	gorm.Model
+	ID          int    `json:"id" gorm:"PrimaryKey;autoIncrement"`
+	ProgramID   string `json:"program" gorm:"uniqueIndex:idx_scope_targets_program_target"`
+	Target      string `json:"target" gorm:"uniqueIndex:idx_scope_targets_program_target"`
+	Type        string `json:"type"`
+	InScope     bool   `json:"inscope"`
+	Bounty      bool   `json:"bounty"`
+	Description string `json:"description"`
+}
+
+// ScopeChange is a difference between a program's stored scope and the scope being imported
+type ScopeChange struct {
+	Program string `json:"program"`
+	Target  string `json:"target"`
+	Type    string `json:"type"`
+	InScope bool   `json:"inscope"`
+	Change  string `json:"change"`
+}
+
+// Get all scope targets. These can be filtered with ?program=, ?type= and ?inscope=true or false
+func getScopeTargets(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	query := db
+	if program := r.URL.Query().Get("program"); program != "" {
+		query = query.Where("program_id = ?", program)
+	}
+	if targetType := r.URL.Query().Get("type"); targetType != "" {
+		query = query.Where("type = ?", targetType)
+	}
+	if inScope := r.URL.Query().Get("inscope"); inScope != "" {
+		query = query.Where("in_scope = ?", inScope == "true")
+	}
+	var targets []ScopeTarget
+	query.Order("program_id, target").Find(&targets)
+	json.NewEncoder(w).Encode(targets)
+}
+
+// Deletes a scope target. The rootdomain or IP range it created is left alone.
+func deleteScopeTarget(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	db.Unscoped().Where("ID = ?", vars["id"]).Delete(&ScopeTarget{})
+	var targets []ScopeTarget
+	db.Find(&targets)
+	json.NewEncoder(w).Encode(targets)
+}
+
+// outOfScope finds the out of scope target of a program that excludes a hostname or IP, if there is one. Wildcards
+// exclude the names under them, domains only exclude themselves and CIDRs exclude the addresses inside them. The
+// importers skip excluded names, and the batch create endpoints reject subdomains and program IPs that are excluded.
+func outOfScope(program string, host string) (ScopeTarget, bool) {
+	return excludedBy(outOfScopeTargets(program), host)
+}
+
+// outOfScopeTargets are the targets a program lists as out of scope, for checking many hosts with excludedBy
+func outOfScopeTargets(program string) []ScopeTarget {
+	var targets []ScopeTarget
+	if program != "" {
+		db.Where("program_id = ? AND in_scope = ? AND type IN ?", program, false, []string{ScopeDomain, ScopeWildcard, ScopeCIDR}).Find(&targets)
+	}
+	return targets
+}
+
+// excludedBy finds the out of scope target that excludes a hostname or IP, see outOfScope
+func excludedBy(targets []ScopeTarget, host string) (ScopeTarget, bool) {
+	addr, err := parseIP(host)
+	isIP := err == nil
+	for _, target := range targets {
+		switch target.Type {
+		case ScopeCIDR:
+			prefix, err := netip.ParsePrefix(target.Target)
+			if isIP && err == nil && prefix.Contains(addr) {
+				return target, true
+			}
+		case ScopeDomain:
+			if !isIP && host == target.Target {
+				return target, true
+			}
+		case ScopeWildcard:
+			domain := strings.TrimPrefix(target.Target, "*.")
+			if !isIP && host != domain && isUnderDomain(host, domain) {
+				return target, true
+			}
+		}
+	}
+	return ScopeTarget{}, false
+}
+
+// scopeProgram is a program and its scope read from a platform's export
+type scopeProgram struct {
+	ID       string
+	Name     string
+	URL      string
+	Platform string
+	Type     string
+	Targets  []ScopeTarget
+}
+
+// scopeObject is a JSON object from a scope export. The platforms use different names for the same things, so
+// fields are looked up by a list of candidate names.
+type scopeObject map[string]interface{}
+
+// text returns the first of the keys that has a non-empty value, as a string. Some platforms wrap values in an
+// object like {"id": 1, "value": "Wildcard"}.
+func (o scopeObject) text(keys ...string) string {
+	for _, key := range keys {
+		switch value := o[key].(type) {
+		case string:
+			if value = strings.TrimSpace(value); value != "" {
+				return value
+			}
+		case float64:
+			return strconv.FormatFloat(value, 'f', -1, 64)
+		case map[string]interface{}:
+			if text := scopeObject(value).text("value", "name"); text != "" {
+				return text
+			}
+		}
+	}
+	return ""
+}
+
+// flag returns the first of the keys that holds a true or false value, written as a JSON boolean or as text
+func (o scopeObject) flag(keys ...string) (bool, bool) {
+	for _, key := range keys {
+		switch value := o[key].(type) {
+		case bool:
+			return value, true
+		case string:
+			switch strings.ToLower(strings.TrimSpace(value)) {
+			case "true", "yes", "y", "1":
+				return true, true
+			case "false", "no", "n", "0":
+				return false, true
+			}
+		}
+	}
+	return false, false
+}
+
+// list returns the objects in a list field, e.g. the targets of a program
+func (o scopeObject) list(key string) []scopeObject {
+	var objects []scopeObject
+	switch value := o[key].(type) {
+	case []interface{}:
+		for _, item := range value {
+			if object, ok := item.(map[string]interface{}); ok {
+				objects = append(objects, scopeObject(object))
+			}
+		}
+	case map[string]interface{}:
+		// paged APIs wrap the list, e.g. {"content": [...]}
+		for _, inner := range []string{"content", "data", "items"} {
+			if objects = scopeObject(value).list(inner); len(objects) > 0 {
+				break
+			}
+		}
+	}
+	return objects
+}
+
+// scopeTargetTypes are words in a platform's asset type that mean the target is a host, network or URL, anything
+// else (mobile apps, source code, hardware) is recorded as other
+var scopeTargetTypes = []string{"url", "wildcard", "website", "web", "api", "domain", "cidr", "ip", "network"}
+
+// scopeTargets reads the targets of a scope entry. HackerOne sometimes lists several hosts in one identifier, so
+// host targets are split on commas and whitespace.
+func scopeTargets(entry scopeObject, inScope bool, bounty bool) []ScopeTarget {
+	if attributes, ok := entry["attributes"].(map[string]interface{}); ok {
+		entry = scopeObject(attributes)
+	}
+	identifier := entry.text("asset_identifier", "identifier", "endpoint", "target", "uri", "name")
+	if identifier == "" {
+		return nil
+	}
+	hint := strings.ToLower(entry.text("asset_type", "type", "category"))
+	description := entry.text("instruction", "description")
+
+	if eligible, ok := entry.flag("eligible_for_submission", "in_scope", "inscope"); ok {
+		inScope = eligible
+	}
+	if eligible, ok := entry.flag("eligible_for_bounty", "bounty"); ok {
+		bounty = eligible
+	}
+	if tier := strings.ToLower(entry.text("tier")); tier != "" {
+		inScope = tier != "out of scope"
+		bounty = inScope && tier != "no bounty"
+	}
+	if !inScope {
+		bounty = false
+	}
+
+	hostLike := hint == ""
+	for _, word := range scopeTargetTypes {
+		if strings.Contains(hint, word) {
+			hostLike = true
+		}
+	}
+	identifiers := []string{identifier}
+	if hostLike {
+		identifiers = strings.FieldsFunc(identifier, func(r rune) bool { return r == ',' || r == ' ' || r == '\n' || r == '\t' })
+	}
+
+	var targets []ScopeTarget
+	for _, identifier := range identifiers {
+		target, targetType := identifier, ScopeOther
+		if hostLike {
+			target, targetType = classifyScopeTarget(identifier)
+		}
+		targets = append(targets, ScopeTarget{Target: target, Type: targetType, InScope: inScope, Bounty: bounty, Description: description})
+	}
+	return targets
+}
+
+// classifyScopeTarget works out what kind of target a host-like scope entry is, and normalises it. URLs are cut down
+// to their hostname and CIDRs are masked. Entries that can't be read, like *.tesla.*, are kept as written.
+func classifyScopeTarget(identifier string) (string, string) {
+	host := identifier
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	if prefix, err := netip.ParsePrefix(host); err == nil {
+		if prefix.Addr().Is4In6() {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		return prefix.Masked().String(), ScopeCIDR
+	}
+	if i := strings.IndexAny(host, "/?#"); i >= 0 {
+		host = host[:i]
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if addr, err := parseIP(host); err == nil {
+		return netip.PrefixFrom(addr, addr.BitLen()).String(), ScopeCIDR
+	}
+	name, wildcard, err := normaliseHostname(host)
+	if err != nil {
+		return identifier, ScopeOther
+	}
+	if wildcard {
+		return "*." + name, ScopeWildcard
+	}
+	return name, ScopeDomain
+}
+
+// scopeProgramFromJSON reads a program in the bounty-targets-data format, which every platform's file shares:
+// {"name": ..., "url": ..., "targets": {"in_scope": [...], "out_of_scope": [...]}}
+func scopeProgramFromJSON(object scopeObject, platform string) scopeProgram {
+	program := scopeProgram{Name: object.text("name"), URL: object.text("url"), Platform: platform}
+	program.ID = strings.ToLower(object.text("handle", "company_handle", "code", "slug"))
+	if u, err := url.Parse(program.URL); err == nil {
+		if program.ID == "" {
+			segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+			program.ID = strings.ToLower(segments[len(segments)-1])
+		}
+		if program.Platform == "" {
+			labels := strings.Split(u.Hostname(), ".")
+			if len(labels) >= 2 {
+				program.Platform = labels[len(labels)-2]
+			}
+		}
+	}
+	if program.ID == "" {
+		program.ID = strings.ToLower(strings.Join(strings.Fields(program.Name), "-"))
+	}
+
+	bounty, ok := object.flag("offers_bounties", "offers_awards")
+	if !ok {
+		payout, _ := strconv.ParseFloat(object.text("max_payout", "max_bounty", "min_bounty"), 64)
+		bounty = payout > 0
+	}
+	program.Type = "public"
+	if !bounty {
+		program.Type = "vdp"
+	}
+
+	targets, _ := object["targets"].(map[string]interface{})
+	for _, entry := range scopeObject(targets).list("in_scope") {
+		program.Targets = append(program.Targets, scopeTargets(entry, true, bounty)...)
+	}
+	for _, entry := range scopeObject(targets).list("out_of_scope") {
+		program.Targets = append(program.Targets, scopeTargets(entry, false, false)...)
+	}
+	return program
+}
+
+// parseScope reads a scope export. It understands the bounty-targets-data JSON files (a list of programs with their
+// targets), HackerOne's structured scope CSV and API JSON, Bugcrowd's target groups and Intigriti's domains, along
+// with CSVs that have target/type/in scope style columns. Exports of a single program's scope don't name the
+// program, so they are given the program passed in.
+func parseScope(data []byte, program string, platform string) ([]scopeProgram, error) {
+	data = bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	single := scopeProgram{ID: program, Platform: platform}
+
+	switch {
+	case bytes.HasPrefix(data, []byte("[")):
+		var list []map[string]interface{}
+		err := json.Unmarshal(data, &list)
+		if err != nil {
+			return nil, err
+		}
+		if len(list) > 0 {
+			if _, ok := list[0]["targets"]; ok {
+				var programs []scopeProgram
+				for _, object := range list {
+					programs = append(programs, scopeProgramFromJSON(scopeObject(object), platform))
+				}
+				return programs, nil
+			}
+		}
+		for _, entry := range list {
+			single.Targets = append(single.Targets, scopeTargets(scopeObject(entry), true, true)...)
+		}
+
+	case bytes.HasPrefix(data, []byte("{")):
+		var object scopeObject
+		err := json.Unmarshal(data, &object)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := object["targets"].(map[string]interface{}); ok {
+			found := scopeProgramFromJSON(object, platform)
+			if program != "" {
+				found.ID = program
+			}
+			return []scopeProgram{found}, nil
+		}
+		entries := object.list("data")
+		if relationships, ok := object["relationships"].(map[string]interface{}); ok {
+			if scopes, ok := relationships["structured_scopes"].(map[string]interface{}); ok {
+				entries = append(entries, scopeObject(scopes).list("data")...)
+			}
+		}
+		entries = append(entries, object.list("domains")...)
+		for _, entry := range entries {
+			single.Targets = append(single.Targets, scopeTargets(entry, true, true)...)
+		}
+		for _, group := range object.list("groups") {
+			inScope, ok := group.flag("in_scope")
+			if !ok {
+				inScope = true
+			}
+			for _, entry := range group.list("targets") {
+				single.Targets = append(single.Targets, scopeTargets(entry, inScope, inScope)...)
+			}
+		}
+		for _, entry := range object.list("in_scope") {
+			single.Targets = append(single.Targets, scopeTargets(entry, true, true)...)
+		}
+		for _, entry := range object.list("out_of_scope") {
+			single.Targets = append(single.Targets, scopeTargets(entry, false, false)...)
+		}
+
+	default:
+		reader := csv.NewReader(bytes.NewReader(data))
+		reader.FieldsPerRecord = -1
+		records, err := reader.ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		if len(records) < 2 {
+			return nil, fmt.Errorf("the CSV has no targets")
+		}
+		header := records[0]
+		for i, column := range header {
+			header[i] = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(column)), " ", "_")
+		}
+		for _, record := range records[1:] {
+			entry := make(scopeObject)
+			for i, value := range record {
+				if i < len(header) {
+					entry[header[i]] = value
+				}
+			}
+			single.Targets = append(single.Targets, scopeTargets(entry, true, true)...)
+		}
+	}
+
+	if single.ID == "" {
+		return nil, fmt.Errorf("the export doesn't name its program, set one with ?program=")
+	}
+	return []scopeProgram{single}, nil
+}
+
+// importScopeProgram syncs a program's stored scope with the scope read from an export. The platform and program
+// are created if they don't exist, and in scope domains, wildcards and CIDRs become rootdomains and IP ranges of the
+// program. Targets that are no longer listed are reported as removed, and deleted along with their IP ranges when
+// prune is set. Rootdomains are never deleted, they hold the subdomains and vulns that were found under them.
+func importScopeProgram(found scopeProgram, prune bool, dryRun bool, summary *ImportSummary) {
+	if found.Platform != "" {
+		var platform Platform
+		if db.Where("id = ?", found.Platform).First(&platform).Error != nil {
+			summary.record("platforms", ImportCreated)
+			if !dryRun {
+				db.Create(&Platform{ID: found.Platform})
+			}
+		}
+	}
+
+	var program Program
+	if db.Where("id = ?", found.ID).First(&program).Error != nil {
+		program = Program{ID: found.ID, PlatformID: found.Platform, Name: found.Name, URL: found.URL, Type: found.Type, State: "active"}
+		summary.record("programs", ImportCreated)
+		if !dryRun {
+			err := db.Create(&program).Error
+			if err != nil {
+				summary.Rejected = append(summary.Rejected, Reject{Item: found.ID, Reason: err.Error()})
+				return
+			}
+		}
+	} else if (program.PlatformID == "" && found.Platform != "") || (program.URL == "" && found.URL != "") {
+		if program.PlatformID == "" {
+			program.PlatformID = found.Platform
+		}
+		if program.URL == "" {
+			program.URL = found.URL
+		}
+		summary.record("programs", ImportUpdated)
+		if !dryRun {
+			db.Model(&program).Select("platform_id", "url").Updates(&program)
+		}
+	}
+
+	// a target listed as both in and out of scope is treated as out of scope
+	wanted := make(map[string]ScopeTarget)
+	for _, target := range found.Targets {
+		target.ProgramID = found.ID
+		if existing, ok := wanted[target.Target]; ok && !existing.InScope {
+			continue
+		}
+		wanted[target.Target] = target
+	}
+	var stored []ScopeTarget
+	db.Where("program_id = ?", found.ID).Find(&stored)
+	storedTargets := make(map[string]ScopeTarget)
+	for _, target := range stored {
+		storedTargets[target.Target] = target
+	}
+
+	var names []string
+	for name := range wanted {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		target := wanted[name]
+		existing, ok := storedTargets[name]
+		change := ScopeChange{Program: found.ID, Target: target.Target, Type: target.Type, InScope: target.InScope}
+		switch {
+		case !ok:
+			change.Change = "added"
+			summary.record("scope", ImportCreated)
+			if !dryRun {
+				db.Create(&target)
+			}
+			summary.Changes = append(summary.Changes, change)
+		case existing.InScope != target.InScope || existing.Bounty != target.Bounty || existing.Type != target.Type || existing.Description != target.Description:
+			change.Change = "changed"
+			summary.record("scope", ImportUpdated)
+			if !dryRun {
+				db.Model(&existing).Select("in_scope", "bounty", "type", "description").Updates(&target)
+				// a CIDR that is no longer in scope takes its IP range with it
+				if !target.InScope || target.Type != ScopeCIDR {
+					removeScopeIPRange(existing)
+				}
+			}
+			summary.Changes = append(summary.Changes, change)
+		}
+		if target.InScope {
+			importScopeAsset(target, dryRun, summary)
+		}
+	}
+
+	sort.Slice(stored, func(i, j int) bool { return stored[i].Target < stored[j].Target })
+	for _, target := range stored {
+		if _, ok := wanted[target.Target]; ok {
+			continue
+		}
+		summary.Changes = append(summary.Changes, ScopeChange{Program: found.ID, Target: target.Target, Type: target.Type, InScope: target.InScope, Change: "removed"})
+		if !prune || dryRun {
+			continue
+		}
+		db.Unscoped().Delete(&target)
+		removeScopeIPRange(target)
+	}
+}
+
+// removeScopeIPRange deletes the IP range an in scope CIDR target created, when the target is removed or goes out of
+// scope, and updates the programs of the IPs inside it
+func removeScopeIPRange(target ScopeTarget) {
+	if target.Type != ScopeCIDR || !target.InScope {
+		return
+	}
+	db.Unscoped().Where("program_id = ? AND cidr = ?", target.ProgramID, target.Target).Delete(&IPRange{})
+	syncIPRangePrograms(target.Target)
+}
+
+// importScopeAsset creates the rootdomain or IP range for an in scope target, if the program doesn't have it yet.
+// Names that already fall under one of the program's rootdomains don't get their own, and a rootdomain that already
+// belongs to another program is left where it is.
+func importScopeAsset(target ScopeTarget, dryRun bool, summary *ImportSummary) {
+	switch target.Type {
+	case ScopeDomain, ScopeWildcard:
+		name := strings.TrimPrefix(target.Target, "*.")
+		var rootdomain RootDomain
+		if db.Where("id = ?", name).First(&rootdomain).Error == nil {
+			if rootdomain.ProgramID != target.ProgramID {
+				summary.skip("rootdomains", name, "already in program "+rootdomain.ProgramID)
+			}
+			return
+		}
+		if parent, err := findRootDomain(name); err == nil && parent.ProgramID == target.ProgramID {
+			return
+		}
+		summary.record("rootdomains", ImportCreated)
+		if !dryRun {
+			db.Create(&RootDomain{ID: name, ProgramID: target.ProgramID})
+		}
+
+	case ScopeCIDR:
+		var count int64
+		db.Model(&IPRange{}).Where("program_id = ? AND cidr = ?", target.ProgramID, target.Target).Count(&count)
+		if count > 0 {
+			return
+		}
+		summary.record("ipranges", ImportCreated)
+		if !dryRun {
+			ipRange := IPRange{CIDR: target.Target, ProgramID: target.ProgramID, Description: "from the program's scope"}
+			saved, err := saveIPRange(&ipRange)
+			if err != nil {
+				summary.Rejected = append(summary.Rejected, Reject{Item: target.Target, Reason: err.Error()})
+			} else if saved {
+				syncIPRangePrograms(ipRange.CIDR)
+			}
+		}
+	}
+}
+
+// Imports a program's scope as exported by a bug bounty platform, or a bounty-targets-data file with the public
+// scope of every program on a platform. ?platform= names the platform, which is otherwise worked out from the
+// program URLs. Exports of a single program need ?program= to say which program they are for, for files with many
+// programs it picks one out. Re-importing syncs the scope and reports what was added, changed and removed, and
+// ?prune=true deletes the targets that are no longer listed. ?dryrun=true reports the changes without storing them.
+func importScope(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	program := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("program")))
+	platform := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("platform")))
+	prune := r.URL.Query().Get("prune") == "true"
+	dryRun := r.URL.Query().Get("dryrun") == "true"
+	data, err := readImportBody(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	programs, err := parseScope(data, program, platform)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Could not read the scope: "+err.Error())
+		return
+	}
+
+	if program != "" && len(programs) > 1 {
+		var matching []scopeProgram
+		for _, found := range programs {
+			if found.ID == program || strings.EqualFold(found.Name, program) {
+				found.ID = program
+				matching = append(matching, found)
+			}
+		}
+		if len(matching) == 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Program %q isn't in the file.", program))
+			return
+		}
+		programs = matching
+	}
+
+	summary := newImportSummary()
+	summary.DryRun = dryRun
+	for _, found := range programs {
+		if found.ID == "" {
+			summary.Rejected = append(summary.Rejected, Reject{Item: found.Name, Reason: "program has no handle or URL to name it by"})
+			continue
+		}
+		importScopeProgram(found, prune, dryRun, &summary)
+	}
+	json.NewEncoder(w).Encode(summary)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClassifyScopeTarget(t *testing.T) {
+	tests := []struct {
+		identifier string
+		want       string
+		wantType   string
+	}{
+		{identifier: "www.Tesla.com", want: "www.tesla.com", wantType: ScopeDomain},
+		{identifier: "*.tesla.com", want: "*.tesla.com", wantType: ScopeWildcard},
+		{identifier: "https://shop.tesla.com:8443/cart?id=1", want: "shop.tesla.com", wantType: ScopeDomain},
+		{identifier: "10.1.2.3/8", want: "10.0.0.0/8", wantType: ScopeCIDR},
+		{identifier: "192.0.2.1", want: "192.0.2.1/32", wantType: ScopeCIDR},
+		{identifier: "2001:db8::1", want: "2001:db8::1/128", wantType: ScopeCIDR},
+		{identifier: "*.tesla.*", want: "*.tesla.*", wantType: ScopeOther},
+	}
+	for _, test := range tests {
+		t.Run(test.identifier, func(t *testing.T) {
+			got, gotType := classifyScopeTarget(test.identifier)
+			if got != test.want || gotType != test.wantType {
+				t.Errorf("classifyScopeTarget(%q) = %q, %q, want %q, %q", test.identifier, got, gotType, test.want, test.wantType)
+			}
+		})
+	}
+}
+
+func TestParseScope(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		program  string
+		platform string
+		want     []scopeProgram
+		wantErr  bool
+	}{
+		{
+			name: "bounty-targets-data",
+			data: `[{"name": "Tesla", "url": "https://hackerone.com/tesla", "offers_bounties": true, "targets": {
+				"in_scope": [{"asset_identifier": "*.tesla.com", "asset_type": "URL", "eligible_for_bounty": true}],
+				"out_of_scope": [{"asset_identifier": "shop.tesla.com", "asset_type": "URL"}]}}]`,
+			want: []scopeProgram{{
+				ID: "tesla", Name: "Tesla", URL: "https://hackerone.com/tesla", Platform: "hackerone", Type: "public",
+				Targets: []ScopeTarget{
+					{Target: "*.tesla.com", Type: ScopeWildcard, InScope: true, Bounty: true},
+					{Target: "shop.tesla.com", Type: ScopeDomain},
+				},
+			}},
+		},
+		{
+			name:     "hackerone CSV",
+			data:     "identifier,asset_type,instruction,eligible_for_bounty,eligible_for_submission\napi.tesla.com,URL,,true,true\n10.0.0.0/8,CIDR,,false,false\ncom.tesla.app,GOOGLE_PLAY_APP_ID,,true,true\n",
+			program:  "tesla",
+			platform: "hackerone",
+			want: []scopeProgram{{
+				ID: "tesla", Platform: "hackerone",
+				Targets: []ScopeTarget{
+					{Target: "api.tesla.com", Type: ScopeDomain, InScope: true, Bounty: true},
+					{Target: "10.0.0.0/8", Type: ScopeCIDR},
+					{Target: "com.tesla.app", Type: ScopeOther, InScope: true, Bounty: true},
+				},
+			}},
+		},
+		{
+			name:    "bugcrowd target groups",
+			data:    `{"groups": [{"in_scope": false, "targets": [{"name": "legacy.tesla.com", "category": "website"}]}]}`,
+			program: "tesla",
+			want: []scopeProgram{{
+				ID:      "tesla",
+				Targets: []ScopeTarget{{Target: "legacy.tesla.com", Type: ScopeDomain}},
+			}},
+		},
+		{
+			name:    "single program export without a program",
+			data:    "identifier,asset_type\napi.tesla.com,URL\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid JSON",
+			data:    `{"groups": [`,
+			program: "tesla",
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseScope([]byte(test.data), test.program, test.platform)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("parseScope() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseScope() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestExcludedBy(t *testing.T) {
+	targets := []ScopeTarget{
+		{Target: "shop.tesla.com", Type: ScopeDomain},
+		{Target: "*.corp.tesla.com", Type: ScopeWildcard},
+		{Target: "10.0.0.0/8", Type: ScopeCIDR},
+	}
+	tests := []struct {
+		host string
+		want string
+	}{
+		{host: "shop.tesla.com", want: "shop.tesla.com"},
+		{host: "www.shop.tesla.com"},
+		{host: "vpn.corp.tesla.com", want: "*.corp.tesla.com"},
+		{host: "corp.tesla.com"},
+		{host: "10.1.2.3", want: "10.0.0.0/8"},
+		{host: "192.0.2.1"},
+	}
+	for _, test := range tests {
+		t.Run(test.host, func(t *testing.T) {
+			target, excluded := excludedBy(targets, test.host)
+			if excluded != (test.want != "") || target.Target != test.want {
+				t.Errorf("excludedBy(%q) = %q, %v, want %q", test.host, target.Target, excluded, test.want)
+			}
+		})
+	}
+}
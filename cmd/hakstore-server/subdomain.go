@@ -2,10 +2,13 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"net/netip"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -16,25 +19,49 @@ import (
 // Subdomain is a structure to store details about bug bounty subdomains
 type Subdomain struct {
 	gorm.Model
-	ID           string `json:"id" gorm:"PrimaryKey"`
-	ProgramID    string `json:"program"`
-	RootDomainID string `json:"rootdomain"`
-	CNAME        string `json:"cname"`
-	Nameservers  string `json:"nameservers"`
-	IPs          []*IP  `json:"ips" gorm:"many2many:subdomain_ips;"`
+	ID           string     `json:"id" gorm:"PrimaryKey"`
+	ProgramID    string     `json:"program"`
+	RootDomainID string     `json:"rootdomain"`
+	Wildcard     bool       `json:"wildcard"`
+	CNAME        string     `json:"cname"`
+	Nameservers  string     `json:"nameservers"`
+	FirstSeen    time.Time  `json:"firstseen"`
+	LastSeen     time.Time  `json:"lastseen"`
+	LastResolved *time.Time `json:"lastresolved"`
+	Resolution   string     `json:"resolution" gorm:"index;default:unknown"`
+	Stale        bool       `json:"stale" gorm:"index"`
+	Sources      StringList `json:"sources"`
+	IPs          []*IP      `json:"ips" gorm:"many2many:subdomain_ips;"`
 }
 
+// The results of the last DNS lookup of a subdomain
+const (
+	ResolutionUnknown  = "unknown"
+	ResolutionResolves = "resolves"
+	ResolutionNXDomain = "nxdomain"
+	ResolutionServFail = "servfail"
+	ResolutionTimeout  = "timeout"
+)
+
+var resolutions = []string{ResolutionUnknown, ResolutionResolves, ResolutionNXDomain, ResolutionServFail, ResolutionTimeout}
+
 // BeforeCreate will associate the subdomain to the appropriate rootdomain, unless a specific rootdomain is specified
 func (s *Subdomain) BeforeCreate(tx *gorm.DB) (err error) {
+	now := time.Now()
+	if s.FirstSeen.IsZero() {
+		s.FirstSeen = now
+	}
+	if s.LastSeen.IsZero() {
+		s.LastSeen = now
+	}
+
 	// try to automatically determine the rootdomain if none are supplied
-	// if s.RootDomainID == "" {
-	// 	extract := tldomainsCache.Parse(s.ID)
-	// 	s.RootDomainID = extract.Root + "." + extract.Suffix
-	// 	var rootdomain RootDomain
-	// 	db.Where("ID = ?", s.RootDomainID).FirstOrInit(&rootdomain)
-	// 	rootdomain.ProgramID = s.ProgramID
-	// 	db.Save(&rootdomain)
-	// }
+	if s.RootDomainID == "" {
+		rootdomain, err := findRootDomain(s.ID)
+		if err == nil {
+			s.RootDomainID = rootdomain.ID
+		}
+	}
 
 	// set the ProgramID to the same as the ProgramID on the associated rootdomain
 	var rootdomain RootDomain
@@ -50,11 +77,51 @@ func (s *Subdomain) BeforeCreate(tx *gorm.DB) (err error) {
 // 	return nil
 // }
 
-// Get all Subdomains
+// Get all Subdomains. These can be filtered with ?program=, ?resolution=nxdomain,servfail, ?alive=true|false,
+// ?stale=true|false and ?source=. Alive subdomains are the ones that resolved on their last lookup.
 func getSubdomains(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
+	query := db
+	if program := r.URL.Query().Get("program"); program != "" {
+		query = query.Where("program_id = ?", program)
+	}
+	if resolution := r.URL.Query().Get("resolution"); resolution != "" {
+		values := strings.Split(resolution, ",")
+		for _, value := range values {
+			if !contains(resolutions, value) {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("Unknown resolution %q.", value))
+				return
+			}
+		}
+		query = query.Where("resolution IN ?", values)
+	}
+	if alive := r.URL.Query().Get("alive"); alive != "" {
+		isAlive, err := strconv.ParseBool(alive)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "alive must be true or false")
+			return
+		}
+		if isAlive {
+			query = query.Where("resolution = ?", ResolutionResolves)
+		} else {
+			query = query.Where("resolution IN ?", []string{ResolutionNXDomain, ResolutionServFail, ResolutionTimeout})
+		}
+	}
+	if stale := r.URL.Query().Get("stale"); stale != "" {
+		isStale, err := strconv.ParseBool(stale)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "stale must be true or false")
+			return
+		}
+		query = query.Where("stale = ?", isStale)
+	}
+	if source := r.URL.Query().Get("source"); source != "" {
+		// sources are stored as a JSON list, so look for the quoted source
+		quoted, _ := json.Marshal(source)
+		query = query.Where("sources LIKE ?", "%"+escapeLike(string(quoted))+"%")
+	}
 	var subdomains []Subdomain
-	db.Find(&subdomains)
+	query.Find(&subdomains)
 	json.NewEncoder(w).Encode(subdomains)
 }
 
@@ -63,20 +130,125 @@ func getSubdomain(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var subdomain Subdomain
 	vars := mux.Vars(r)
-	db.Preload("IPs").Where("ID = ?", vars["id"]).Find(&subdomain)
+	db.Preload("IPs").Where("ID = ?", lookupHostname(vars["id"])).Find(&subdomain)
 	json.NewEncoder(w).Encode(&subdomain)
 }
 
-// Creates new subdomains, accepts batches
+// Creates new subdomains, accepts batches. Names are normalised before they are stored, and any that aren't valid
+// hostnames, don't fall under their rootdomain or are out of their program's scope are rejected individually while
+// the rest are still stored.
 func createSubdomains(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var subdomains []Subdomain
 	_ = json.NewDecoder(r.Body).Decode(&subdomains)
-	db.Clauses(clause.OnConflict{
-		Columns:   []clause.Column{{Name: "id"}},
-		DoUpdates: clause.AssignmentColumns([]string{"root_domain_id"}),
-	}).Create(&subdomains)
-	json.NewEncoder(w).Encode(subdomains)
+
+	valid := []Subdomain{}
+	rejected := []Reject{}
+	seen := make(map[string]bool)
+	programs := make(map[string]string)
+	exclusions := make(map[string][]ScopeTarget)
+	for i, subdomain := range subdomains {
+		raw := subdomain.ID
+		err := normaliseSubdomain(&subdomain)
+		if err != nil {
+			rejected = append(rejected, rejectAt(i, raw, err.Error()))
+			continue
+		}
+		program, ok := programs[subdomain.RootDomainID]
+		if !ok {
+			db.Model(&RootDomain{}).Where("id = ?", subdomain.RootDomainID).Select("program_id").Scan(&program)
+			programs[subdomain.RootDomainID] = program
+			if _, ok := exclusions[program]; !ok {
+				exclusions[program] = outOfScopeTargets(program)
+			}
+		}
+		if target, excluded := excludedBy(exclusions[program], subdomain.ID); excluded {
+			rejected = append(rejected, rejectAt(i, raw, target.Target+" is out of scope"))
+			continue
+		}
+		if seen[subdomain.ID] {
+			continue
+		}
+		seen[subdomain.ID] = true
+		valid = append(valid, subdomain)
+	}
+
+	if len(valid) > 0 {
+		// a name that has been seen as a wildcard stays a wildcard, and seeing it again means it isn't stale
+		updates := clause.AssignmentColumns([]string{"root_domain_id", "program_id", "last_seen"})
+		updates = append(updates, clause.Assignment{Column: clause.Column{Name: "stale"}, Value: false})
+		updates = append(updates, clause.Assignment{
+			Column: clause.Column{Name: "wildcard"},
+			Value:  gorm.Expr("subdomains.wildcard OR excluded.wildcard"),
+		})
+		db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "id"}},
+			DoUpdates: updates,
+		}).Create(&valid)
+	}
+	writeBatch(w, r, valid, rejected)
+}
+
+// normaliseSubdomain normalises the name and rootdomain of a subdomain. If a rootdomain was given the name must fall
+// under it, otherwise the rootdomain is derived from the name.
+func normaliseSubdomain(subdomain *Subdomain) error {
+	name, wildcard, err := normaliseHostname(subdomain.ID)
+	if err != nil {
+		return err
+	}
+	subdomain.ID = name
+	subdomain.Wildcard = subdomain.Wildcard || wildcard
+
+	if subdomain.RootDomainID == "" {
+		rootdomain, err := findRootDomain(name)
+		if err != nil {
+			return err
+		}
+		subdomain.RootDomainID = rootdomain.ID
+		return nil
+	}
+
+	root, _, err := normaliseHostname(subdomain.RootDomainID)
+	if err != nil {
+		return fmt.Errorf("invalid rootdomain: %v", err)
+	}
+	if !isUnderDomain(name, root) {
+		return fmt.Errorf("%s does not fall under rootdomain %s", name, root)
+	}
+	var count int64
+	db.Model(&RootDomain{}).Where("id = ?", root).Count(&count)
+	if count == 0 {
+		return fmt.Errorf("rootdomain %s does not exist", root)
+	}
+	subdomain.RootDomainID = root
+	return nil
+}
+
+// findOrCreateSubdomain returns the stored subdomain with a normalised name, adding it first if it falls under a
+// rootdomain but hasn't been seen before
+func findOrCreateSubdomain(name string) (Subdomain, error) {
+	var subdomain Subdomain
+	err := db.Where("id = ?", name).First(&subdomain).Error
+	if err == nil {
+		return subdomain, nil
+	}
+	subdomain = Subdomain{ID: name}
+	err = normaliseSubdomain(&subdomain)
+	if err != nil {
+		return subdomain, err
+	}
+	db.Clauses(clause.OnConflict{DoNothing: true}).Create(&subdomain)
+	return subdomain, nil
+}
+
+// lookupHostname normalises a hostname taken from a URL so it matches the stored form, or returns it untouched if
+// it isn't a valid hostname
+func lookupHostname(id string) string {
+	name, _, err := normaliseHostname(id)
+	if err != nil {
+		return id
+	}
+	return name
 }
 
 // Updates a subdomain
@@ -99,7 +271,7 @@ func deleteSubdomain(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 	var subdomain Subdomain
-	db.Where("ID = ?", id).Find(&subdomain)
+	db.Where("ID = ?", lookupHostname(id)).Find(&subdomain)
 	deleteSubdomainLocal(subdomain)
 	var subdomains []Subdomain
 	db.Find(&subdomains)
@@ -107,7 +279,14 @@ func deleteSubdomain(w http.ResponseWriter, r *http.Request) {
 }
 
 func deleteSubdomainLocal(subdomain Subdomain) {
+	// the IPs may have belonged to the subdomain's program only because of this subdomain
+	var ips []string
+	db.Table("subdomain_ips").Where("subdomain_id = ?", subdomain.ID).Pluck("ip_id", &ips)
 	db.Model(&subdomain).Association("IPs").Clear()
+	syncIPPrograms(ips...)
+	db.Unscoped().Where("subdomain_id = ?", subdomain.ID).Delete(&Endpoint{})
+	db.Unscoped().Where("subdomain_id = ?", subdomain.ID).Delete(&CertificateBinding{})
+	db.Unscoped().Where("subdomain_id = ?", subdomain.ID).Delete(&DNSRecord{})
 	db.Unscoped().Delete(&subdomain)
 }
 
@@ -168,17 +347,84 @@ func associateIPWithSubdomain(w http.ResponseWriter, r *http.Request) {
 	// Get the subdomain from the URL
 	var subdomain Subdomain
 	vars := mux.Vars(r)
-	db.Where("ID = ?", vars["id"]).Find(&subdomain)
+	db.Where("ID = ?", lookupHostname(vars["id"])).Find(&subdomain)
 
 	// For each IP, associate it with the given subdomain
+	associated := []IP{}
+	rejected := []Reject{}
 	db.Model(&subdomain).Association("IPs")
-	for _, ip := range ips {
-		var rootdomain RootDomain
-		db.Where("id = ?", subdomain.RootDomainID).First(&rootdomain)
-		db.Where(IP{ID: ip.ID, ProgramID: rootdomain.ProgramID}).FirstOrCreate(&ip)
+	for i, ip := range ips {
+		addr, err := parseIP(ip.ID)
+		if err != nil {
+			rejected = append(rejected, rejectAt(i, ip.ID, err.Error()))
+			continue
+		}
+		ip = IP{}
+		db.Where(IP{ID: addr.String()}).FirstOrCreate(&ip)
 		db.Model(&subdomain).Association("IPs").Append([]IP{ip})
+		associated = append(associated, ip)
+	}
+	var ids []string
+	for _, ip := range associated {
+		ids = append(ids, ip.ID)
+	}
+	syncIPPrograms(ids...)
+	writeBatch(w, r, associated, rejected)
+}
+
+// classifyResolution turns the error from a DNS lookup into the resolution state of a subdomain
+func classifyResolution(err error) string {
+	if err == nil {
+		return ResolutionResolves
+	}
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) {
+		return ResolutionServFail
+	}
+	if dnsErr.IsNotFound {
+		return ResolutionNXDomain
 	}
-	json.NewEncoder(w).Encode(ips)
+	if dnsErr.IsTimeout {
+		return ResolutionTimeout
+	}
+	return ResolutionServFail
+}
+
+// Looks up the DNS records of a subdomain now, rather than waiting for a worker to do it
+func refreshSubdomainDNS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var subdomain Subdomain
+	vars := mux.Vars(r)
+	err := db.Where("ID = ?", lookupHostname(vars["id"])).First(&subdomain).Error
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Subdomain not found.")
+		return
+	}
+	updateDNSData(subdomain)
+	db.Preload("IPs").Where("ID = ?", subdomain.ID).Find(&subdomain)
+	json.NewEncoder(w).Encode(&subdomain)
+}
+
+// staleDays is how long a subdomain can go without being seen or resolving before it is marked stale
+func staleDays() int {
+	if config.Liveness.StaleDays > 0 {
+		return config.Liveness.StaleDays
+	}
+	return 30
+}
+
+// markStaleSubdomains marks the subdomains that haven't been seen or resolved within the stale period as stale
+func markStaleSubdomains() {
+	cutoff := time.Now().AddDate(0, 0, -staleDays())
+	db.Model(&Subdomain{}).
+		Where("stale = ? AND last_seen < ? AND (last_resolved IS NULL OR last_resolved < ?)", false, cutoff, cutoff).
+		Update("stale", true)
+}
+
+// backfillSubdomainLiveness fills in the first and last seen times of subdomains stored before they were tracked
+func backfillSubdomainLiveness() {
+	db.Exec("UPDATE subdomains SET first_seen = created_at WHERE first_seen IS NULL OR first_seen < '0002-01-01'")
+	db.Exec("UPDATE subdomains SET last_seen = updated_at WHERE last_seen IS NULL OR last_seen < '0002-01-01'")
 }
 
 // updateDNSData gets the IP addresses, nameservers and CNAME data from a specified subdomain and saves it.
@@ -188,18 +434,29 @@ func updateDNSData(subdomain Subdomain) (err error) {
 	if tempErr != nil {
 		didReturnIP = false
 	}
+	liveness := map[string]interface{}{"resolution": classifyResolution(tempErr)}
+	if didReturnIP {
+		now := time.Now()
+		liveness["last_resolved"] = now
+		liveness["last_seen"] = now
+		liveness["stale"] = false
+	}
+	db.Model(&subdomain).Updates(liveness)
 
 	if didReturnIP {
+		var ids []string
 		for _, ip := range iprecords {
 			var newIP IP
-			ipString := fmt.Sprint(ip)
-			db.Model(&subdomain).Association("IPs")
-
-			var rootdomain RootDomain
-			db.Where("id = ?", subdomain.RootDomainID).First(&rootdomain)
-			db.Where(IP{ID: ipString, ProgramID: rootdomain.ProgramID}).FirstOrCreate(&newIP)
+			addr, ok := netip.AddrFromSlice(ip)
+			if !ok {
+				continue
+			}
+			ipString := addr.Unmap().String()
+			db.Where(IP{ID: ipString}).FirstOrCreate(&newIP)
 			db.Model(&subdomain).Association("IPs").Append([]IP{newIP})
+			ids = append(ids, newIP.ID)
 		}
+		syncIPPrograms(ids...)
 	}
 
 	// Update the CNAME if there is one
@@ -209,9 +466,17 @@ func updateDNSData(subdomain Subdomain) (err error) {
 		didReturnCNAME = false
 	}
 	if didReturnCNAME {
-		if cnamerecord != subdomain.ID+"." {
+		if cnamerecord != subdomain.ID+"." && cnamerecord != subdomain.CNAME {
 			db.Model(&subdomain).Update("CNAME", cnamerecord)
-			fmt.Println("added CNAME", cnamerecord, "to subdomain", subdomain.ID)
+			// a new CNAME could be dangling
+			subdomain.CNAME = cnamerecord
+			queueTakeoverCheck(subdomain)
+		}
+	} else if subdomain.CNAME != "" {
+		// the lookup fails when the CNAME target doesn't exist, which is exactly when the stored CNAME may be dangling
+		var dnsErr *net.DNSError
+		if errors.As(tempErr, &dnsErr) && dnsErr.IsNotFound {
+			queueTakeoverCheck(subdomain)
 		}
 	}
 
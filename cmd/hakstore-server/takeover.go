@@ -0,0 +1,346 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	uuid "github.com/satori/go.uuid"
+)
+
+// TakeoverFingerprint describes a service that a dangling CNAME can be claimed on. A CNAME pointing at one of the
+// service's domains is vulnerable if the target doesn't resolve (when NXDomain is set), or if the page served for
+// the subdomain contains one of the body signatures.
+type TakeoverFingerprint struct {
+	Service  string   `json:"service"`
+	CNAMEs   []string `json:"cnames"`
+	NXDomain bool     `json:"nxdomain"`
+	Body     []string `json:"body"`
+	Severity int      `json:"severity"`
+}
+
+// TakeoverResult is the outcome of checking a subdomain for a takeover
+type TakeoverResult struct {
+	Subdomain  string `json:"subdomain"`
+	CNAME      string `json:"cname"`
+	Service    string `json:"service"`
+	Vulnerable bool   `json:"vulnerable"`
+	Evidence   string `json:"evidence"`
+	Vuln       *Vuln  `json:"vuln,omitempty"`
+}
+
+// TakeoverJob is a takeover check of many subdomains running in the background. Only the subdomains whose CNAME
+// points at a known service are in the results. Jobs are kept in memory, so they are gone after a restart.
+type TakeoverJob struct {
+	ID         string           `json:"id"`
+	Program    string           `json:"program"`
+	Status     string           `json:"status"`
+	Total      int              `json:"total"`
+	Checked    int              `json:"checked"`
+	Vulnerable int              `json:"vulnerable"`
+	Results    []TakeoverResult `json:"results"`
+	StartedAt  time.Time        `json:"startedat"`
+	FinishedAt *time.Time       `json:"finishedat"`
+}
+
+// The statuses of a takeover job
+const (
+	TakeoverJobRunning = "running"
+	TakeoverJobDone    = "done"
+)
+
+// takeoverJobs are the takeover jobs that are running or finished within the last day
+var (
+	takeoverJobs      = make(map[string]*TakeoverJob)
+	takeoverJobsMutex sync.Mutex
+)
+
+// takeoverSlots limits how many takeover checks run at the same time, each check holds a slot while it runs
+var takeoverSlots chan struct{}
+
+// bundledTakeoverFingerprints are the fingerprints shipped with hakstore, they can be replaced with the file set in
+// the takeover section of the config file
+//
+//go:embed takeover-fingerprints.json
+var bundledTakeoverFingerprints []byte
+
+// takeoverFingerprints are the fingerprints currently in use. Reloading swaps in a new slice rather than changing
+// this one, so readers can keep using the slice they got from currentTakeoverFingerprints.
+var (
+	takeoverFingerprints      []TakeoverFingerprint
+	takeoverFingerprintsMutex sync.RWMutex
+)
+
+var nonAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+
+// loadTakeoverFingerprints loads the fingerprint file from the config if there is one, or the bundled fingerprints
+// otherwise
+func loadTakeoverFingerprints() error {
+	data := bundledTakeoverFingerprints
+	if config.Takeover.Fingerprints != "" {
+		var err error
+		data, err = ioutil.ReadFile(config.Takeover.Fingerprints)
+		if err != nil {
+			return err
+		}
+	}
+	var fingerprints []TakeoverFingerprint
+	err := json.Unmarshal(data, &fingerprints)
+	if err != nil {
+		return fmt.Errorf("invalid takeover fingerprints: %v", err)
+	}
+	takeoverFingerprintsMutex.Lock()
+	takeoverFingerprints = fingerprints
+	takeoverFingerprintsMutex.Unlock()
+	return nil
+}
+
+// currentTakeoverFingerprints returns the fingerprints in use, which must not be modified
+func currentTakeoverFingerprints() []TakeoverFingerprint {
+	takeoverFingerprintsMutex.RLock()
+	defer takeoverFingerprintsMutex.RUnlock()
+	return takeoverFingerprints
+}
+
+// matchTakeoverFingerprint finds the fingerprint for the service a CNAME target points at, if there is one
+func matchTakeoverFingerprint(target string) (TakeoverFingerprint, bool) {
+	target = strings.TrimSuffix(strings.ToLower(target), ".")
+	for _, fingerprint := range currentTakeoverFingerprints() {
+		for _, pattern := range fingerprint.CNAMEs {
+			pattern = strings.TrimSuffix(strings.ToLower(pattern), ".")
+			if target == pattern || strings.HasSuffix(target, "."+pattern) {
+				return fingerprint, true
+			}
+		}
+	}
+	return TakeoverFingerprint{}, false
+}
+
+// checkTakeover checks whether a subdomain's CNAME is dangling on a service that lets anyone claim it. Vulnerable
+// subdomains get a vuln, which is deduplicated on the subdomain and CNAME so repeated checks don't pile up.
+func checkTakeover(subdomain Subdomain) TakeoverResult {
+	target := strings.TrimSuffix(subdomain.CNAME, ".")
+	result := TakeoverResult{Subdomain: subdomain.ID, CNAME: target}
+	if target == "" {
+		return result
+	}
+	fingerprint, ok := matchTakeoverFingerprint(target)
+	if !ok {
+		return result
+	}
+	result.Service = fingerprint.Service
+
+	if fingerprint.NXDomain {
+		_, err := net.LookupHost(target)
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			result.Vulnerable = true
+			result.Evidence = fmt.Sprintf("CNAME target %s does not resolve", target)
+		}
+	}
+	if !result.Vulnerable && len(fingerprint.Body) > 0 {
+		body := fetchTakeoverBody(subdomain.ID)
+		for _, signature := range fingerprint.Body {
+			if signature != "" && strings.Contains(body, signature) {
+				result.Vulnerable = true
+				result.Evidence = fmt.Sprintf("response contains %q", signature)
+				break
+			}
+		}
+	}
+	if !result.Vulnerable {
+		return result
+	}
+
+	severity := fingerprint.Severity
+	if severity < 1 || severity > 5 {
+		severity = 2
+	}
+	vuln := Vuln{
+		Title:       fmt.Sprintf("Subdomain takeover of %s via %s", subdomain.ID, fingerprint.Service),
+		Description: fmt.Sprintf("%s has a CNAME to %s on %s, which looks unclaimed: %s.", subdomain.ID, target, fingerprint.Service, result.Evidence),
+		Severity:    severity,
+		CheckID:     "takeover-" + strings.Trim(nonAlphanumeric.ReplaceAllString(strings.ToLower(fingerprint.Service), "-"), "-"),
+		MatchedAt:   target,
+		Subdomains:  []*Subdomain{{ID: subdomain.ID}},
+		References:  StringList{"https://github.com/EdOverflow/can-i-take-over-xyz"},
+	}
+	_, err := createVulnLocal(&vuln)
+	if err != nil {
+		log.Println("Error storing takeover vuln for", subdomain.ID+":", err)
+		return result
+	}
+	result.Vuln = &vuln
+	return result
+}
+
+// fetchTakeoverBody fetches the page served for a subdomain over https, falling back to http, and returns the start
+// of the body
+func fetchTakeoverBody(host string) string {
+	client := &http.Client{Timeout: 10 * time.Second}
+	for _, scheme := range []string{"https", "http"} {
+		resp, err := client.Get(scheme + "://" + host + "/")
+		if err != nil {
+			continue
+		}
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+		resp.Body.Close()
+		if err == nil {
+			return string(body)
+		}
+	}
+	return ""
+}
+
+// startTakeoverChecks sets how many takeover checks can run at the same time, from the takeover section of the config
+// file or 10 if it isn't set
+func startTakeoverChecks() {
+	concurrency := config.Takeover.Concurrency
+	if concurrency < 1 {
+		concurrency = 10
+	}
+	takeoverSlots = make(chan struct{}, concurrency)
+}
+
+// queueTakeoverCheck checks a subdomain for a takeover in the background, e.g. when its CNAME changes, so the request
+// that noticed doesn't wait on the outbound requests
+func queueTakeoverCheck(subdomain Subdomain) {
+	go func() {
+		takeoverSlots <- struct{}{}
+		defer func() { <-takeoverSlots }()
+		checkTakeover(subdomain)
+	}()
+}
+
+// runTakeoverJob checks the subdomains of a job, as many at a time as there are takeover slots
+func runTakeoverJob(job *TakeoverJob, subdomains []Subdomain) {
+	var wg sync.WaitGroup
+	for _, subdomain := range subdomains {
+		takeoverSlots <- struct{}{}
+		wg.Add(1)
+		go func(subdomain Subdomain) {
+			defer func() {
+				<-takeoverSlots
+				wg.Done()
+			}()
+			result := checkTakeover(subdomain)
+			takeoverJobsMutex.Lock()
+			job.Checked++
+			if result.Service != "" {
+				job.Results = append(job.Results, result)
+			}
+			if result.Vulnerable {
+				job.Vulnerable++
+			}
+			takeoverJobsMutex.Unlock()
+		}(subdomain)
+	}
+	wg.Wait()
+	now := time.Now()
+	takeoverJobsMutex.Lock()
+	job.Status = TakeoverJobDone
+	job.FinishedAt = &now
+	takeoverJobsMutex.Unlock()
+}
+
+// snapshot copies a takeover job so it can be encoded while the job carries on. The caller holds takeoverJobsMutex.
+func (job *TakeoverJob) snapshot() TakeoverJob {
+	copied := *job
+	copied.Results = append([]TakeoverResult{}, job.Results...)
+	return copied
+}
+
+// Checks a subdomain for a takeover now
+func checkSubdomainTakeover(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var subdomain Subdomain
+	vars := mux.Vars(r)
+	err := db.Where("ID = ?", lookupHostname(vars["id"])).First(&subdomain).Error
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Subdomain not found.")
+		return
+	}
+	json.NewEncoder(w).Encode(checkTakeover(subdomain))
+}
+
+// Starts a background job that checks every subdomain with a CNAME for takeovers, optionally limited to a program
+// with ?program=. The job is returned straight away, its progress and results can be followed with
+// /api/takeover/jobs/{id}.
+func checkTakeovers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	program := r.URL.Query().Get("program")
+	query := db.Where("cname <> ''")
+	if program != "" {
+		query = query.Where("program_id = ?", program)
+	}
+	var subdomains []Subdomain
+	query.Find(&subdomains)
+
+	job := &TakeoverJob{
+		ID:        uuid.NewV4().String(),
+		Program:   program,
+		Status:    TakeoverJobRunning,
+		Total:     len(subdomains),
+		Results:   []TakeoverResult{},
+		StartedAt: time.Now(),
+	}
+	takeoverJobsMutex.Lock()
+	for id, finished := range takeoverJobs {
+		if finished.FinishedAt != nil && time.Since(*finished.FinishedAt) > 24*time.Hour {
+			delete(takeoverJobs, id)
+		}
+	}
+	takeoverJobs[job.ID] = job
+	snapshot := job.snapshot()
+	takeoverJobsMutex.Unlock()
+
+	go runTakeoverJob(job, subdomains)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// Get a takeover job, with the results of the subdomains checked so far
+func getTakeoverJob(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	vars := mux.Vars(r)
+	takeoverJobsMutex.Lock()
+	job, ok := takeoverJobs[vars["id"]]
+	var snapshot TakeoverJob
+	if ok {
+		snapshot = job.snapshot()
+	}
+	takeoverJobsMutex.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "Takeover job not found.")
+		return
+	}
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// Get the takeover fingerprints in use
+func getTakeoverFingerprints(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(currentTakeoverFingerprints())
+}
+
+// Reloads the takeover fingerprints, so an updated fingerprint file can be picked up without a restart
+func reloadTakeoverFingerprints(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	err := loadTakeoverFingerprints()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	json.NewEncoder(w).Encode(currentTakeoverFingerprints())
+}
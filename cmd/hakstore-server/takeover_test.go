@@ -0,0 +1,67 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+// loadBundledTakeoverFingerprints loads the fingerprints shipped with hakstore, as no fingerprint file is configured
+func loadBundledTakeoverFingerprints(t *testing.T) {
+	config = &Config{}
+	err := loadTakeoverFingerprints()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMatchTakeoverFingerprint(t *testing.T) {
+	loadBundledTakeoverFingerprints(t)
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{target: "tesla.github.io", want: "GitHub Pages"},
+		{target: "Tesla.GitHub.io.", want: "GitHub Pages"},
+		{target: "shop.herokuapp.com", want: "Heroku"},
+		{target: "github.io.tesla.com"},
+		{target: "notgithub.io"},
+		{target: "www.tesla.com"},
+	}
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			fingerprint, ok := matchTakeoverFingerprint(test.target)
+			if ok != (test.want != "") || fingerprint.Service != test.want {
+				t.Errorf("matchTakeoverFingerprint(%q) = %q, %v, want %q", test.target, fingerprint.Service, ok, test.want)
+			}
+		})
+	}
+}
+
+// TestReloadTakeoverFingerprints checks that fingerprints can be reloaded while checks are matching against them, run
+// it with -race
+func TestReloadTakeoverFingerprints(t *testing.T) {
+	loadBundledTakeoverFingerprints(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if _, ok := matchTakeoverFingerprint("tesla.github.io"); !ok {
+					t.Error("matchTakeoverFingerprint() found no fingerprint during a reload")
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if err := loadTakeoverFingerprints(); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// StringList is a list of strings that is stored as JSON in a single text column
+type StringList []string
+
+// Scan reads a StringList from the database
+func (l *StringList) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, l)
+	case string:
+		return json.Unmarshal([]byte(v), l)
+	}
+	return fmt.Errorf("can't scan %T into a StringList", value)
+}
+
+// Value writes a StringList to the database
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(l)
+	return string(b), err
+}
+
+// GormDataType tells gorm which column type to use for a StringList
+func (StringList) GormDataType() string {
+	return "text"
+}
+
+// StringMap is a set of key-value pairs that is stored as JSON in a single text column
+type StringMap map[string]string
+
+// Scan reads a StringMap from the database
+func (m *StringMap) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, m)
+	case string:
+		return json.Unmarshal([]byte(v), m)
+	}
+	return fmt.Errorf("can't scan %T into a StringMap", value)
+}
+
+// Value writes a StringMap to the database
+func (m StringMap) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(m)
+	return string(b), err
+}
+
+// GormDataType tells gorm which column type to use for a StringMap
+func (StringMap) GormDataType() string {
+	return "text"
+}
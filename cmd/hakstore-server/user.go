@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 
@@ -16,6 +17,18 @@ type User struct {
 	Key uuid.UUID `json:"key" gorm:"type:uuid;primary_key;"`
 }
 
+// contextKey is used to store values in a request context without clashing with other packages
+type contextKey string
+
+// userContextKey holds the ID of the user that made a request, it is set by the authentication middleware
+const userContextKey contextKey = "user"
+
+// requestUser returns the ID of the user that made the request
+func requestUser(r *http.Request) string {
+	userID, _ := r.Context().Value(userContextKey).(string)
+	return userID
+}
+
 // Define authentication middleware struct
 type authenticationMiddleware struct {
 	keyUsers map[string]string
@@ -36,9 +49,10 @@ func (amw *authenticationMiddleware) Middleware(next http.Handler) http.Handler
 		key := r.Header.Get("X-API-Key")
 
 		// if the user exists, continue the HTTP serve, otherwise return a 403
-		if _, found := amw.keyUsers[key]; found { // If I need to get the actual user at any point, it's the _ that is returned here
-			// Pass down the request to the next middleware (or final handler)
-			next.ServeHTTP(w, r)
+		if userID, found := amw.keyUsers[key]; found {
+			// Pass down the request to the next middleware (or final handler), along with the user that made it
+			ctx := context.WithValue(r.Context(), userContextKey, userID)
+			next.ServeHTTP(w, r.WithContext(ctx))
 		} else {
 			// Write an error and stop the handler chain
 			http.Error(w, "Forbidden", http.StatusForbidden)
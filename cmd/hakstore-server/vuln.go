@@ -1,8 +1,15 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"sort"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 
@@ -12,12 +19,74 @@ import (
 // Vuln is a structure to store details about vulnerabilities
 type Vuln struct {
 	gorm.Model
-	ID          int          `json:"id" gorm:"PrimaryKey;autoIncrement"`
-	Subdomains  []*Subdomain `json:"subdomains" gorm:"many2many:subdomain_vulns;"`
-	IPs         []*IP        `json:"ips" gorm:"many2many:ip_vulns;"`
-	Description string       `json:"description"`
-	ProgramID   string       `json:"program"`
-	Severity    int          `json:"severity"`
+	ID            int                `json:"id" gorm:"PrimaryKey;autoIncrement"`
+	Subdomains    []*Subdomain       `json:"subdomains" gorm:"many2many:subdomain_vulns;"`
+	IPs           []*IP              `json:"ips" gorm:"many2many:ip_vulns;"`
+	CloudAssets   []*CloudAsset      `json:"cloudassets" gorm:"many2many:cloud_asset_vulns;"`
+	Description   string             `json:"description"`
+	ProgramID     string             `json:"program"`
+	Severity      int                `json:"severity"`
+	Status        string             `json:"status" gorm:"index;default:new"`
+	AssigneeID    string             `json:"assignee"`
+	StatusChanges []VulnStatusChange `json:"history"`
+	CheckID       string             `json:"checkid"`
+	MatchedAt     string             `json:"matchedat"`
+	Fingerprint   string             `json:"fingerprint" gorm:"uniqueIndex:idx_vulns_fingerprint,where:fingerprint <> ''"`
+	LastSeen      time.Time          `json:"lastseen"`
+	Occurrences   int                `json:"occurrences" gorm:"default:1"`
+	Title         string             `json:"title"`
+	CVSSVector    string             `json:"cvssvector"`
+	CVSSScore     float64            `json:"cvssscore"`
+	CWE           string             `json:"cwe"`
+	CVEs          StringList         `json:"cves"`
+	References    StringList         `json:"references"`
+	URL           string             `json:"url"`
+	Parameter     string             `json:"parameter"`
+	Request       string             `json:"request"`
+	Response      string             `json:"response"`
+	PoC           string             `json:"poc"`
+}
+
+// VulnStatusChange records a vuln moving from one status to another, when it happened and who did it
+type VulnStatusChange struct {
+	gorm.Model
+	VulnID int    `json:"vuln"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	UserID string `json:"user"`
+}
+
+// The statuses that a vuln can have during triage
+const (
+	VulnStatusNew           = "new"
+	VulnStatusTriaging      = "triaging"
+	VulnStatusConfirmed     = "confirmed"
+	VulnStatusReported      = "reported"
+	VulnStatusResolved      = "resolved"
+	VulnStatusDuplicate     = "duplicate"
+	VulnStatusFalsePositive = "false_positive"
+	VulnStatusWontFix       = "wont_fix"
+)
+
+// vulnTransitions lists which statuses a vuln can move to from each status. Closed vulns can only be reopened by
+// moving them back to triaging.
+var vulnTransitions = map[string][]string{
+	VulnStatusNew:           {VulnStatusTriaging, VulnStatusDuplicate, VulnStatusFalsePositive, VulnStatusWontFix},
+	VulnStatusTriaging:      {VulnStatusConfirmed, VulnStatusDuplicate, VulnStatusFalsePositive, VulnStatusWontFix},
+	VulnStatusConfirmed:     {VulnStatusReported, VulnStatusResolved, VulnStatusDuplicate, VulnStatusWontFix},
+	VulnStatusReported:      {VulnStatusResolved, VulnStatusDuplicate, VulnStatusWontFix},
+	VulnStatusResolved:      {VulnStatusTriaging},
+	VulnStatusDuplicate:     {VulnStatusTriaging},
+	VulnStatusFalsePositive: {VulnStatusTriaging},
+	VulnStatusWontFix:       {VulnStatusTriaging},
+}
+
+// vulnUpdate holds the fields of a vuln that can be changed through the API, fields that are nil are left alone
+type vulnUpdate struct {
+	Description *string `json:"description"`
+	Severity    *int    `json:"severity"`
+	Status      *string `json:"status"`
+	AssigneeID  *string `json:"assignee"`
 }
 
 func severityString(severity int) string {
@@ -36,29 +105,74 @@ func severityString(severity int) string {
 	return "unknown" // we shouldn't ever have a Vuln without one of the severities in the switch, so we shouldn't get here.
 }
 
-// BeforeCreate will add the programID if it is missing
+// severityFromString is the opposite of severityString, it also accepts the short names scanners use like info. It
+// returns 0 for severities it doesn't know.
+func severityFromString(severity string) int {
+	switch strings.ToLower(strings.TrimSpace(severity)) {
+	case "critical":
+		return 1
+	case "high":
+		return 2
+	case "medium":
+		return 3
+	case "low":
+		return 4
+	case "informational", "info":
+		return 5
+	}
+	return 0
+}
+
+// notifyVulnSetting is the gorm setting that turns off the Slack notification for a new vuln when it is false, so
+// bulk imports of old findings don't flood the channels
+const notifyVulnSetting = "hakstore:notify_vuln"
+
+// BeforeCreate will add the programID if it is missing. Every vuln starts its life as new.
 func (v *Vuln) BeforeCreate(tx *gorm.DB) (err error) {
-	// fill the program field based on the subdomain
-	if v.ProgramID == "" {
+	v.Status = VulnStatusNew
+
+	// fill the program field based on the subdomain, or the ip or cloud asset if there isn't one
+	if v.ProgramID == "" && len(v.Subdomains) > 0 {
 		var sub Subdomain
 		db.Where("ID = ?", v.Subdomains[0].ID).FirstOrInit(&sub)
 		v.ProgramID = sub.ProgramID
+	} else if v.ProgramID == "" && len(v.IPs) > 0 {
+		v.ProgramID = ipProgram(v.IPs[0].ID)
+	} else if v.ProgramID == "" && len(v.CloudAssets) > 0 {
+		v.ProgramID = v.CloudAssets[0].ProgramID
 	}
 	return nil
 }
 
-// AfterCreate sends a Slack message with the vuln details
+// AfterCreate sends a Slack message with the vuln details, unless notifications are turned off for this create
 func (v *Vuln) AfterCreate(tx *gorm.DB) (err error) {
-	// send a notification about the vuln
+	if notify, ok := tx.Get(notifyVulnSetting); ok && !notify.(bool) {
+		return nil
+	}
+	// send a notification about the vuln, a failed notification is logged but doesn't undo the create
 	SendVulnNotification(*v)
 	return nil
 }
 
-// Get all Vulns
+// Get all Vulns. These can be filtered by status with ?status=new,triaging and by assignee with ?assignee=hakluke
 func getVulns(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
+	query := db
+	if status := r.URL.Query().Get("status"); status != "" {
+		statuses := strings.Split(status, ",")
+		for _, s := range statuses {
+			if _, ok := vulnTransitions[s]; !ok {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("Unknown vuln status %q.", s))
+				return
+			}
+		}
+		query = query.Where("status IN ?", statuses)
+	}
+	if assignee, ok := r.URL.Query()["assignee"]; ok {
+		query = query.Where("assignee_id = ?", assignee[0])
+	}
 	var vulns []Vuln
-	db.Find(&vulns)
+	query.Find(&vulns)
 	json.NewEncoder(w).Encode(vulns)
 }
 
@@ -67,22 +181,217 @@ func getVuln(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var vuln Vuln
 	vars := mux.Vars(r)
-	db.Where("ID = ?", vars["id"]).Find(&vuln)
+	db.Where("ID = ?", vars["id"]).Preload("Subdomains").Preload("IPs").Preload("CloudAssets").Preload("StatusChanges").Find(&vuln)
 	json.NewEncoder(w).Encode(&vuln)
 }
 
-// Creates new vulns, accepts batches
+// Creates new vulns, accepts batches. A vuln whose fingerprint has been seen before isn't stored again, instead the
+// existing vuln has its last seen time and occurrence count bumped, so notifications only go out for new findings.
 func createVulns(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var vulns []Vuln
 	_ = json.NewDecoder(r.Body).Decode(&vulns)
-	db.Create(&vulns)
-	json.NewEncoder(w).Encode(vulns)
+
+	stored := []Vuln{}
+	rejected := []Reject{}
+	for i, vuln := range vulns {
+		_, err := createVulnLocal(&vuln)
+		if err != nil {
+			item := vuln.Description
+			if vuln.Title != "" {
+				item = vuln.Title
+			} else if vuln.CheckID != "" {
+				item = vuln.CheckID
+			}
+			rejected = append(rejected, rejectAt(i, item, err.Error()))
+			continue
+		}
+		stored = append(stored, vuln)
+	}
+	writeBatch(w, r, stored, rejected)
+}
+
+// createVulnLocal stores a vuln, or bumps the existing vuln with the same fingerprint. It reports whether a new vuln
+// was created, and fills in the vuln with what was stored.
+func createVulnLocal(vuln *Vuln) (created bool, err error) {
+	return storeVuln(vuln, true)
 }
 
-// Updates a vuln
+// storeVuln is createVulnLocal with a choice of whether a new vuln sends a Slack notification
+func storeVuln(vuln *Vuln, notify bool) (created bool, err error) {
+	// normalise the hosts so the fingerprint doesn't depend on how they were written, and drop empty ones
+	var subdomains []*Subdomain
+	for _, subdomain := range vuln.Subdomains {
+		if subdomain == nil || strings.TrimSpace(subdomain.ID) == "" {
+			continue
+		}
+		subdomain.ID = lookupHostname(subdomain.ID)
+		subdomains = append(subdomains, subdomain)
+	}
+	vuln.Subdomains = subdomains
+	var ips []*IP
+	for _, ip := range vuln.IPs {
+		if ip == nil || strings.TrimSpace(ip.ID) == "" {
+			continue
+		}
+		addr, err := parseIP(ip.ID)
+		if err != nil {
+			return false, err
+		}
+		ip.ID = addr.String()
+		ips = append(ips, ip)
+	}
+	vuln.IPs = ips
+	err = resolveVulnCloudAssets(vuln)
+	if err != nil {
+		return false, err
+	}
+
+	// the score always comes from the vector so the two can't disagree
+	vuln.CVSSScore = 0
+	if vuln.CVSSVector != "" {
+		vuln.CVSSScore, err = cvssBaseScore(vuln.CVSSVector)
+		if err != nil {
+			return false, err
+		}
+		if vuln.Severity == 0 {
+			vuln.Severity = severityFromCVSS(vuln.CVSSScore)
+		}
+	}
+
+	if vuln.Fingerprint == "" {
+		vuln.Fingerprint = vulnFingerprint(*vuln)
+	}
+	if vuln.Fingerprint != "" && bumpVuln(vuln) {
+		return false, nil
+	}
+
+	// new cloud assets are only stored for a vuln that is going to be created
+	err = saveVulnCloudAssets(vuln)
+	if err != nil {
+		return false, err
+	}
+	vuln.LastSeen = time.Now()
+	vuln.Occurrences = 1
+	err = db.Set(notifyVulnSetting, notify).Create(vuln).Error
+	if err != nil && vuln.Fingerprint != "" && bumpVuln(vuln) {
+		// another request stored the same finding in the meantime
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// bumpVuln looks for a stored vuln with the same fingerprint. If there is one, it is marked as seen again and copied
+// into vuln.
+func bumpVuln(vuln *Vuln) bool {
+	var existing Vuln
+	err := db.Where("fingerprint = ?", vuln.Fingerprint).First(&existing).Error
+	if err != nil {
+		return false
+	}
+	db.Model(&existing).Updates(map[string]interface{}{
+		"last_seen":   time.Now(),
+		"occurrences": gorm.Expr("occurrences + 1"),
+	})
+	db.Preload("Subdomains").Preload("IPs").Preload("CloudAssets").First(&existing, "id = ?", existing.ID)
+	*vuln = existing
+	return true
+}
+
+// vulnFingerprint works out a deterministic fingerprint from the check that found a vuln, the hosts it was found on
+// and where it matched. Vulns without a check ID, like ones created by hand, don't get a fingerprint.
+func vulnFingerprint(vuln Vuln) string {
+	if vuln.CheckID == "" {
+		return ""
+	}
+	var hosts []string
+	for _, subdomain := range vuln.Subdomains {
+		hosts = append(hosts, subdomain.ID)
+	}
+	for _, ip := range vuln.IPs {
+		hosts = append(hosts, ip.ID)
+	}
+	for _, asset := range vuln.CloudAssets {
+		hosts = append(hosts, asset.Provider+"/"+asset.Kind+"/"+asset.Identifier)
+	}
+	sort.Strings(hosts)
+	sum := sha256.Sum256([]byte(vuln.CheckID + "|" + strings.Join(hosts, ",") + "|" + vuln.MatchedAt))
+	return hex.EncodeToString(sum[:])
+}
+
+// Updates a vuln. Only the fields present in the request body are changed, and status changes have to follow the
+// triage workflow in vulnTransitions.
 func updateVuln(w http.ResponseWriter, r *http.Request) {
-	// not necessary, let's just delete it and create a new one
+	w.Header().Set("Content-Type", "application/json")
+	vars := mux.Vars(r)
+	var vuln Vuln
+	err := db.Where("ID = ?", vars["id"]).First(&vuln).Error
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Vuln not found.")
+		return
+	}
+
+	var update vulnUpdate
+	_ = json.NewDecoder(r.Body).Decode(&update)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return updateVulnLocal(tx, &vuln, update, requestUser(r))
+	})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	db.Where("ID = ?", vuln.ID).Preload("StatusChanges").Find(&vuln)
+	json.NewEncoder(w).Encode(&vuln)
+}
+
+// updateVulnLocal applies an update to a vuln, recording any status change against the user that made it
+func updateVulnLocal(tx *gorm.DB, vuln *Vuln, update vulnUpdate, userID string) error {
+	updates := make(map[string]interface{})
+	if update.Description != nil {
+		updates["description"] = *update.Description
+	}
+	if update.Severity != nil {
+		if *update.Severity < 1 || *update.Severity > 5 {
+			return errors.New("severity must be between 1 (critical) and 5 (informational)")
+		}
+		updates["severity"] = *update.Severity
+	}
+	if update.AssigneeID != nil {
+		if *update.AssigneeID != "" {
+			var count int64
+			tx.Model(&User{}).Where("id = ?", *update.AssigneeID).Count(&count)
+			if count == 0 {
+				return fmt.Errorf("user %q does not exist", *update.AssigneeID)
+			}
+		}
+		updates["assignee_id"] = *update.AssigneeID
+	}
+	if update.Status != nil && *update.Status != vuln.Status {
+		if !canTransitionVuln(vuln.Status, *update.Status) {
+			return fmt.Errorf("a vuln can't move from %s to %s, allowed statuses are: %s", vuln.Status, *update.Status, strings.Join(vulnTransitions[vuln.Status], ", "))
+		}
+		change := VulnStatusChange{VulnID: vuln.ID, From: vuln.Status, To: *update.Status, UserID: userID}
+		err := tx.Create(&change).Error
+		if err != nil {
+			return err
+		}
+		updates["status"] = *update.Status
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	return tx.Model(vuln).Updates(updates).Error
+}
+
+// canTransitionVuln checks whether a vuln with the status from is allowed to move to the status to
+func canTransitionVuln(from string, to string) bool {
+	for _, allowed := range vulnTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
 }
 
 // Deletes a vuln
@@ -101,5 +410,8 @@ func deleteVuln(w http.ResponseWriter, r *http.Request) {
 func deleteVulnLocal(vuln Vuln) {
 	db.Model(&vuln).Association("Subdomains").Clear()
 	db.Model(&vuln).Association("IPs").Clear()
+	db.Model(&vuln).Association("CloudAssets").Clear()
+	db.Unscoped().Where("vuln_id = ?", vuln.ID).Delete(&VulnStatusChange{})
+	db.Exec("DELETE FROM report_vulns WHERE vuln_id = ?", vuln.ID)
 	db.Unscoped().Delete(&vuln)
 }
@@ -0,0 +1,151 @@
+package main
+
+import "testing"
+
+func TestCanTransitionVuln(t *testing.T) {
+	tests := []struct {
+		from string
+		to   string
+		want bool
+	}{
+		{from: VulnStatusNew, to: VulnStatusTriaging, want: true},
+		{from: VulnStatusNew, to: VulnStatusFalsePositive, want: true},
+		{from: VulnStatusTriaging, to: VulnStatusConfirmed, want: true},
+		{from: VulnStatusConfirmed, to: VulnStatusReported, want: true},
+		{from: VulnStatusConfirmed, to: VulnStatusResolved, want: true},
+		{from: VulnStatusReported, to: VulnStatusResolved, want: true},
+		{from: VulnStatusResolved, to: VulnStatusTriaging, want: true},
+		{from: VulnStatusWontFix, to: VulnStatusTriaging, want: true},
+		{from: VulnStatusNew, to: VulnStatusConfirmed},
+		{from: VulnStatusNew, to: VulnStatusResolved},
+		{from: VulnStatusTriaging, to: VulnStatusReported},
+		{from: VulnStatusReported, to: VulnStatusConfirmed},
+		{from: VulnStatusResolved, to: VulnStatusNew},
+		{from: VulnStatusDuplicate, to: VulnStatusConfirmed},
+		{from: VulnStatusNew, to: VulnStatusNew},
+		{from: "closed", to: VulnStatusTriaging},
+		{from: VulnStatusNew, to: "closed"},
+	}
+	for _, test := range tests {
+		t.Run(test.from+" to "+test.to, func(t *testing.T) {
+			if got := canTransitionVuln(test.from, test.to); got != test.want {
+				t.Errorf("canTransitionVuln(%q, %q) = %v, want %v", test.from, test.to, got, test.want)
+			}
+		})
+	}
+}
+
+// TestVulnTransitions checks that every status in the workflow can be reached and that closed vulns can be reopened
+func TestVulnTransitions(t *testing.T) {
+	reached := map[string]bool{VulnStatusNew: true}
+	for from, statuses := range vulnTransitions {
+		for _, to := range statuses {
+			if _, ok := vulnTransitions[to]; !ok {
+				t.Errorf("%s can move to %s, which isn't a status", from, to)
+			}
+			if to == from {
+				t.Errorf("%s can move to itself", from)
+			}
+			reached[to] = true
+		}
+	}
+	for status := range vulnTransitions {
+		if !reached[status] {
+			t.Errorf("no status can move to %s", status)
+		}
+	}
+	for _, closed := range []string{VulnStatusResolved, VulnStatusDuplicate, VulnStatusFalsePositive, VulnStatusWontFix} {
+		if !canTransitionVuln(closed, VulnStatusTriaging) {
+			t.Errorf("%s vulns can't be reopened", closed)
+		}
+	}
+}
+
+func TestVulnFingerprint(t *testing.T) {
+	base := Vuln{
+		CheckID:    "git-config",
+		Subdomains: []*Subdomain{{ID: "www.tesla.com"}, {ID: "api.tesla.com"}},
+		IPs:        []*IP{{ID: "192.0.2.1"}},
+		MatchedAt:  "https://www.tesla.com/.git/config",
+	}
+	fingerprint := vulnFingerprint(base)
+	if len(fingerprint) != 64 {
+		t.Fatalf("vulnFingerprint() = %q, want a hex SHA256", fingerprint)
+	}
+
+	tests := []struct {
+		name string
+		vuln Vuln
+		same bool
+	}{
+		{
+			name: "hosts in another order",
+			vuln: Vuln{
+				CheckID:    "git-config",
+				Subdomains: []*Subdomain{{ID: "api.tesla.com"}, {ID: "www.tesla.com"}},
+				IPs:        []*IP{{ID: "192.0.2.1"}},
+				MatchedAt:  "https://www.tesla.com/.git/config",
+			},
+			same: true,
+		},
+		{
+			name: "fields that aren't part of the fingerprint",
+			vuln: Vuln{
+				CheckID:     "git-config",
+				Subdomains:  []*Subdomain{{ID: "www.tesla.com"}, {ID: "api.tesla.com"}},
+				IPs:         []*IP{{ID: "192.0.2.1"}},
+				MatchedAt:   "https://www.tesla.com/.git/config",
+				Severity:    2,
+				Description: "found again",
+			},
+			same: true,
+		},
+		{
+			name: "host in another case",
+			vuln: Vuln{
+				CheckID:    "git-config",
+				Subdomains: []*Subdomain{{ID: "WWW.tesla.com"}, {ID: "api.tesla.com"}},
+				IPs:        []*IP{{ID: "192.0.2.1"}},
+				MatchedAt:  "https://www.tesla.com/.git/config",
+			},
+		},
+		{
+			name: "another check",
+			vuln: Vuln{
+				CheckID:    "git-head",
+				Subdomains: []*Subdomain{{ID: "www.tesla.com"}, {ID: "api.tesla.com"}},
+				IPs:        []*IP{{ID: "192.0.2.1"}},
+				MatchedAt:  "https://www.tesla.com/.git/config",
+			},
+		},
+		{
+			name: "another host",
+			vuln: Vuln{
+				CheckID:    "git-config",
+				Subdomains: []*Subdomain{{ID: "www.tesla.com"}},
+				IPs:        []*IP{{ID: "192.0.2.1"}},
+				MatchedAt:  "https://www.tesla.com/.git/config",
+			},
+		},
+		{
+			name: "matched somewhere else",
+			vuln: Vuln{
+				CheckID:    "git-config",
+				Subdomains: []*Subdomain{{ID: "www.tesla.com"}, {ID: "api.tesla.com"}},
+				IPs:        []*IP{{ID: "192.0.2.1"}},
+				MatchedAt:  "https://api.tesla.com/.git/config",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := vulnFingerprint(test.vuln); (got == fingerprint) != test.same {
+				t.Errorf("vulnFingerprint() = %q, base fingerprint %q, want same %v", got, fingerprint, test.same)
+			}
+		})
+	}
+
+	if got := vulnFingerprint(Vuln{Description: "Found by hand", Subdomains: base.Subdomains, MatchedAt: base.MatchedAt}); got != "" {
+		t.Errorf("vulnFingerprint() without a check ID = %q, want no fingerprint", got)
+	}
+}
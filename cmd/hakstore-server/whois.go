@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// whoisRecord is the registration data for a rootdomain, as posted by the workers that run the WHOIS lookups
+type whoisRecord struct {
+	RootDomainID    string     `json:"rootdomain"`
+	Registrar       string     `json:"registrar"`
+	RegistrantOrg   string     `json:"registrantorg"`
+	RegistrantEmail string     `json:"registrantemail"`
+	CreationDate    *time.Time `json:"creationdate"`
+	ExpiryDate      *time.Time `json:"expirydate"`
+	Nameservers     []string   `json:"nameservers"`
+}
+
+// Stores WHOIS data against existing rootdomains, accepts batches. Each record replaces the rootdomain's previous
+// registration data, and records for unknown rootdomains are rejected.
+func createWhois(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var records []whoisRecord
+	_ = json.NewDecoder(r.Body).Decode(&records)
+
+	updated := []RootDomain{}
+	rejected := []Reject{}
+	for i, record := range records {
+		rootdomain, err := storeWhois(record)
+		if err != nil {
+			rejected = append(rejected, rejectAt(i, record.RootDomainID, err.Error()))
+			continue
+		}
+		updated = append(updated, rootdomain)
+	}
+	writeBatch(w, r, updated, rejected)
+}
+
+// storeWhois normalises a WHOIS record and saves it against its rootdomain
+func storeWhois(record whoisRecord) (RootDomain, error) {
+	var rootdomain RootDomain
+	name, _, err := normaliseHostname(record.RootDomainID)
+	if err != nil {
+		return rootdomain, err
+	}
+	err = db.Where("id = ?", name).First(&rootdomain).Error
+	if err != nil {
+		return rootdomain, fmt.Errorf("rootdomain %s does not exist", name)
+	}
+
+	var nameservers []string
+	for _, nameserver := range record.Nameservers {
+		host, _, err := normaliseHostname(nameserver)
+		if err != nil {
+			return rootdomain, fmt.Errorf("invalid nameserver %q: %v", nameserver, err)
+		}
+		nameservers = append(nameservers, host)
+	}
+
+	now := time.Now()
+	rootdomain.Registrar = strings.TrimSpace(record.Registrar)
+	rootdomain.RegistrantOrg = strings.TrimSpace(record.RegistrantOrg)
+	rootdomain.RegistrantEmail = strings.ToLower(strings.TrimSpace(record.RegistrantEmail))
+	rootdomain.CreationDate = record.CreationDate
+	rootdomain.ExpiryDate = record.ExpiryDate
+	rootdomain.Nameservers = mergeStrings(nil, nameservers)
+	rootdomain.WhoisUpdatedAt = &now
+	err = db.Model(&rootdomain).Select("registrar", "registrant_org", "registrant_email", "creation_date", "expiry_date", "nameservers", "whois_updated_at").Updates(&rootdomain).Error
+	return rootdomain, err
+}
+
+// Gets the other rootdomains registered to the same organisation or email address as this one, which often belong
+// to the same company even when they aren't listed in a program's scope
+func getRelatedRootDomains(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var rootdomain RootDomain
+	vars := mux.Vars(r)
+	db.Where("ID = ?", lookupHostname(vars["id"])).Find(&rootdomain)
+
+	related := []RootDomain{}
+	if rootdomain.RegistrantOrg == "" && rootdomain.RegistrantEmail == "" {
+		json.NewEncoder(w).Encode(related)
+		return
+	}
+	query := db.Where("id <> ?", rootdomain.ID)
+	if rootdomain.RegistrantOrg != "" && rootdomain.RegistrantEmail != "" {
+		query = query.Where("LOWER(registrant_org) = LOWER(?) OR registrant_email = ?", rootdomain.RegistrantOrg, rootdomain.RegistrantEmail)
+	} else if rootdomain.RegistrantOrg != "" {
+		query = query.Where("LOWER(registrant_org) = LOWER(?)", rootdomain.RegistrantOrg)
+	} else {
+		query = query.Where("registrant_email = ?", rootdomain.RegistrantEmail)
+	}
+	query.Find(&related)
+	json.NewEncoder(w).Encode(related)
+}
+
+// getExpiringRootDomainsLocal returns the rootdomains that expire within the given number of days, soonest first
+func getExpiringRootDomainsLocal(days int) []RootDomain {
+	var rootdomains []RootDomain
+	db.Where("expiry_date < ?", time.Now().AddDate(0, 0, days)).Order("expiry_date").Find(&rootdomains)
+	return rootdomains
+}
+
+// notifyExpiringRootDomains sends a slack message listing the rootdomains that are close to expiring. An expired
+// rootdomain in scope can sometimes be registered by anyone, so these are worth a look.
+func notifyExpiringRootDomains() {
+	days := config.Alerts.DomainExpiryDays
+	if days <= 0 {
+		days = 30
+	}
+	rootdomains := getExpiringRootDomainsLocal(days)
+	if len(rootdomains) == 0 || config.Slack.Webhook == "" {
+		return
+	}
+	text := "Rootdomains expiring in the next " + fmt.Sprint(days) + " days:\n```"
+	for _, rootdomain := range rootdomains {
+		text = text + "- " + rootdomain.ID + " (" + rootdomain.ProgramID + ") " + rootdomain.ExpiryDate.Format("2006-01-02") + "\n"
+	}
+	text = text + "```"
+	err := SendSlackNotification(config.Slack.Webhook, text)
+	if err != nil {
+		log.Println("Error sending rootdomain expiry alert:", err)
+	}
+}
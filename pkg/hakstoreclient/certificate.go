@@ -0,0 +1,388 @@
+package hakstoreclient
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Certificate is a structure to store a TLS certificate, keyed on its SHA256 fingerprint. Certificates imported from
+// a CT log without a fingerprint are keyed on their source and log ID instead, like crtsh-1234.
+type Certificate struct {
+	gorm.Model
+	ID        string               `json:"id"`
+	Subject   string               `json:"subject"`
+	Issuer    string               `json:"issuer"`
+	Serial    string               `json:"serial"`
+	NotBefore time.Time            `json:"notbefore"`
+	NotAfter  time.Time            `json:"notafter"`
+	SANs      []string             `json:"sans"`
+	LogID     string               `json:"logid,omitempty"`
+	Source    string               `json:"source,omitempty"`
+	Bindings  []CertificateBinding `json:"bindings"`
+}
+
+// CertificateBinding records which certificate a host serves on a port. Port 0 binds a subdomain to the latest
+// certificate logged for it in a CT log.
+type CertificateBinding struct {
+	gorm.Model
+	CertificateID string    `json:"certificate"`
+	Host          string    `json:"host"`
+	Port          int       `json:"port"`
+	SubdomainID   string    `json:"subdomain"`
+	IPID          string    `json:"ip"`
+	ProgramID     string    `json:"program"`
+	LastSeen      time.Time `json:"lastseen"`
+}
+
+// CertificateSubmission is a certificate seen on a host and port, sent to CreateCertificates. The certificate can
+// either be given as PEM, or as already parsed fields.
+type CertificateSubmission struct {
+	Certificate
+	PEM  string `json:"pem,omitempty"`
+	Host string `json:"host"`
+	Port int    `json:"port"`
+}
+
+// CertificateFilter narrows down the certificates returned by GetCertificates, empty fields don't filter anything
+type CertificateFilter struct {
+	ProgramID string
+	Host      string
+	// Source only returns certificates imported from this CT log source, e.g. crtsh or certstream
+	Source string
+	// ExpiringDays only returns certificates that expire within this many days, if it is above zero
+	ExpiringDays int
+}
+
+// GetCertificates will get the certificates that match the filter
+func (c *Client) GetCertificates(filter CertificateFilter) ([]Certificate, error) {
+	query := url.Values{}
+	if filter.ProgramID != "" {
+		query.Set("program", filter.ProgramID)
+	}
+	if filter.Host != "" {
+		query.Set("host", filter.Host)
+	}
+	if filter.Source != "" {
+		query.Set("source", filter.Source)
+	}
+	if filter.ExpiringDays > 0 {
+		query.Set("expiring", strconv.Itoa(filter.ExpiringDays))
+	}
+	rel := &url.URL{Path: "/api/certificates", RawQuery: query.Encode()}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+	var certificates []Certificate
+	err = json.NewDecoder(resp.Body).Decode(&certificates)
+	return certificates, err
+}
+
+// GetCertificate will get a certificate by its SHA256 fingerprint
+func (c *Client) GetCertificate(id string) (Certificate, error) {
+	var certificate Certificate
+	rel := &url.URL{Path: "/api/certificates/" + id}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return certificate, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return certificate, err
+	}
+	defer resp.Body.Close()
+	err = json.NewDecoder(resp.Body).Decode(&certificate)
+	return certificate, err
+}
+
+// CreateCertificates will store certificates and bind them to the hosts they were seen on. Submissions the server
+// refused are returned in a *RejectedError.
+func (c *Client) CreateCertificates(submissions []CertificateSubmission) ([]Certificate, error) {
+	var emptycertificates []Certificate
+
+	jsonsubmissions, err := json.Marshal(submissions)
+	if err != nil {
+		log.Println("Could not convert certificates to JSON, are they in the correct format?")
+	}
+	rel := &url.URL{Path: "/api/certificates", RawQuery: "verbose=true"}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("POST", u.String(), bytes.NewBuffer(jsonsubmissions))
+	if err != nil {
+		return emptycertificates, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return emptycertificates, err
+	}
+	defer resp.Body.Close()
+	var response struct {
+		Items    []Certificate `json:"items"`
+		Rejected []Reject      `json:"rejected"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return emptycertificates, err
+	}
+	if len(response.Rejected) > 0 {
+		return response.Items, &RejectedError{Rejected: response.Rejected}
+	}
+	return response.Items, nil
+}
+
+// GetUnknownCertificateNames will get the hostnames from certificate SANs that fall under a rootdomain but aren't
+// stored as subdomains yet, ready to pass to CreateSubdomains. Pass an empty program to check every program.
+func (c *Client) GetUnknownCertificateNames(program string) ([]Subdomain, error) {
+	query := url.Values{}
+	if program != "" {
+		query.Set("program", program)
+	}
+	rel := &url.URL{Path: "/api/certificates/unknown", RawQuery: query.Encode()}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var subdomains []Subdomain
+	err = json.NewDecoder(resp.Body).Decode(&subdomains)
+	return subdomains, err
+}
+
+// DeleteCertificate will delete the specified certificate and its bindings
+func (c *Client) DeleteCertificate(id string) (bool, error) {
+	rel := &url.URL{Path: "/api/certificates/" + id}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("DELETE", u.String(), nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	return true, nil
+}
+
+// fetchCertificatePEM connects to a host and returns the leaf certificate it serves as PEM. The certificate isn't
+// verified, since expired and self-signed certificates are worth storing too.
+func fetchCertificatePEM(host string, port int) (string, error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(host, strconv.Itoa(port)), &tls.Config{
+		InsecureSkipVerify: true,
+		ServerName:         host,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	certificates := conn.ConnectionState().PeerCertificates
+	if len(certificates) == 0 {
+		return "", fmt.Errorf("%s:%d did not present a certificate", host, port)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificates[0].Raw})), nil
+}
+
+// printCertificates prints certificates to terminal in desired output format
+func printCertificates(outputFormat string, certificates []Certificate) {
+
+	// output in desired format
+	if outputFormat == "json" {
+
+		certificatesJSON, err := json.Marshal(certificates)
+		if err != nil {
+			fmt.Println("Error occured while converting the response to JSON: ", err)
+		}
+		fmt.Println(string(certificatesJSON))
+
+	} else {
+
+		for _, certificate := range certificates {
+			var hosts []string
+			for _, binding := range certificate.Bindings {
+				hosts = append(hosts, binding.Host+":"+strconv.Itoa(binding.Port))
+			}
+			fmt.Println(certificate.ID, certificate.NotAfter.Format("2006-01-02"), strings.Join(hosts, ","))
+		}
+
+	}
+}
+
+// printCertificate prints a single certificate to terminal in desired output format
+func printCertificate(certificateID string, outputFormat string, c Client) {
+	certificate, err := c.GetCertificate(certificateID)
+	if err != nil {
+		fmt.Println("Error occured while fetching certificate.", err)
+		return
+	}
+	if outputFormat == "json" {
+		certificateJSON, err := json.Marshal(certificate)
+		if err != nil {
+			fmt.Println("Error occured while converting the response to JSON: ", err)
+		}
+		fmt.Println(string(certificateJSON))
+		return
+	}
+	fmt.Println(certificate.ID)
+	fmt.Println("Subject:", certificate.Subject)
+	fmt.Println("Issuer:", certificate.Issuer)
+	fmt.Println("Serial:", certificate.Serial)
+	fmt.Println("Valid:", certificate.NotBefore.Format("2006-01-02"), "to", certificate.NotAfter.Format("2006-01-02"))
+	fmt.Println("SANs:", strings.Join(certificate.SANs, ", "))
+	for _, binding := range certificate.Bindings {
+		fmt.Println("Served by:", binding.Host+":"+strconv.Itoa(binding.Port), "last seen", binding.LastSeen.Format(time.RFC3339))
+	}
+}
+
+// CertsCLI handles the certs subcommand CLI
+func CertsCLI(c Client) {
+	if len(os.Args) < 3 {
+		fmt.Println("Invalid arguments. Hint: ./hakstore-client certs {list|import|fetch|unknown|delete}")
+		return
+	}
+	switch os.Args[2] {
+	case "list":
+		certsFlagSet := flag.NewFlagSet("certs list", flag.ExitOnError)
+		certificateID := certsFlagSet.String("id", "", "SHA256 fingerprint of certificate")
+		outputFormat := certsFlagSet.String("output", "", "output format")
+		programID := certsFlagSet.String("program", "", "only list certificates served in this program")
+		host := certsFlagSet.String("host", "", "only list certificates served by this host")
+		source := certsFlagSet.String("source", "", "only list certificates imported from this CT log source, e.g. crtsh")
+		expiring := certsFlagSet.Int("expiring", 0, "only list certificates that expire within this many days")
+		certsFlagSet.Parse(os.Args[3:])
+		if isFlagPassed("id", certsFlagSet) {
+			printCertificate(*certificateID, *outputFormat, c)
+			return
+		}
+		certificates, err := c.GetCertificates(CertificateFilter{ProgramID: *programID, Host: *host, Source: *source, ExpiringDays: *expiring})
+		if err != nil {
+			fmt.Println("Error retreiving certificates: ", err)
+		}
+		printCertificates(*outputFormat, certificates)
+	case "import", "fetch":
+		certsFlagSet := flag.NewFlagSet("certs "+os.Args[2], flag.ExitOnError)
+		host := certsFlagSet.String("host", "", "Subdomain or IP the certificate is served by")
+		port := certsFlagSet.Int("port", 443, "Port the certificate is served on")
+		filename := certsFlagSet.String("f", "", "PEM file holding the certificate, or - for stdin (import only)")
+		certsFlagSet.Parse(os.Args[3:])
+		if *host == "" {
+			fmt.Println("You need to specify the -host serving the certificate.")
+			return
+		}
+		var certificatePEM string
+		if os.Args[2] == "fetch" {
+			fetched, err := fetchCertificatePEM(*host, *port)
+			if err != nil {
+				fmt.Println("Error fetching certificate: ", err)
+				return
+			}
+			certificatePEM = fetched
+		} else {
+			if *filename == "" {
+				fmt.Println("You need to specify the PEM file to import with -f.")
+				return
+			}
+			var data []byte
+			var err error
+			if *filename == "-" {
+				data, err = ioutil.ReadAll(os.Stdin)
+			} else {
+				data, err = ioutil.ReadFile(*filename)
+			}
+			if err != nil {
+				fmt.Println("Error reading certificate: ", err)
+				return
+			}
+			certificatePEM = string(data)
+		}
+		certificates, err := c.CreateCertificates([]CertificateSubmission{{PEM: certificatePEM, Host: *host, Port: *port}})
+		if err != nil {
+			fmt.Println("An error occured while storing the certificate: ", err)
+			return
+		}
+		for _, certificate := range certificates {
+			fmt.Println(certificate.ID)
+		}
+	case "unknown":
+		certsFlagSet := flag.NewFlagSet("certs unknown", flag.ExitOnError)
+		programID := certsFlagSet.String("program", "", "only check certificates served in this program")
+		importNames := certsFlagSet.Bool("import", false, "import the unknown names as subdomains")
+		certsFlagSet.Parse(os.Args[3:])
+		subdomains, err := c.GetUnknownCertificateNames(*programID)
+		if err != nil {
+			fmt.Println("Error retreiving unknown names: ", err)
+			return
+		}
+		for _, subdomain := range subdomains {
+			fmt.Println(subdomain.ID)
+		}
+		if *importNames && len(subdomains) > 0 {
+			_, err = c.CreateSubdomains(subdomains)
+			if rejectedErr, ok := err.(*RejectedError); ok {
+				for _, reject := range rejectedErr.Rejected {
+					fmt.Println("Rejected", reject.Item+":", reject.Reason)
+				}
+			} else if err != nil {
+				fmt.Println("An error occured while importing the subdomains: ", err)
+			}
+		}
+	case "delete":
+		certsFlagSet := flag.NewFlagSet("certs delete", flag.ExitOnError)
+		certificateID := certsFlagSet.String("id", "", "SHA256 fingerprint of certificate")
+		certsFlagSet.Parse(os.Args[3:])
+		if *certificateID == "" {
+			fmt.Println("You need to specify the certificate to delete with -id.")
+			return
+		}
+		_, err := c.DeleteCertificate(*certificateID)
+		if err != nil {
+			fmt.Println("An error occured while deleting the certificate: ", err)
+		}
+	default:
+		fmt.Println("Invalid arguments. Hint: ./hakstore-client certs {list|import|fetch|unknown|delete}")
+	}
+}
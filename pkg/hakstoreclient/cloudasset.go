@@ -0,0 +1,371 @@
+package hakstoreclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// CloudAsset is a structure to store assets that aren't hostnames, like storage buckets, GitHub orgs, Slack
+// workspaces and mobile apps
+type CloudAsset struct {
+	gorm.Model
+	ID         int               `json:"id"`
+	Provider   string            `json:"provider"`
+	Kind       string            `json:"kind"`
+	Identifier string            `json:"identifier"`
+	ProgramID  string            `json:"program"`
+	Access     string            `json:"access"`
+	Attributes map[string]string `json:"attributes"`
+	Tags       []string          `json:"tags"`
+	Vulns      []*Vuln           `json:"vulns,omitempty"`
+}
+
+// CloudAccessStatuses describe who can get at a cloud asset. Unclaimed means the asset is referenced but doesn't
+// exist, so anyone could register it.
+var CloudAccessStatuses = []string{"unknown", "private", "authenticated", "public_read", "public_write", "unclaimed"}
+
+// CloudAssetUpdate holds the fields of a cloud asset to change with UpdateCloudAsset, fields that are nil are left
+// alone. Attributes are merged in and keys with an empty value are removed.
+type CloudAssetUpdate struct {
+	ProgramID  *string           `json:"program,omitempty"`
+	Access     *string           `json:"access,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Tags       *[]string         `json:"tags,omitempty"`
+	AddTags    []string          `json:"addtags,omitempty"`
+	RemoveTags []string          `json:"removetags,omitempty"`
+}
+
+// CloudAssetFilter narrows down the cloud assets returned by GetCloudAssets, empty fields don't filter anything
+type CloudAssetFilter struct {
+	ProgramID string
+	Provider  string
+	Kind      string
+	Access    string
+	Tag       string
+}
+
+// GetCloudAssets will get the cloud assets that match the filter
+func (c *Client) GetCloudAssets(filter CloudAssetFilter) ([]CloudAsset, error) {
+	query := url.Values{}
+	for key, value := range map[string]string{
+		"program":  filter.ProgramID,
+		"provider": filter.Provider,
+		"kind":     filter.Kind,
+		"access":   filter.Access,
+		"tag":      filter.Tag,
+	} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	rel := &url.URL{Path: "/api/cloudassets", RawQuery: query.Encode()}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var assets []CloudAsset
+	err = json.NewDecoder(resp.Body).Decode(&assets)
+	return assets, err
+}
+
+// GetCloudAsset will get a cloud asset
+func (c *Client) GetCloudAsset(id string) (CloudAsset, error) {
+	var asset CloudAsset
+	rel := &url.URL{Path: "/api/cloudassets/" + id}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return asset, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return asset, err
+	}
+	defer resp.Body.Close()
+	err = json.NewDecoder(resp.Body).Decode(&asset)
+	return asset, err
+}
+
+// CreateCloudAssets will create new cloud assets, or merge them into the stored assets with the same provider, kind
+// and identifier. Assets the server refused are returned in a *RejectedError.
+func (c *Client) CreateCloudAssets(assets []CloudAsset) ([]CloudAsset, error) {
+	var emptyassets []CloudAsset
+
+	jsonassets, err := json.Marshal(assets)
+	if err != nil {
+		log.Println("Could not convert cloud assets to JSON, are they in the correct format?")
+	}
+	rel := &url.URL{Path: "/api/cloudassets", RawQuery: "verbose=true"}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("POST", u.String(), bytes.NewBuffer(jsonassets))
+	if err != nil {
+		return emptyassets, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return emptyassets, err
+	}
+	defer resp.Body.Close()
+	var response struct {
+		Items    []CloudAsset `json:"items"`
+		Rejected []Reject     `json:"rejected"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return emptyassets, err
+	}
+	if len(response.Rejected) > 0 {
+		return response.Items, &RejectedError{Rejected: response.Rejected}
+	}
+	return response.Items, nil
+}
+
+// UpdateCloudAsset will update the specified cloud asset
+func (c *Client) UpdateCloudAsset(update CloudAssetUpdate, id string) (CloudAsset, error) {
+	var asset CloudAsset
+	jsonupdate, err := json.Marshal(update)
+	if err != nil {
+		log.Println("Could not convert cloud asset update to JSON, is it in the correct format?")
+	}
+	rel := &url.URL{Path: "/api/cloudassets/" + id}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("PUT", u.String(), bytes.NewBuffer(jsonupdate))
+	if err != nil {
+		return asset, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return asset, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return asset, responseError(resp)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&asset)
+	return asset, err
+}
+
+// DeleteCloudAsset will delete the specified cloud asset
+func (c *Client) DeleteCloudAsset(id string) (bool, error) {
+	rel := &url.URL{Path: "/api/cloudassets/" + id}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("DELETE", u.String(), nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	return true, nil
+}
+
+// parseCloudAssetRef parses a reference to a cloud asset from the cli, either its ID or provider/kind/identifier
+// like aws/s3/tesla-assets. The identifier may contain slashes itself.
+func parseCloudAssetRef(ref string) (*CloudAsset, error) {
+	if id, err := strconv.Atoi(ref); err == nil {
+		return &CloudAsset{ID: id}, nil
+	}
+	parts := strings.SplitN(ref, "/", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("invalid cloud asset %q, use its ID or provider/kind/identifier like aws/s3/tesla-assets", ref)
+	}
+	return &CloudAsset{Provider: parts[0], Kind: parts[1], Identifier: parts[2]}, nil
+}
+
+// printCloudAssets prints cloud assets to terminal in desired output format
+func printCloudAssets(outputFormat string, assets []CloudAsset) {
+
+	// output in desired format
+	if outputFormat == "json" {
+
+		assetsJSON, err := json.Marshal(assets)
+		if err != nil {
+			fmt.Println("Error occured while converting the response to JSON: ", err)
+		}
+		fmt.Println(string(assetsJSON))
+
+	} else {
+
+		for _, asset := range assets {
+			fmt.Println(asset.ID, asset.Provider+"/"+asset.Kind+"/"+asset.Identifier, asset.ProgramID, asset.Access, strings.Join(asset.Tags, ","))
+		}
+
+	}
+}
+
+// CloudCLI handles the cloud subcommand CLI
+func CloudCLI(c Client) {
+	if len(os.Args) < 3 {
+		fmt.Println("Invalid arguments. Hint: ./hakstore-client cloud {list|create|update|tag|untag|delete}")
+		return
+	}
+	switch os.Args[2] {
+	case "list":
+		cloudFlagSet := flag.NewFlagSet("cloud list", flag.ExitOnError)
+		assetID := cloudFlagSet.String("id", "", "ID of cloud asset")
+		outputFormat := cloudFlagSet.String("output", "", "output format")
+		programID := cloudFlagSet.String("program", "", "only list assets in this program")
+		provider := cloudFlagSet.String("provider", "", "only list assets from this provider, e.g. aws")
+		kind := cloudFlagSet.String("kind", "", "only list assets of this kind, e.g. s3")
+		access := cloudFlagSet.String("access", "", "only list assets with this access status, one of "+strings.Join(CloudAccessStatuses, ", "))
+		tag := cloudFlagSet.String("tag", "", "only list assets with this tag")
+		cloudFlagSet.Parse(os.Args[3:])
+		if isFlagPassed("id", cloudFlagSet) {
+			asset, err := c.GetCloudAsset(*assetID)
+			if err != nil {
+				fmt.Println("Error retreiving cloud asset: ", err)
+				return
+			}
+			printCloudAssets(*outputFormat, []CloudAsset{asset})
+			if *outputFormat == "json" {
+				return
+			}
+			for key, value := range asset.Attributes {
+				fmt.Println(key+":", value)
+			}
+			for _, vuln := range asset.Vulns {
+				fmt.Println("Vuln:", vuln.ID, SeverityString(vuln.Severity), vuln.Status, vuln.Title)
+			}
+			return
+		}
+		filter := CloudAssetFilter{ProgramID: *programID, Provider: *provider, Kind: *kind, Access: *access, Tag: *tag}
+		assets, err := c.GetCloudAssets(filter)
+		if err != nil {
+			fmt.Println("Error retreiving cloud assets: ", err)
+		}
+		printCloudAssets(*outputFormat, assets)
+	case "create":
+		cloudFlagSet := flag.NewFlagSet("cloud create", flag.ExitOnError)
+		provider := cloudFlagSet.String("provider", "", "Provider of the asset, e.g. aws, gcp, azure, github, slack")
+		kind := cloudFlagSet.String("kind", "", "Kind of asset, e.g. s3, gcs, blob, org, workspace, app")
+		identifier := cloudFlagSet.String("identifier", "", "Identifier of the asset, e.g. a bucket name or app ID")
+		programID := cloudFlagSet.String("program", "", "Program that the asset is associated with")
+		access := cloudFlagSet.String("access", "", "Access status of the asset, one of "+strings.Join(CloudAccessStatuses, ", "))
+		var attributes, tags stringsFlag
+		cloudFlagSet.Var(&attributes, "attr", "Attribute of the asset as key=value, e.g. region=us-east-1. Can be used more than once.")
+		cloudFlagSet.Var(&tags, "tag", "Tag for the asset. Can be used more than once.")
+		cloudFlagSet.Parse(os.Args[3:])
+		if *provider == "" || *kind == "" || *identifier == "" {
+			fmt.Println("You need to specify a -provider, -kind and -identifier to create the cloud asset.")
+			return
+		}
+		attributeMap, err := parseKeyValues("attr", attributes)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		asset := CloudAsset{
+			Provider:   *provider,
+			Kind:       *kind,
+			Identifier: *identifier,
+			ProgramID:  *programID,
+			Access:     *access,
+			Attributes: attributeMap,
+			Tags:       tags,
+		}
+		assets, err := c.CreateCloudAssets([]CloudAsset{asset})
+		if err != nil {
+			fmt.Println("An error occured while creating the cloud asset: ", err)
+			return
+		}
+		for _, asset := range assets {
+			fmt.Println(asset.ID)
+		}
+	case "update":
+		cloudFlagSet := flag.NewFlagSet("cloud update", flag.ExitOnError)
+		assetID := cloudFlagSet.String("id", "", "ID of cloud asset")
+		programID := cloudFlagSet.String("program", "", "Program that the asset is associated with")
+		access := cloudFlagSet.String("access", "", "Access status of the asset, one of "+strings.Join(CloudAccessStatuses, ", "))
+		var attributes stringsFlag
+		cloudFlagSet.Var(&attributes, "attr", "Attribute of the asset as key=value, an empty value removes it. Can be used more than once.")
+		cloudFlagSet.Parse(os.Args[3:])
+		if *assetID == "" {
+			fmt.Println("You need to specify the cloud asset to update with -id.")
+			return
+		}
+		var update CloudAssetUpdate
+		if isFlagPassed("program", cloudFlagSet) {
+			update.ProgramID = programID
+		}
+		if isFlagPassed("access", cloudFlagSet) {
+			update.Access = access
+		}
+		attributeMap, err := parseKeyValues("attr", attributes)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		update.Attributes = attributeMap
+		_, err = c.UpdateCloudAsset(update, *assetID)
+		if err != nil {
+			fmt.Println("An error occured while updating the cloud asset: ", err)
+		}
+	case "tag", "untag":
+		cloudFlagSet := flag.NewFlagSet("cloud "+os.Args[2], flag.ExitOnError)
+		assetID := cloudFlagSet.String("id", "", "ID of cloud asset")
+		var tags stringsFlag
+		cloudFlagSet.Var(&tags, "tag", "Tag to add or remove. Can be used more than once.")
+		cloudFlagSet.Parse(os.Args[3:])
+		if *assetID == "" || len(tags) == 0 {
+			fmt.Println("You need to specify the cloud asset with -id and at least one -tag.")
+			return
+		}
+		var update CloudAssetUpdate
+		if os.Args[2] == "tag" {
+			update.AddTags = tags
+		} else {
+			update.RemoveTags = tags
+		}
+		_, err := c.UpdateCloudAsset(update, *assetID)
+		if err != nil {
+			fmt.Println("An error occured while tagging the cloud asset: ", err)
+		}
+	case "delete":
+		cloudFlagSet := flag.NewFlagSet("cloud delete", flag.ExitOnError)
+		assetID := cloudFlagSet.String("id", "", "ID of cloud asset")
+		cloudFlagSet.Parse(os.Args[3:])
+		if *assetID == "" {
+			fmt.Println("You need to specify the cloud asset to delete with -id.")
+			return
+		}
+		_, err := c.DeleteCloudAsset(*assetID)
+		if err != nil {
+			fmt.Println("An error occured while deleting the cloud asset: ", err)
+		}
+	default:
+		fmt.Println("Invalid arguments. Hint: ./hakstore-client cloud {list|create|update|tag|untag|delete}")
+	}
+}
@@ -0,0 +1,89 @@
+package hakstoreclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DNSRecord is a DNS record of a subdomain, e.g. from a zone file. Names in the value have no trailing dot and MX
+// records are "preference exchange".
+type DNSRecord struct {
+	gorm.Model
+	ID          int       `json:"id"`
+	SubdomainID string    `json:"subdomain"`
+	Type        string    `json:"type"`
+	Value       string    `json:"value"`
+	TTL         int       `json:"ttl"`
+	Source      string    `json:"source"`
+	FirstSeen   time.Time `json:"firstseen"`
+	LastSeen    time.Time `json:"lastseen"`
+}
+
+// DNSRecordFilter narrows down the records returned by GetDNSRecords, empty fields don't filter anything
+type DNSRecordFilter struct {
+	SubdomainID string
+	Type        string
+	Value       string
+	ProgramID   string
+}
+
+// GetDNSRecords will get the DNS records that match the filter
+func (c *Client) GetDNSRecords(filter DNSRecordFilter) ([]DNSRecord, error) {
+	query := url.Values{}
+	if filter.SubdomainID != "" {
+		query.Set("subdomain", filter.SubdomainID)
+	}
+	if filter.Type != "" {
+		query.Set("type", filter.Type)
+	}
+	if filter.Value != "" {
+		query.Set("value", filter.Value)
+	}
+	if filter.ProgramID != "" {
+		query.Set("program", filter.ProgramID)
+	}
+	rel := &url.URL{Path: "/api/dnsrecords", RawQuery: query.Encode()}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+	var records []DNSRecord
+	err = json.NewDecoder(resp.Body).Decode(&records)
+	return records, err
+}
+
+// printDNSRecords prints DNS records in zone file order (name, TTL, type, value), or as JSON
+func printDNSRecords(outputFormat string, records []DNSRecord) {
+	if outputFormat == "json" {
+		recordsJSON, err := json.Marshal(records)
+		if err != nil {
+			fmt.Println("Error occured while converting the response to JSON: ", err)
+		}
+		fmt.Println(string(recordsJSON))
+		return
+	}
+	for _, record := range records {
+		value := record.Value
+		if record.Type == "TXT" {
+			value = fmt.Sprintf("%q", value)
+		}
+		fmt.Printf("%s\t%d\t%s\t%s\n", record.SubdomainID, record.TTL, record.Type, value)
+	}
+}
@@ -0,0 +1,312 @@
+package hakstoreclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Endpoint is a structure to store a URL found by crawlers and archive sources
+type Endpoint struct {
+	gorm.Model
+	ID          int       `json:"id"`
+	URL         string    `json:"url"`
+	Method      string    `json:"method"`
+	Host        string    `json:"host"`
+	SubdomainID string    `json:"subdomain"`
+	ProgramID   string    `json:"program"`
+	Path        string    `json:"path"`
+	Parameters  []string  `json:"parameters"`
+	Sources     []string  `json:"sources"`
+	FirstSeen   time.Time `json:"firstseen"`
+	LastSeen    time.Time `json:"lastseen"`
+}
+
+// EndpointFilter narrows down the endpoints returned by GetEndpoints, empty fields don't filter anything
+type EndpointFilter struct {
+	ProgramID   string
+	SubdomainID string
+	Host        string
+	PathPrefix  string
+	Parameter   string
+}
+
+// GetEndpoints will get the endpoints that match the filter
+func (c *Client) GetEndpoints(filter EndpointFilter) ([]Endpoint, error) {
+	query := url.Values{}
+	if filter.ProgramID != "" {
+		query.Set("program", filter.ProgramID)
+	}
+	if filter.SubdomainID != "" {
+		query.Set("subdomain", filter.SubdomainID)
+	}
+	if filter.Host != "" {
+		query.Set("host", filter.Host)
+	}
+	if filter.PathPrefix != "" {
+		query.Set("path", filter.PathPrefix)
+	}
+	if filter.Parameter != "" {
+		query.Set("parameter", filter.Parameter)
+	}
+	rel := &url.URL{Path: "/api/endpoints", RawQuery: query.Encode()}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var endpoints []Endpoint
+	err = json.NewDecoder(resp.Body).Decode(&endpoints)
+	return endpoints, err
+}
+
+// GetEndpoint will get an endpoint
+func (c *Client) GetEndpoint(id string) (Endpoint, error) {
+	var endpoint Endpoint
+	rel := &url.URL{Path: "/api/endpoints/" + id}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return endpoint, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return endpoint, err
+	}
+	defer resp.Body.Close()
+	err = json.NewDecoder(resp.Body).Decode(&endpoint)
+	return endpoint, err
+}
+
+// CreateEndpoints will create new endpoints, or merge them into the stored ones with the same URL. Endpoints the
+// server refused are returned in a *RejectedError.
+func (c *Client) CreateEndpoints(endpoints []Endpoint) ([]Endpoint, error) {
+	var emptyendpoints []Endpoint
+
+	jsonendpoints, err := json.Marshal(endpoints)
+	if err != nil {
+		log.Println("Could not convert endpoints to JSON, are they in the correct format?")
+	}
+	rel := &url.URL{Path: "/api/endpoints", RawQuery: "verbose=true"}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("POST", u.String(), bytes.NewBuffer(jsonendpoints))
+	if err != nil {
+		return emptyendpoints, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return emptyendpoints, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return emptyendpoints, responseError(resp)
+	}
+	var response struct {
+		Items    []Endpoint `json:"items"`
+		Rejected []Reject   `json:"rejected"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return emptyendpoints, err
+	}
+	if len(response.Rejected) > 0 {
+		return response.Items, &RejectedError{Rejected: response.Rejected}
+	}
+	return response.Items, nil
+}
+
+// DeleteEndpoint will delete the specified endpoint
+func (c *Client) DeleteEndpoint(id string) (bool, error) {
+	rel := &url.URL{Path: "/api/endpoints/" + id}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("DELETE", u.String(), nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	return true, nil
+}
+
+// printEndpoints prints endpoints to terminal in desired output format
+func printEndpoints(outputFormat string, endpoints []Endpoint) {
+
+	// output in desired format
+	if outputFormat == "json" {
+
+		endpointsJSON, err := json.Marshal(endpoints)
+		if err != nil {
+			fmt.Println("Error occured while converting the response to JSON: ", err)
+		}
+		fmt.Println(string(endpointsJSON))
+
+	} else {
+
+		for _, endpoint := range endpoints {
+			fmt.Println(endpoint.Method, endpoint.URL)
+		}
+
+	}
+}
+
+// ImportEndpointsFromFile reads one URL per line from a file, or stdin if the filename is -, and stores them as
+// endpoints. The file is read a line at a time and sent in batches, so it can be as large as needed.
+func ImportEndpointsFromFile(filename string, method string, source string, options StreamOptions, c Client) (StreamSummary, error) {
+	file, err := openImportFile(filename)
+	if err != nil {
+		return StreamSummary{}, err
+	}
+	defer file.Close()
+
+	read := func(emit func(item interface{}, line int), reject func(Reject)) error {
+		return readLines(file, func(line string, number int) {
+			endpoint := Endpoint{URL: line, Method: method}
+			if source != "" {
+				endpoint.Sources = []string{source}
+			}
+			emit(endpoint, number)
+		})
+	}
+	send := func(batch []interface{}) error {
+		endpoints := make([]Endpoint, len(batch))
+		for i, item := range batch {
+			endpoints[i] = item.(Endpoint)
+		}
+		_, err := c.CreateEndpoints(endpoints)
+		return err
+	}
+	return streamImport(options, read, send), nil
+}
+
+// UrlsCLI handles the urls subcommand CLI
+func UrlsCLI(c Client) {
+	if len(os.Args) < 3 {
+		fmt.Println("Invalid arguments. Hint: ./hakstore-client urls {list|create|import|delete}")
+		return
+	}
+	switch os.Args[2] {
+	case "list":
+		urlsFlagSet := flag.NewFlagSet("urls list", flag.ExitOnError)
+		endpointID := urlsFlagSet.String("id", "", "ID of endpoint")
+		outputFormat := urlsFlagSet.String("output", "", "output format")
+		programID := urlsFlagSet.String("program", "", "only list endpoints in this program")
+		subdomainID := urlsFlagSet.String("subdomain", "", "only list endpoints on this subdomain")
+		host := urlsFlagSet.String("host", "", "only list endpoints on this host, a hostname or IP")
+		pathPrefix := urlsFlagSet.String("path", "", "only list endpoints whose path starts with this")
+		parameter := urlsFlagSet.String("param", "", "only list endpoints that take this parameter, e.g. redirect")
+		urlsFlagSet.Parse(os.Args[3:])
+		if isFlagPassed("id", urlsFlagSet) {
+			endpoint, err := c.GetEndpoint(*endpointID)
+			if err != nil {
+				fmt.Println("Error retreiving endpoint: ", err)
+				return
+			}
+			if *outputFormat == "json" {
+				printEndpoints(*outputFormat, []Endpoint{endpoint})
+				return
+			}
+			fmt.Println(endpoint.Method, endpoint.URL)
+			fmt.Println("Program:", endpoint.ProgramID)
+			fmt.Println("Host:", endpoint.Host)
+			fmt.Println("Parameters:", strings.Join(endpoint.Parameters, ", "))
+			fmt.Println("Sources:", strings.Join(endpoint.Sources, ", "))
+			fmt.Println("First seen:", endpoint.FirstSeen.Format(time.RFC3339))
+			fmt.Println("Last seen:", endpoint.LastSeen.Format(time.RFC3339))
+			return
+		}
+		filter := EndpointFilter{
+			ProgramID:   *programID,
+			SubdomainID: *subdomainID,
+			Host:        *host,
+			PathPrefix:  *pathPrefix,
+			Parameter:   *parameter,
+		}
+		endpoints, err := c.GetEndpoints(filter)
+		if err != nil {
+			fmt.Println("Error retreiving endpoints: ", err)
+		}
+		printEndpoints(*outputFormat, endpoints)
+	case "create":
+		urlsFlagSet := flag.NewFlagSet("urls create", flag.ExitOnError)
+		endpointURL := urlsFlagSet.String("url", "", "URL of the endpoint, e.g. https://www.tesla.com/login?next=/")
+		method := urlsFlagSet.String("method", "GET", "HTTP method of the endpoint")
+		source := urlsFlagSet.String("source", "", "Where the endpoint was found, e.g. gau or hakrawler")
+		var parameters stringsFlag
+		urlsFlagSet.Var(&parameters, "param", "Parameter taken by the endpoint that isn't in the URL, e.g. a POST body parameter. Can be used more than once.")
+		urlsFlagSet.Parse(os.Args[3:])
+		if *endpointURL == "" {
+			fmt.Println("You need to specify the -url of the endpoint.")
+			return
+		}
+		endpoint := Endpoint{URL: *endpointURL, Method: *method, Parameters: parameters}
+		if *source != "" {
+			endpoint.Sources = []string{*source}
+		}
+		_, err := c.CreateEndpoints([]Endpoint{endpoint})
+		if err != nil {
+			fmt.Println("An error occured while creating the endpoint: ", err)
+		}
+	case "import":
+		urlsFlagSet := flag.NewFlagSet("urls import", flag.ExitOnError)
+		filename := urlsFlagSet.String("f", "", "File containing one URL per line, or - for stdin")
+		method := urlsFlagSet.String("method", "GET", "HTTP method of the endpoints")
+		source := urlsFlagSet.String("source", "", "Where the endpoints were found, e.g. gau or hakrawler")
+		outputFormat := urlsFlagSet.String("output", "", "output format")
+		stream := addStreamFlags(urlsFlagSet)
+		urlsFlagSet.Parse(os.Args[3:])
+		file := importFilename(*filename, urlsFlagSet)
+		if file == "" {
+			fmt.Println("You need to specify a file to import with -f, or - for stdin.")
+			return
+		}
+		summary, err := ImportEndpointsFromFile(file, *method, *source, stream.options(), c)
+		if err != nil {
+			fmt.Println("Error opening file: ", err)
+			os.Exit(1)
+		}
+		finishStreamImport(*outputFormat, summary)
+	case "delete":
+		urlsFlagSet := flag.NewFlagSet("urls delete", flag.ExitOnError)
+		endpointID := urlsFlagSet.String("id", "", "ID of endpoint")
+		urlsFlagSet.Parse(os.Args[3:])
+		if *endpointID == "" {
+			fmt.Println("You need to specify the endpoint to delete with -id.")
+			return
+		}
+		_, err := c.DeleteEndpoint(*endpointID)
+		if err != nil {
+			fmt.Println("An error occured while deleting the endpoint: ", err)
+		}
+	default:
+		fmt.Println("Invalid arguments. Hint: ./hakstore-client urls {list|create|import|delete}")
+	}
+}
@@ -2,9 +2,12 @@ package hakstoreclient
 
 import (
 	"flag"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"sort"
+	"strings"
 )
 
 // Export will export the whole database to markdown files for obsidian
@@ -41,7 +44,13 @@ func ExportCLI(c Client) {
 			if err != nil {
 				log.Println("Error creating directory:", err)
 			}
-			fileContents := []byte("# " + program.ID + "\n\nPlatform: [[" + program.PlatformID + "]]")
+			// the associated programs don't carry bounties, so fetch the program itself
+			if fullProgram, err := c.GetProgram(program.ID); err == nil {
+				program = fullProgram
+			} else {
+				log.Println("Error retrieving program", err)
+			}
+			fileContents := []byte(programMarkdown(program))
 			err = ioutil.WriteFile(outputDir+"/"+platform.ID+"/"+program.ID+"/"+program.ID+".md", fileContents, 0644)
 			if err != nil {
 				log.Println("Error writing file:", err)
@@ -75,3 +84,51 @@ func ExportCLI(c Client) {
 		}
 	}
 }
+
+// programMarkdown renders a program's details as an obsidian note
+func programMarkdown(program Program) string {
+	var b strings.Builder
+	title := program.ID
+	if program.Name != "" {
+		title = program.Name
+	}
+	b.WriteString("# " + title + "\n\nPlatform: [[" + program.PlatformID + "]]\n")
+	if program.URL != "" {
+		b.WriteString("URL: " + program.URL + "\n")
+	}
+	if program.Type != "" {
+		b.WriteString("Type: " + program.Type + "\n")
+	}
+	if program.State != "" {
+		b.WriteString("State: " + program.State + "\n")
+	}
+	if program.SafeHarbour {
+		b.WriteString("Safe harbour: yes\n")
+	} else {
+		b.WriteString("Safe harbour: no\n")
+	}
+	if program.LaunchDate != nil {
+		b.WriteString("Launched: " + program.LaunchDate.Format("2006-01-02") + "\n")
+	}
+	if len(program.Bounties) > 0 {
+		b.WriteString("\n## Bounties\n\n| Severity | Min | Max | Currency |\n| --- | --- | --- | --- |\n")
+		for _, bounty := range program.Bounties {
+			fmt.Fprintf(&b, "| %s | %.2f | %.2f | %s |\n", SeverityString(bounty.Severity), bounty.Min, bounty.Max, bounty.Currency)
+		}
+	}
+	if len(program.Metadata) > 0 {
+		keys := make([]string, 0, len(program.Metadata))
+		for key := range program.Metadata {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		b.WriteString("\n## Metadata\n\n")
+		for _, key := range keys {
+			b.WriteString("- " + key + ": " + program.Metadata[key] + "\n")
+		}
+	}
+	if program.Policy != "" {
+		b.WriteString("\n## Policy\n\n" + program.Policy + "\n")
+	}
+	return b.String()
+}
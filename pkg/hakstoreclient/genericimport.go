@@ -0,0 +1,564 @@
+package hakstoreclient
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// genericRow holds the items built from a single row of a generic import, the ones the mapping doesn't mention stay
+// nil
+type genericRow struct {
+	subdomain *Subdomain
+	ip        *IP
+	vuln      *Vuln
+	endpoint  *Endpoint
+}
+
+func (r *genericRow) getSubdomain() *Subdomain {
+	if r.subdomain == nil {
+		r.subdomain = &Subdomain{}
+	}
+	return r.subdomain
+}
+
+func (r *genericRow) getIP() *IP {
+	if r.ip == nil {
+		r.ip = &IP{}
+	}
+	return r.ip
+}
+
+func (r *genericRow) getVuln() *Vuln {
+	if r.vuln == nil {
+		r.vuln = &Vuln{}
+	}
+	return r.vuln
+}
+
+func (r *genericRow) getEndpoint() *Endpoint {
+	if r.endpoint == nil {
+		r.endpoint = &Endpoint{}
+	}
+	return r.endpoint
+}
+
+// splitList splits a comma separated value into its trimmed, non-empty parts
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// GenericFields are the model fields a column or JSON path can be mapped to in a generic import. Fields that hold
+// lists take comma separated values.
+var GenericFields = map[string]func(row *genericRow, value string) error{
+	"subdomain.id":         func(row *genericRow, value string) error { row.getSubdomain().ID = value; return nil },
+	"subdomain.rootdomain": func(row *genericRow, value string) error { row.getSubdomain().RootDomainID = value; return nil },
+	"subdomain.sources": func(row *genericRow, value string) error {
+		row.getSubdomain().Sources = append(row.getSubdomain().Sources, splitList(value)...)
+		return nil
+	},
+	"ip.id":      func(row *genericRow, value string) error { row.getIP().ID = value; return nil },
+	"ip.program": func(row *genericRow, value string) error { row.getIP().ProgramID = value; return nil },
+	"vuln.title": func(row *genericRow, value string) error { row.getVuln().Title = value; return nil },
+	"vuln.description": func(row *genericRow, value string) error {
+		row.getVuln().Description = value
+		return nil
+	},
+	"vuln.severity": func(row *genericRow, value string) error {
+		severity := SeverityFromString(value)
+		if severity == 0 {
+			return fmt.Errorf("unknown severity %q", value)
+		}
+		row.getVuln().Severity = severity
+		return nil
+	},
+	"vuln.checkid":    func(row *genericRow, value string) error { row.getVuln().CheckID = value; return nil },
+	"vuln.matchedat":  func(row *genericRow, value string) error { row.getVuln().MatchedAt = value; return nil },
+	"vuln.program":    func(row *genericRow, value string) error { row.getVuln().ProgramID = value; return nil },
+	"vuln.url":        func(row *genericRow, value string) error { row.getVuln().URL = value; return nil },
+	"vuln.parameter":  func(row *genericRow, value string) error { row.getVuln().Parameter = value; return nil },
+	"vuln.cvssvector": func(row *genericRow, value string) error { row.getVuln().CVSSVector = value; return nil },
+	"vuln.cwe":        func(row *genericRow, value string) error { row.getVuln().CWE = value; return nil },
+	"vuln.cves": func(row *genericRow, value string) error {
+		row.getVuln().CVEs = append(row.getVuln().CVEs, splitList(value)...)
+		return nil
+	},
+	"vuln.references": func(row *genericRow, value string) error {
+		row.getVuln().References = append(row.getVuln().References, splitList(value)...)
+		return nil
+	},
+	"vuln.poc":        func(row *genericRow, value string) error { row.getVuln().PoC = value; return nil },
+	"endpoint.url":    func(row *genericRow, value string) error { row.getEndpoint().URL = value; return nil },
+	"endpoint.method": func(row *genericRow, value string) error { row.getEndpoint().Method = value; return nil },
+	"endpoint.sources": func(row *genericRow, value string) error {
+		row.getEndpoint().Sources = append(row.getEndpoint().Sources, splitList(value)...)
+		return nil
+	},
+	"endpoint.parameters": func(row *genericRow, value string) error {
+		row.getEndpoint().Parameters = append(row.getEndpoint().Parameters, splitList(value)...)
+		return nil
+	},
+}
+
+// GenericMapping says which column (CSV) or dotted JSON path (NDJSON) goes into which model field, e.g.
+// {"host": "subdomain.id", "info.severity": "vuln.severity"}. Constants are values put into fields on every row,
+// e.g. {"vuln.program": "tesla"}.
+type GenericMapping struct {
+	Fields    map[string]string
+	Constants map[string]string
+}
+
+// Validate checks that every field in the mapping is one that can be imported into
+func (m GenericMapping) Validate() error {
+	if len(m.Fields) == 0 {
+		return errors.New("the mapping is empty")
+	}
+	var fields []string
+	for _, field := range m.Fields {
+		fields = append(fields, field)
+	}
+	for field := range m.Constants {
+		fields = append(fields, field)
+	}
+	for _, field := range fields {
+		if _, ok := GenericFields[field]; !ok {
+			var known []string
+			for name := range GenericFields {
+				known = append(known, name)
+			}
+			sort.Strings(known)
+			return fmt.Errorf("unknown field %q, fields that can be imported into are: %s", field, strings.Join(known, ", "))
+		}
+	}
+	return nil
+}
+
+// ParseGenericMapping reads mappings written as source=field, or source:field, e.g. host=subdomain.id. Several can
+// be given in one value separated by commas.
+func ParseGenericMapping(values []string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	for _, value := range values {
+		for _, pair := range splitList(value) {
+			parts := strings.SplitN(pair, "=", 2)
+			if len(parts) != 2 {
+				parts = strings.SplitN(pair, ":", 2)
+			}
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return nil, fmt.Errorf("invalid mapping %q, it should look like host=subdomain.id", pair)
+			}
+			mapping[strings.TrimSpace(parts[0])] = strings.ToLower(strings.TrimSpace(parts[1]))
+		}
+	}
+	return mapping, nil
+}
+
+// jsonPath looks up a dotted path like info.severity or addresses.0.ip in a decoded JSON object, and returns the
+// value as a string. Lists of values are joined with commas.
+func jsonPath(object interface{}, path string) (string, bool) {
+	current := object
+	for _, key := range strings.Split(path, ".") {
+		switch value := current.(type) {
+		case map[string]interface{}:
+			next, ok := value[key]
+			if !ok {
+				return "", false
+			}
+			current = next
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(value) {
+				return "", false
+			}
+			current = value[i]
+		default:
+			return "", false
+		}
+	}
+	return jsonString(current), current != nil
+}
+
+// jsonString turns a decoded JSON value into the string it would be in a CSV column
+func jsonString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		var items []string
+		for _, item := range v {
+			items = append(items, jsonString(item))
+		}
+		return strings.Join(items, ",")
+	}
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
+
+// GenericError is a problem with one row of a generic import
+type GenericError struct {
+	Row    int    `json:"row"`
+	Item   string `json:"item,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// GenericResult is what a generic import sent and what was rejected, by row where it is known
+type GenericResult struct {
+	Rows   int            `json:"rows"`
+	Sent   map[string]int `json:"sent"`
+	Errors []GenericError `json:"errors"`
+}
+
+// genericBatch is the items of one kind waiting to be sent, along with the row each came from so rejections can be
+// reported against the row
+type genericBatch struct {
+	items []interface{}
+	keys  []string
+	rows  []int
+}
+
+// ImportGeneric reads NDJSON or CSV (with a header row) from a reader, builds subdomains, IPs, vulns and endpoints
+// from each row using the mapping, and stores them in batches of batchSize with the Create methods. IPs that are on
+// the same row as a subdomain are associated with it, and vulns are linked to the subdomain and IP on their row.
+func (c *Client) ImportGeneric(reader io.Reader, format string, mapping GenericMapping, batchSize int) (GenericResult, error) {
+	result := GenericResult{Sent: make(map[string]int)}
+	err := mapping.Validate()
+	if err != nil {
+		return result, err
+	}
+	if batchSize < 1 {
+		batchSize = 500
+	}
+
+	buffered := bufio.NewReader(reader)
+	if format == "" {
+		format = "csv"
+		if start, err := buffered.Peek(1); err == nil && (start[0] == '{' || start[0] == '[') {
+			format = "ndjson"
+		}
+	}
+	rows, err := genericRows(buffered, format, mapping.Fields)
+	if err != nil {
+		return result, err
+	}
+
+	batches := map[string]*genericBatch{}
+	associations := make(map[string][]IP)
+	associationRows := make(map[string][]int)
+	add := func(kind string, item interface{}, key string, row int) {
+		batch, ok := batches[kind]
+		if !ok {
+			batch = &genericBatch{}
+			batches[kind] = batch
+		}
+		batch.items = append(batch.items, item)
+		batch.keys = append(batch.keys, key)
+		batch.rows = append(batch.rows, row)
+	}
+	// flush sends everything waiting, subdomains and IPs go first so the associations and vulns have something to
+	// point at
+	flush := func() {
+		for _, kind := range []string{"subdomains", "ips", "endpoints"} {
+			if batch, ok := batches[kind]; ok {
+				c.sendGenericBatch(kind, batch, &result)
+			}
+		}
+		for subdomain, ips := range associations {
+			_, err := c.AssociateIPWithSubdomain(ips, Subdomain{ID: subdomain})
+			if err == nil {
+				continue
+			}
+			// an IP that was rejected is reported against its own row, anything else against every row involved
+			var rejectedErr *RejectedError
+			if errors.As(err, &rejectedErr) {
+				for _, reject := range rejectedErr.Rejected {
+					row := 0
+					if reject.Index != nil && *reject.Index >= 0 && *reject.Index < len(associationRows[subdomain]) {
+						row = associationRows[subdomain][*reject.Index]
+					}
+					result.Errors = append(result.Errors, GenericError{Row: row, Item: subdomain + " " + reject.Item, Reason: "associating ip: " + reject.Reason})
+				}
+				continue
+			}
+			for i, row := range associationRows[subdomain] {
+				result.Errors = append(result.Errors, GenericError{Row: row, Item: subdomain + " " + ips[i].ID, Reason: "associating ip: " + err.Error()})
+			}
+		}
+		associations = make(map[string][]IP)
+		associationRows = make(map[string][]int)
+		if batch, ok := batches["vulns"]; ok {
+			c.sendGenericBatch("vulns", batch, &result)
+		}
+	}
+
+	for values := range rows {
+		result.Rows++
+		number := result.Rows
+		if values.err != nil {
+			result.Errors = append(result.Errors, GenericError{Row: number, Reason: values.err.Error()})
+			continue
+		}
+		var row genericRow
+		var rowErr error
+		for _, fields := range []map[string]string{values.fields, mapping.Constants} {
+			for field, value := range fields {
+				if value = strings.TrimSpace(value); value == "" {
+					continue
+				}
+				if err := GenericFields[field](&row, value); err != nil && rowErr == nil {
+					rowErr = err
+				}
+			}
+		}
+		if rowErr != nil {
+			result.Errors = append(result.Errors, GenericError{Row: number, Reason: rowErr.Error()})
+			continue
+		}
+
+		if row.subdomain != nil && row.subdomain.ID != "" {
+			add("subdomains", *row.subdomain, row.subdomain.ID, number)
+		}
+		if row.ip != nil && row.ip.ID != "" {
+			if row.subdomain != nil && row.subdomain.ID != "" {
+				associations[row.subdomain.ID] = append(associations[row.subdomain.ID], IP{ID: row.ip.ID})
+				associationRows[row.subdomain.ID] = append(associationRows[row.subdomain.ID], number)
+			}
+			add("ips", *row.ip, row.ip.ID, number)
+		}
+		if row.endpoint != nil && row.endpoint.URL != "" {
+			add("endpoints", *row.endpoint, row.endpoint.URL, number)
+		}
+		if row.vuln != nil {
+			vuln := *row.vuln
+			if row.subdomain != nil && row.subdomain.ID != "" {
+				vuln.Subdomains = []*Subdomain{{ID: row.subdomain.ID}}
+			}
+			if row.ip != nil && row.ip.ID != "" {
+				vuln.IPs = []*IP{{ID: row.ip.ID}}
+			}
+			add("vulns", vuln, genericVulnItem(vuln), number)
+		}
+		for _, batch := range batches {
+			if len(batch.items) >= batchSize {
+				flush()
+				break
+			}
+		}
+	}
+
+	flush()
+	sort.SliceStable(result.Errors, func(i, j int) bool { return result.Errors[i].Row < result.Errors[j].Row })
+	return result, nil
+}
+
+// genericVulnItem names a vuln in the errors of a generic import, the same way the server does when it rejects one
+func genericVulnItem(vuln Vuln) string {
+	if vuln.Title != "" {
+		return vuln.Title
+	}
+	if vuln.CheckID != "" {
+		return vuln.CheckID
+	}
+	return vuln.Description
+}
+
+// sendGenericBatch stores the waiting items of a kind and empties the batch, rejected items are reported against
+// the rows they came from
+func (c *Client) sendGenericBatch(kind string, batch *genericBatch, result *GenericResult) {
+	if len(batch.items) == 0 {
+		return
+	}
+	var err error
+	switch kind {
+	case "subdomains":
+		var subdomains []Subdomain
+		for _, item := range batch.items {
+			subdomains = append(subdomains, item.(Subdomain))
+		}
+		_, err = c.CreateSubdomains(subdomains)
+	case "ips":
+		var ips []IP
+		for _, item := range batch.items {
+			ips = append(ips, item.(IP))
+		}
+		_, err = c.CreateIPs(ips)
+	case "endpoints":
+		var endpoints []Endpoint
+		for _, item := range batch.items {
+			endpoints = append(endpoints, item.(Endpoint))
+		}
+		_, err = c.CreateEndpoints(endpoints)
+	case "vulns":
+		var vulns []Vuln
+		for _, item := range batch.items {
+			vulns = append(vulns, item.(Vuln))
+		}
+		_, err = c.CreateVulns(vulns)
+	}
+	result.Sent[kind] += len(batch.items)
+
+	// rejects carry the position of the item in the batch, which is how they are matched to the row they came from
+	var rejectedErr *RejectedError
+	if errors.As(err, &rejectedErr) {
+		for _, reject := range rejectedErr.Rejected {
+			row := 0
+			if reject.Index != nil && *reject.Index >= 0 && *reject.Index < len(batch.rows) {
+				row = batch.rows[*reject.Index]
+			}
+			result.Errors = append(result.Errors, GenericError{Row: row, Item: reject.Item, Reason: reject.Reason})
+		}
+	} else if err != nil {
+		for i, row := range batch.rows {
+			result.Errors = append(result.Errors, GenericError{Row: row, Item: batch.keys[i], Reason: err.Error()})
+		}
+	}
+	batch.items = nil
+	batch.keys = nil
+	batch.rows = nil
+}
+
+// genericValues is the mapped fields of one row, or the error reading it
+type genericValues struct {
+	fields map[string]string
+	err    error
+}
+
+// genericRows reads the rows of a generic import one at a time and picks out the mapped values. The channel is closed
+// once the input has been read.
+func genericRows(reader io.Reader, format string, mapping map[string]string) (<-chan genericValues, error) {
+	rows := make(chan genericValues)
+	switch format {
+	case "ndjson", "jsonl", "json":
+		go func() {
+			defer close(rows)
+			scanner := bufio.NewScanner(reader)
+			scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+			for scanner.Scan() {
+				line := strings.TrimSpace(scanner.Text())
+				if line == "" {
+					continue
+				}
+				var object interface{}
+				err := json.Unmarshal([]byte(line), &object)
+				if err != nil {
+					rows <- genericValues{err: fmt.Errorf("invalid JSON: %v", err)}
+					continue
+				}
+				fields := make(map[string]string)
+				for path, field := range mapping {
+					if value, ok := jsonPath(object, path); ok {
+						fields[field] = value
+					}
+				}
+				rows <- genericValues{fields: fields}
+			}
+			if err := scanner.Err(); err != nil {
+				rows <- genericValues{err: err}
+			}
+		}()
+	case "csv":
+		csvReader := csv.NewReader(reader)
+		csvReader.FieldsPerRecord = -1
+		header, err := csvReader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("could not read the CSV header: %v", err)
+		}
+		columns := make(map[string]int)
+		for i, name := range header {
+			columns[strings.TrimSpace(name)] = i
+		}
+		for column := range mapping {
+			if _, ok := columns[column]; !ok {
+				return nil, fmt.Errorf("the CSV has no %q column", column)
+			}
+		}
+		go func() {
+			defer close(rows)
+			for {
+				record, err := csvReader.Read()
+				if err == io.EOF {
+					return
+				}
+				if err != nil {
+					rows <- genericValues{err: err}
+					var parseErr *csv.ParseError
+					if errors.As(err, &parseErr) {
+						continue
+					}
+					return
+				}
+				fields := make(map[string]string)
+				for column, field := range mapping {
+					if i := columns[column]; i < len(record) {
+						fields[field] = record[i]
+					}
+				}
+				rows <- genericValues{fields: fields}
+			}
+		}()
+	default:
+		return nil, fmt.Errorf("unknown format %q, use csv or ndjson", format)
+	}
+	return rows, nil
+}
+
+// finishGenericImport prints what a generic import sent and the errors by row, or the result as JSON, and exits
+// with an error status if any row failed
+func finishGenericImport(outputFormat string, result GenericResult) {
+	if outputFormat == "json" {
+		resultJSON, err := json.Marshal(result)
+		if err != nil {
+			fmt.Println("Error occured while converting the response to JSON: ", err)
+		}
+		fmt.Println(string(resultJSON))
+	} else {
+		printGenericResult(result)
+	}
+	if len(result.Errors) > 0 {
+		os.Exit(1)
+	}
+}
+
+// printGenericResult prints what a generic import sent and the errors by row
+func printGenericResult(result GenericResult) {
+	var kinds []string
+	for kind := range result.Sent {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, genericErr := range result.Errors {
+		if genericErr.Row == 0 {
+			fmt.Println("Rejected", genericErr.Item+":", genericErr.Reason)
+			continue
+		}
+		if genericErr.Item != "" {
+			fmt.Printf("Row %d: %s: %s\n", genericErr.Row, genericErr.Item, genericErr.Reason)
+		} else {
+			fmt.Printf("Row %d: %s\n", genericErr.Row, genericErr.Reason)
+		}
+	}
+	fmt.Println("Rows read:", result.Rows)
+	for _, kind := range kinds {
+		fmt.Printf("%s: %d sent\n", kind, result.Sent[kind])
+	}
+	if len(result.Errors) > 0 {
+		fmt.Println("Errors:", len(result.Errors))
+	}
+}
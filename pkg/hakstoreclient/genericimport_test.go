@@ -0,0 +1,129 @@
+package hakstoreclient
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseGenericMapping(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:   "equals and colons",
+			values: []string{"host=subdomain.id", "info.severity:Vuln.Severity"},
+			want:   map[string]string{"host": "subdomain.id", "info.severity": "vuln.severity"},
+		},
+		{
+			name:   "several in one value",
+			values: []string{"host=subdomain.id, ip = ip.id"},
+			want:   map[string]string{"host": "subdomain.id", "ip": "ip.id"},
+		},
+		{
+			name:    "no field",
+			values:  []string{"host"},
+			wantErr: true,
+		},
+		{
+			name:    "empty source",
+			values:  []string{"=subdomain.id"},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseGenericMapping(test.values)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseGenericMapping() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParseGenericMapping() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestJSONPath(t *testing.T) {
+	var object interface{}
+	err := json.Unmarshal([]byte(`{"host": "www.example.com", "info": {"severity": "high", "tags": ["cve", "rce"], "score": 9.8, "verified": true, "extra": null}, "addresses": [{"ip": "192.0.2.1"}]}`), &object)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path   string
+		want   string
+		wantOK bool
+	}{
+		{path: "host", want: "www.example.com", wantOK: true},
+		{path: "info.severity", want: "high", wantOK: true},
+		{path: "info.tags", want: "cve,rce", wantOK: true},
+		{path: "info.score", want: "9.8", wantOK: true},
+		{path: "info.verified", want: "true", wantOK: true},
+		{path: "addresses.0.ip", want: "192.0.2.1", wantOK: true},
+		{path: "info", want: `{"extra":null,"score":9.8,"severity":"high","tags":["cve","rce"],"verified":true}`, wantOK: true},
+		{path: "info.extra"},
+		{path: "addresses.1.ip"},
+		{path: "addresses.first"},
+		{path: "host.name"},
+		{path: "missing"},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			got, ok := jsonPath(object, test.path)
+			if got != test.want || ok != test.wantOK {
+				t.Errorf("jsonPath(%q) = %q, %v, want %q, %v", test.path, got, ok, test.want, test.wantOK)
+			}
+		})
+	}
+}
+
+// TestImportGenericRejects checks that rejects are reported against the row of the item at their index, even when
+// several rows send items the server names the same way
+func TestImportGenericRejects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/vulns":
+			index := 1
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"items":    []Vuln{},
+				"rejected": []Reject{{Index: &index, Item: "XSS", Reason: "no host"}},
+			})
+		default:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	base, _ := url.Parse(server.URL)
+	c := Client{BaseURL: base, HTTPClient: server.Client()}
+
+	input := "title,host\nXSS,a.example.com\nXSS,b.example.com\n"
+	mapping := GenericMapping{Fields: map[string]string{"title": "vuln.title", "host": "subdomain.id"}}
+	result, err := c.ImportGeneric(strings.NewReader(input), "csv", mapping, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var vulnRows []int
+	subdomainRows := make(map[int]bool)
+	for _, genericErr := range result.Errors {
+		if genericErr.Item == "XSS" {
+			vulnRows = append(vulnRows, genericErr.Row)
+		} else {
+			subdomainRows[genericErr.Row] = true
+		}
+	}
+	if !reflect.DeepEqual(vulnRows, []int{2}) {
+		t.Errorf("vuln rejected at rows %v, want [2]", vulnRows)
+	}
+	if !subdomainRows[1] || !subdomainRows[2] {
+		t.Errorf("failed subdomain batch reported at rows %v, want 1 and 2", subdomainRows)
+	}
+}
@@ -0,0 +1,211 @@
+package hakstoreclient
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// GraphNode is an asset in the relationship graph, its ID is the asset type and ID, e.g. ip:1.2.3.4
+type GraphNode struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Label   string `json:"label"`
+	Program string `json:"program,omitempty"`
+}
+
+// GraphEdge is a relationship between two assets, e.g. a subdomain resolving to an IP
+type GraphEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Type   string `json:"type"`
+}
+
+// Graph is a set of assets and the relationships between them
+type Graph struct {
+	Nodes     []GraphNode `json:"nodes"`
+	Edges     []GraphEdge `json:"edges"`
+	Truncated bool        `json:"truncated"`
+}
+
+// GraphFilter picks where the graph starts and how far it reaches. Either ProgramID or Seed (type:id, e.g.
+// subdomain:www.tesla.com) is needed. A nil Depth or a Limit of 0 uses the server's default, a Depth of 0 is only the
+// start asset.
+type GraphFilter struct {
+	ProgramID string
+	Seed      string
+	Depth     *int
+	Limit     int
+}
+
+// GetGraph will get the graph of assets connected to a program or seed asset
+func (c *Client) GetGraph(filter GraphFilter) (Graph, error) {
+	var graph Graph
+	query := url.Values{}
+	if filter.ProgramID != "" {
+		query.Set("program", filter.ProgramID)
+	}
+	if filter.Seed != "" {
+		query.Set("seed", filter.Seed)
+	}
+	if filter.Depth != nil {
+		query.Set("depth", strconv.Itoa(*filter.Depth))
+	}
+	if filter.Limit > 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+	rel := &url.URL{Path: "/api/graph", RawQuery: query.Encode()}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return graph, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return graph, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return graph, responseError(resp)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&graph)
+	return graph, err
+}
+
+// WriteGraph writes a graph in one of the formats accepted by the graph command: dot (Graphviz), graphml (Gephi,
+// yEd) or json
+func WriteGraph(w io.Writer, graph Graph, format string) error {
+	switch format {
+	case "dot":
+		return writeGraphDOT(w, graph)
+	case "graphml":
+		return writeGraphML(w, graph)
+	case "json":
+		return json.NewEncoder(w).Encode(graph)
+	}
+	return fmt.Errorf("unknown graph format %q, use dot, graphml or json", format)
+}
+
+// graphNodeShapes gives each asset type its own shape in Graphviz
+var graphNodeShapes = map[string]string{
+	"program":    "doubleoctagon",
+	"rootdomain": "box",
+	"subdomain":  "ellipse",
+	"ip":         "diamond",
+	"cname":      "note",
+	"nameserver": "component",
+	"vuln":       "octagon",
+	"cloudasset": "cylinder",
+}
+
+// writeGraphDOT writes a graph in the Graphviz DOT language
+func writeGraphDOT(w io.Writer, graph Graph) error {
+	// strconv.Quote escapes quotes and backslashes the same way DOT does
+	fmt.Fprintln(w, "digraph hakstore {")
+	for _, node := range graph.Nodes {
+		shape := graphNodeShapes[node.Type]
+		if shape == "" {
+			shape = "ellipse"
+		}
+		fmt.Fprintf(w, "  %s [label=%s, shape=%s, type=%s", strconv.Quote(node.ID), strconv.Quote(node.Label), shape, strconv.Quote(node.Type))
+		if node.Program != "" {
+			fmt.Fprintf(w, ", program=%s", strconv.Quote(node.Program))
+		}
+		fmt.Fprintln(w, "];")
+	}
+	for _, edge := range graph.Edges {
+		fmt.Fprintf(w, "  %s -> %s [label=%s];\n", strconv.Quote(edge.Source), strconv.Quote(edge.Target), strconv.Quote(edge.Type))
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+// writeGraphML writes a graph as GraphML, with the asset type, label and program stored as node attributes
+func writeGraphML(w io.Writer, graph Graph) error {
+	escape := func(s string) string {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+	fmt.Fprintln(w, `<?xml version="1.0" encoding="UTF-8"?>`)
+	fmt.Fprintln(w, `<graphml xmlns="http://graphml.graphdrawing.org/xmlns">`)
+	fmt.Fprintln(w, `  <key id="label" for="node" attr.name="label" attr.type="string"/>`)
+	fmt.Fprintln(w, `  <key id="type" for="node" attr.name="type" attr.type="string"/>`)
+	fmt.Fprintln(w, `  <key id="program" for="node" attr.name="program" attr.type="string"/>`)
+	fmt.Fprintln(w, `  <key id="relationship" for="edge" attr.name="relationship" attr.type="string"/>`)
+	fmt.Fprintln(w, `  <graph id="hakstore" edgedefault="directed">`)
+	for _, node := range graph.Nodes {
+		fmt.Fprintf(w, "    <node id=\"%s\">\n", escape(node.ID))
+		fmt.Fprintf(w, "      <data key=\"label\">%s</data>\n", escape(node.Label))
+		fmt.Fprintf(w, "      <data key=\"type\">%s</data>\n", escape(node.Type))
+		if node.Program != "" {
+			fmt.Fprintf(w, "      <data key=\"program\">%s</data>\n", escape(node.Program))
+		}
+		fmt.Fprintln(w, "    </node>")
+	}
+	for i, edge := range graph.Edges {
+		fmt.Fprintf(w, "    <edge id=\"e%d\" source=\"%s\" target=\"%s\">\n", i, escape(edge.Source), escape(edge.Target))
+		fmt.Fprintf(w, "      <data key=\"relationship\">%s</data>\n", escape(edge.Type))
+		fmt.Fprintln(w, "    </edge>")
+	}
+	fmt.Fprintln(w, "  </graph>")
+	_, err := fmt.Fprintln(w, "</graphml>")
+	return err
+}
+
+// GraphCLI handles the graph command
+func GraphCLI(c Client) {
+	graphFlagSet := flag.NewFlagSet("graph", flag.ExitOnError)
+	programID := graphFlagSet.String("program", "", "program to graph")
+	seed := graphFlagSet.String("seed", "", "asset to start the graph from instead of a program, as type:id, e.g. ip:1.2.3.4 or subdomain:www.tesla.com")
+	depth := graphFlagSet.Int("depth", 0, "how many relationships to follow from the start, up to 5 (default 2)")
+	limit := graphFlagSet.Int("limit", 0, "stop adding assets to the graph after this many (default 1000)")
+	format := graphFlagSet.String("format", "dot", "output format: dot, graphml or json")
+	outputFile := graphFlagSet.String("o", "", "file to write the graph to, defaults to stdout")
+	graphFlagSet.Parse(os.Args[2:])
+	if *programID == "" && *seed == "" {
+		fmt.Println("You need to specify a -program or -seed to graph.")
+		return
+	}
+	if *format != "dot" && *format != "graphml" && *format != "json" {
+		fmt.Println("Unknown -format, use dot, graphml or json.")
+		return
+	}
+
+	filter := GraphFilter{ProgramID: *programID, Seed: *seed, Limit: *limit}
+	if isFlagPassed("depth", graphFlagSet) {
+		filter.Depth = depth
+	}
+	graph, err := c.GetGraph(filter)
+	if err != nil {
+		fmt.Println("Error retreiving graph: ", err)
+		return
+	}
+	if graph.Truncated {
+		fmt.Fprintln(os.Stderr, "The graph hit the node limit and is incomplete, use -limit to raise it.")
+	}
+
+	output := os.Stdout
+	if *outputFile != "" {
+		output, err = os.Create(*outputFile)
+		if err != nil {
+			fmt.Println("Error creating output file: ", err)
+			return
+		}
+		defer output.Close()
+	}
+	err = WriteGraph(output, graph, *format)
+	if err != nil {
+		fmt.Println("Error writing graph: ", err)
+	}
+}
@@ -1,7 +1,34 @@
 package hakstoreclient
 
+import (
+	"fmt"
+	"strings"
+)
+
 // Message is a structure to use for success/error json response messages
 type Message struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
 }
+
+// Reject describes an item from a batch request that the server refused to store, and why
+// Index is the item's position in the batch that was sent, it is nil for servers that don't report it.
+type Reject struct {
+	Index  *int   `json:"index,omitempty"`
+	Item   string `json:"item"`
+	Reason string `json:"reason"`
+}
+
+// RejectedError is returned by batch methods when the server refused to store some of the items. The items that were
+// stored are still returned alongside it.
+type RejectedError struct {
+	Rejected []Reject
+}
+
+func (e *RejectedError) Error() string {
+	var reasons []string
+	for _, reject := range e.Rejected {
+		reasons = append(reasons, reject.Reason)
+	}
+	return fmt.Sprintf("%d item(s) rejected: %s", len(e.Rejected), strings.Join(reasons, "; "))
+}
@@ -0,0 +1,380 @@
+package hakstoreclient
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ImportCount is how many items of one kind an import created, updated and skipped
+type ImportCount struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Skipped int `json:"skipped"`
+}
+
+// ImportSummary is what the server did with an imported file. Counts are keyed by the kind of item, e.g. subdomains.
+// Skipped items were valid but not stored, e.g. because they were out of scope, rejected items were invalid.
+// Scope imports also list the changes to each program's scope.
+type ImportSummary struct {
+	Counts   map[string]*ImportCount `json:"counts"`
+	Skipped  []Reject                `json:"skipped"`
+	Rejected []Reject                `json:"rejected"`
+	Changes  []ScopeChange           `json:"changes"`
+	DryRun   bool                    `json:"dryrun"`
+}
+
+// ImportOptions changes how the server imports a file
+type ImportOptions struct {
+	// ProgramID limits the import to assets in this program's scope, for scope imports it is the program the scope
+	// belongs to
+	ProgramID string
+	// Quiet turns off the Slack notifications for new vulns, e.g. when backfilling old scans
+	Quiet bool
+	// DryRun has the server report what it would store without storing anything, only the port scan and scope
+	// imports support it
+	DryRun bool
+	// Platform names the platform a scope export came from, e.g. hackerone
+	Platform string
+	// Prune has a scope import delete the targets the platform no longer lists
+	Prune bool
+	// Origin is the origin of a zone file that has no $ORIGIN or SOA record, e.g. tesla.com
+	Origin string
+	// Source tags what a zone import stores with where the zone came from, e.g. axfr:ns1.tesla.com
+	Source string
+}
+
+// Import sends the output of a tool to the server's importer for it, e.g. amass. The body is streamed as is, so
+// large files aren't read into memory.
+func (c *Client) Import(tool string, body io.Reader, options ImportOptions) (ImportSummary, error) {
+	var summary ImportSummary
+	query := url.Values{}
+	if options.ProgramID != "" {
+		query.Set("program", options.ProgramID)
+	}
+	if options.Quiet {
+		query.Set("notify", "false")
+	}
+	if options.DryRun {
+		query.Set("dryrun", "true")
+	}
+	if options.Platform != "" {
+		query.Set("platform", options.Platform)
+	}
+	if options.Prune {
+		query.Set("prune", "true")
+	}
+	if options.Origin != "" {
+		query.Set("origin", options.Origin)
+	}
+	if options.Source != "" {
+		query.Set("source", options.Source)
+	}
+	rel := &url.URL{Path: "/api/import/" + tool, RawQuery: query.Encode()}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("POST", u.String(), body)
+	if err != nil {
+		return summary, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return summary, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return summary, responseError(resp)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&summary)
+	return summary, err
+}
+
+// finishImport prints what an import did, or the summary as JSON, and exits with an error status if the server
+// rejected anything so scripts can tell
+func finishImport(outputFormat string, summary ImportSummary) {
+	if outputFormat == "json" {
+		summaryJSON, err := json.Marshal(summary)
+		if err != nil {
+			fmt.Println("Error occured while converting the response to JSON: ", err)
+		}
+		fmt.Println(string(summaryJSON))
+	} else {
+		printImportSummary(summary)
+	}
+	if len(summary.Rejected) > 0 {
+		os.Exit(1)
+	}
+}
+
+// printImportSummary prints what an import did
+func printImportSummary(summary ImportSummary) {
+	if summary.DryRun {
+		fmt.Println("Dry run, nothing was stored.")
+	}
+	var kinds []string
+	for kind := range summary.Counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		count := summary.Counts[kind]
+		fmt.Printf("%s: %d created, %d updated, %d skipped\n", kind, count.Created, count.Updated, count.Skipped)
+	}
+	for _, skipped := range summary.Skipped {
+		fmt.Println("Skipped", skipped.Item+":", skipped.Reason)
+	}
+	for _, rejected := range summary.Rejected {
+		fmt.Println("Rejected", rejected.Item+":", rejected.Reason)
+	}
+	for _, change := range summary.Changes {
+		scope := "in scope"
+		if !change.InScope {
+			scope = "out of scope"
+		}
+		fmt.Printf("Scope of %s %s: %s (%s, %s)\n", change.Program, change.Change, change.Target, change.Type, scope)
+	}
+}
+
+// openImportFile opens the file to import, or stdin if the filename is -
+func openImportFile(filename string) (*os.File, error) {
+	if filename == "-" {
+		return os.Stdin, nil
+	}
+	return os.Open(filename)
+}
+
+// ImportCLI handles the import command, which loads the output of other tools
+func ImportCLI(c Client) {
+	if len(os.Args) < 3 {
+		fmt.Println("Invalid arguments. Hint: ./hakstore-client import {amass|nuclei|burp|nmap|masscan|scope|zone|ctlog|generic}")
+		return
+	}
+	switch os.Args[2] {
+	case "amass":
+		importFlagSet := flag.NewFlagSet("import amass", flag.ExitOnError)
+		filename := importFlagSet.String("file", "", "amass JSON output to import, as written by amass enum -json, or - for stdin")
+		programID := importFlagSet.String("program", "", "only import names in this program's scope")
+		outputFormat := importFlagSet.String("output", "", "output format")
+		importFlagSet.Parse(os.Args[3:])
+		if *filename == "" {
+			fmt.Println("Usage: hakstore-client import amass -file <./amass.json> [-program tesla]")
+			return
+		}
+		file, err := openImportFile(*filename)
+		if err != nil {
+			fmt.Println("Error opening file to import: ", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		summary, err := c.Import("amass", file, ImportOptions{ProgramID: *programID})
+		if err != nil {
+			fmt.Println("An error occured while importing: ", err)
+			os.Exit(1)
+		}
+		finishImport(*outputFormat, summary)
+
+	case "nuclei":
+		importFlagSet := flag.NewFlagSet("import nuclei", flag.ExitOnError)
+		filename := importFlagSet.String("file", "", "nuclei JSONL output to import, as written by nuclei -jsonl, or - for stdin")
+		programID := importFlagSet.String("program", "", "only import findings on hosts in this program's scope")
+		quiet := importFlagSet.Bool("quiet", false, "don't send Slack notifications for new vulns, for backfilling old scans")
+		outputFormat := importFlagSet.String("output", "", "output format")
+		importFlagSet.Parse(os.Args[3:])
+		if *filename == "" {
+			fmt.Println("Usage: hakstore-client import nuclei -file <./nuclei.jsonl> [-program tesla] [-quiet]")
+			return
+		}
+		file, err := openImportFile(*filename)
+		if err != nil {
+			fmt.Println("Error opening file to import: ", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		summary, err := c.Import("nuclei", file, ImportOptions{ProgramID: *programID, Quiet: *quiet})
+		if err != nil {
+			fmt.Println("An error occured while importing: ", err)
+			os.Exit(1)
+		}
+		finishImport(*outputFormat, summary)
+
+	case "burp":
+		importFlagSet := flag.NewFlagSet("import burp", flag.ExitOnError)
+		filename := importFlagSet.String("file", "", "Burp issues or sitemap XML export to import, or - for stdin")
+		programID := importFlagSet.String("program", "", "only import issues and requests on hosts in this program's scope")
+		quiet := importFlagSet.Bool("quiet", false, "don't send Slack notifications for new vulns")
+		outputFormat := importFlagSet.String("output", "", "output format")
+		importFlagSet.Parse(os.Args[3:])
+		if *filename == "" {
+			fmt.Println("Usage: hakstore-client import burp -file <./issues.xml|./sitemap.xml> [-program tesla] [-quiet]")
+			return
+		}
+		file, err := openImportFile(*filename)
+		if err != nil {
+			fmt.Println("Error opening file to import: ", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		summary, err := c.Import("burp", file, ImportOptions{ProgramID: *programID, Quiet: *quiet})
+		if err != nil {
+			fmt.Println("An error occured while importing: ", err)
+			os.Exit(1)
+		}
+		finishImport(*outputFormat, summary)
+
+	case "nmap", "masscan":
+		tool := os.Args[2]
+		importFlagSet := flag.NewFlagSet("import "+tool, flag.ExitOnError)
+		filename := importFlagSet.String("file", "", tool+" output to import, XML/JSON or grepable, or - for stdin")
+		programID := importFlagSet.String("program", "", "add every scanned IP to this program, leave out to let the program IP ranges decide")
+		dryRun := importFlagSet.Bool("dryrun", false, "show what would be stored without storing it")
+		outputFormat := importFlagSet.String("output", "", "output format")
+		importFlagSet.Parse(os.Args[3:])
+		if *filename == "" {
+			fmt.Println("Usage: hakstore-client import " + tool + " -file <./scan> [-program tesla] [-dryrun]")
+			return
+		}
+		file, err := openImportFile(*filename)
+		if err != nil {
+			fmt.Println("Error opening file to import: ", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		summary, err := c.Import(tool, file, ImportOptions{ProgramID: *programID, DryRun: *dryRun})
+		if err != nil {
+			fmt.Println("An error occured while importing: ", err)
+			os.Exit(1)
+		}
+		finishImport(*outputFormat, summary)
+
+	case "scope":
+		importFlagSet := flag.NewFlagSet("import scope", flag.ExitOnError)
+		filename := importFlagSet.String("file", "", "scope export to import (HackerOne, Bugcrowd or Intigriti CSV/JSON, or a bounty-targets-data file), or - for stdin")
+		platformID := importFlagSet.String("platform", "", "platform the scope is from, e.g. hackerone, worked out from the program URLs if left out")
+		programID := importFlagSet.String("program", "", "program the scope belongs to, needed for exports of a single program's scope")
+		prune := importFlagSet.Bool("prune", false, "delete scope targets the platform no longer lists")
+		dryRun := importFlagSet.Bool("dryrun", false, "show what would change without storing it")
+		outputFormat := importFlagSet.String("output", "", "output format")
+		importFlagSet.Parse(os.Args[3:])
+		if *filename == "" {
+			fmt.Println("Usage: hakstore-client import scope -file <./scope.csv> [-platform hackerone] [-program tesla] [-prune] [-dryrun]")
+			return
+		}
+		file, err := openImportFile(*filename)
+		if err != nil {
+			fmt.Println("Error opening file to import: ", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		summary, err := c.Import("scope", file, ImportOptions{ProgramID: *programID, Platform: *platformID, Prune: *prune, DryRun: *dryRun})
+		if err != nil {
+			fmt.Println("An error occured while importing: ", err)
+			os.Exit(1)
+		}
+		finishImport(*outputFormat, summary)
+
+	case "zone":
+		importFlagSet := flag.NewFlagSet("import zone", flag.ExitOnError)
+		filename := importFlagSet.String("file", "", "zone file or dig axfr output to import, or - for stdin")
+		origin := importFlagSet.String("origin", "", "origin of the zone, if the file has no $ORIGIN or SOA record")
+		source := importFlagSet.String("source", "", "where the zone came from, e.g. axfr:ns1.tesla.com (zone by default)")
+		programID := importFlagSet.String("program", "", "only import names in this program's scope")
+		outputFormat := importFlagSet.String("output", "", "output format")
+		importFlagSet.Parse(os.Args[3:])
+		if *filename == "" {
+			fmt.Println("Usage: hakstore-client import zone -file <./tesla.com.zone> [-origin tesla.com] [-source axfr:ns1.tesla.com] [-program tesla]")
+			return
+		}
+		file, err := openImportFile(*filename)
+		if err != nil {
+			fmt.Println("Error opening file to import: ", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		summary, err := c.Import("zone", file, ImportOptions{ProgramID: *programID, Origin: *origin, Source: *source})
+		if err != nil {
+			fmt.Println("An error occured while importing: ", err)
+			os.Exit(1)
+		}
+		finishImport(*outputFormat, summary)
+
+	case "ctlog":
+		importFlagSet := flag.NewFlagSet("import ctlog", flag.ExitOnError)
+		filename := importFlagSet.String("file", "", "crt.sh JSON output or certstream capture to import, or - for stdin")
+		programID := importFlagSet.String("program", "", "only import names in this program's scope")
+		outputFormat := importFlagSet.String("output", "", "output format")
+		importFlagSet.Parse(os.Args[3:])
+		if *filename == "" {
+			fmt.Println("Usage: hakstore-client import ctlog -file <./crtsh.json> [-program tesla]")
+			return
+		}
+		file, err := openImportFile(*filename)
+		if err != nil {
+			fmt.Println("Error opening file to import: ", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		summary, err := c.Import("ctlog", file, ImportOptions{ProgramID: *programID})
+		if err != nil {
+			fmt.Println("An error occured while importing: ", err)
+			os.Exit(1)
+		}
+		finishImport(*outputFormat, summary)
+
+	case "generic":
+		importFlagSet := flag.NewFlagSet("import generic", flag.ExitOnError)
+		filename := importFlagSet.String("file", "", "NDJSON or CSV file to import, or - for stdin")
+		format := importFlagSet.String("format", "", "csv or ndjson, worked out from the file if left out")
+		var maps, sets stringsFlag
+		importFlagSet.Var(&maps, "map", "column or JSON path to import into a field, e.g. host=subdomain.id, can be repeated")
+		importFlagSet.Var(&sets, "set", "value to put into a field on every row, e.g. vuln.program=tesla, can be repeated")
+		batchSize := importFlagSet.Int("batch", 500, "number of items to send to the server at a time")
+		outputFormat := importFlagSet.String("output", "", "output format")
+		importFlagSet.Parse(os.Args[3:])
+		if *filename == "" || len(maps) == 0 {
+			fmt.Println("Usage: hakstore-client import generic -file <./hosts.csv> -map host=subdomain.id -map ip=ip.id [-set vuln.program=tesla] [-format csv|ndjson]")
+			return
+		}
+		fields, err := ParseGenericMapping(maps)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		constants, err := parseKeyValues("set", sets)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		mapping := GenericMapping{Fields: fields, Constants: make(map[string]string)}
+		for field, value := range constants {
+			mapping.Constants[strings.ToLower(field)] = value
+		}
+		if *format == "" && strings.HasSuffix(strings.ToLower(*filename), ".csv") {
+			*format = "csv"
+		}
+		file, err := openImportFile(*filename)
+		if err != nil {
+			fmt.Println("Error opening file to import: ", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		result, err := c.ImportGeneric(file, strings.ToLower(*format), mapping, *batchSize)
+		if err != nil {
+			fmt.Println("An error occured while importing: ", err)
+			os.Exit(1)
+		}
+		finishGenericImport(*outputFormat, result)
+
+	// no valid subcommand found - default to showing a message and exiting
+	default:
+		fmt.Println("Invalid subsubcommand, ./hakstore-client import {amass|nuclei|burp|nmap|masscan|scope|zone|ctlog|generic}")
+		os.Exit(1)
+	}
+}
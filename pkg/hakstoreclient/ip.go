@@ -9,16 +9,208 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
 
-// IP is a structure to store details about ip addresses
+// IP is a structure to store details about ip addresses. An IP can belong to several programs, which the server works
+// out from the subdomains resolving to it and the programs' IP ranges.
 type IP struct {
 	gorm.Model
 	ID         string       `json:"id" gorm:"PrimaryKey"`
+	Version    int          `json:"version"`
 	Subdomains []*Subdomain `json:"subdomains" gorm:"many2many:subdomain_ips;"`
-	ProgramID  string       `json:"program"`
+	Programs   []*Program   `json:"programs"`
+	ASN        int          `json:"asn"`
+	ASNName    string       `json:"asnname"`
+	Ports      []Port       `json:"ports,omitempty"`
+	// ProgramID is only used when creating IPs, the server adds the address to that program as a single address range
+	ProgramID string `json:"program,omitempty"`
+}
+
+// IPRange is a CIDR range belonging to a program, every IP inside it is associated with the program
+type IPRange struct {
+	gorm.Model
+	ID          int    `json:"id"`
+	CIDR        string `json:"cidr"`
+	ProgramID   string `json:"program"`
+	Description string `json:"description"`
+}
+
+// Port is an open port found on an IP by a port scanner
+type Port struct {
+	gorm.Model
+	ID        int       `json:"id"`
+	IPID      string    `json:"ip"`
+	Port      int       `json:"port"`
+	Protocol  string    `json:"protocol"`
+	Service   string    `json:"service"`
+	Product   string    `json:"product"`
+	Version   string    `json:"version"`
+	Banner    string    `json:"banner"`
+	FirstSeen time.Time `json:"firstseen"`
+	LastSeen  time.Time `json:"lastseen"`
+}
+
+// PortFilter narrows down the ports returned by GetPorts, empty fields don't filter anything
+type PortFilter struct {
+	IP        string
+	Port      int
+	Service   string
+	ProgramID string
+}
+
+// GetPorts will get the open ports that match the filter
+func (c *Client) GetPorts(filter PortFilter) ([]Port, error) {
+	query := url.Values{}
+	if filter.IP != "" {
+		query.Set("ip", filter.IP)
+	}
+	if filter.Port != 0 {
+		query.Set("port", strconv.Itoa(filter.Port))
+	}
+	if filter.Service != "" {
+		query.Set("service", filter.Service)
+	}
+	if filter.ProgramID != "" {
+		query.Set("program", filter.ProgramID)
+	}
+	rel := &url.URL{Path: "/api/ports", RawQuery: query.Encode()}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var ports []Port
+	err = json.NewDecoder(resp.Body).Decode(&ports)
+	return ports, err
+}
+
+// printPort prints an open port with whatever is known about its service
+func printPort(port Port) {
+	details := strings.TrimSpace(strings.Join([]string{port.Service, port.Product, port.Version}, " "))
+	if port.Banner != "" {
+		details = strings.TrimSpace(details + " " + strconv.Quote(port.Banner))
+	}
+	fmt.Printf("%s %d/%s %s\n", port.IPID, port.Port, port.Protocol, details)
+}
+
+// GetIPSubdomains will get the subdomains that resolve to an IP, across every program
+func (c *Client) GetIPSubdomains(id string) ([]Subdomain, error) {
+	rel := &url.URL{Path: "/api/ips/" + id + "/subdomains"}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var subdomains []Subdomain
+	err = json.NewDecoder(resp.Body).Decode(&subdomains)
+	return subdomains, err
+}
+
+// GetIPRanges will get the IP ranges of a program, or every program if it is empty. If ip isn't empty only the
+// ranges containing it are returned.
+func (c *Client) GetIPRanges(programID string, ip string) ([]IPRange, error) {
+	query := url.Values{}
+	if programID != "" {
+		query.Set("program", programID)
+	}
+	if ip != "" {
+		query.Set("ip", ip)
+	}
+	rel := &url.URL{Path: "/api/ipranges", RawQuery: query.Encode()}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+	var ranges []IPRange
+	err = json.NewDecoder(resp.Body).Decode(&ranges)
+	return ranges, err
+}
+
+// CreateIPRanges will create new IP ranges. If the server rejects any of them, the stored ranges are returned along
+// with a *RejectedError describing the rest.
+func (c *Client) CreateIPRanges(ranges []IPRange) ([]IPRange, error) {
+	jsonranges, err := json.Marshal(ranges)
+	if err != nil {
+		return nil, err
+	}
+	rel := &url.URL{Path: "/api/ipranges", RawQuery: "verbose=true"}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("POST", u.String(), bytes.NewBuffer(jsonranges))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var response struct {
+		Items    []IPRange `json:"items"`
+		Rejected []Reject  `json:"rejected"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Rejected) > 0 {
+		return response.Items, &RejectedError{Rejected: response.Rejected}
+	}
+	return response.Items, nil
+}
+
+// DeleteIPRange will delete an IP range
+func (c *Client) DeleteIPRange(id string) (bool, error) {
+	rel := &url.URL{Path: "/api/ipranges/" + id}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("DELETE", u.String(), nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	return true, err
 }
 
 // GetIPs will get all ips from database
@@ -42,6 +234,30 @@ func (c *Client) GetIPs() ([]IP, error) {
 	return ips, err
 }
 
+// GetIPsInRange will get all ips inside a CIDR range, e.g. 10.0.0.0/8 or 2001:db8::/32
+func (c *Client) GetIPsInRange(cidr string) ([]IP, error) {
+	rel := &url.URL{Path: "/api/ips", RawQuery: url.Values{"cidr": {cidr}}.Encode()}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+	var ips []IP
+	err = json.NewDecoder(resp.Body).Decode(&ips)
+	return ips, err
+}
+
 // GetIP will get a ip
 func (c *Client) GetIP(id string) (IP, error) {
 	var emptyip IP
@@ -64,7 +280,8 @@ func (c *Client) GetIP(id string) (IP, error) {
 	return ip, err
 }
 
-// CreateIPs will create new IPs
+// CreateIPs will create new IPs. If the server rejects any of them, the stored IPs are returned along with a
+// *RejectedError describing the rest.
 func (c *Client) CreateIPs(ips []IP) ([]IP, error) {
 	var emptyip []IP
 
@@ -72,7 +289,7 @@ func (c *Client) CreateIPs(ips []IP) ([]IP, error) {
 	if err != nil {
 		log.Println("Could not convert ip to JSON, is it in the correct format?")
 	}
-	rel := &url.URL{Path: "/api/ips"}
+	rel := &url.URL{Path: "/api/ips", RawQuery: "verbose=true"}
 	u := c.BaseURL.ResolveReference(rel)
 	req, err := http.NewRequest("POST", u.String(), bytes.NewBuffer(jsonips))
 	if err != nil {
@@ -86,8 +303,46 @@ func (c *Client) CreateIPs(ips []IP) ([]IP, error) {
 		return emptyip, err
 	}
 	defer resp.Body.Close()
-	err = json.NewDecoder(resp.Body).Decode(&ips)
-	return ips, err
+	if resp.StatusCode != http.StatusOK {
+		return emptyip, responseError(resp)
+	}
+	var response struct {
+		Items    []IP     `json:"items"`
+		Rejected []Reject `json:"rejected"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return emptyip, err
+	}
+	if len(response.Rejected) > 0 {
+		return response.Items, &RejectedError{Rejected: response.Rejected}
+	}
+	return response.Items, nil
+}
+
+// ImportIPsFromFile reads one IP per line from a file, or stdin if the filename is -, and stores them in batches. If
+// programID isn't empty every IP is added to that program.
+func ImportIPsFromFile(filename string, programID string, options StreamOptions, c Client) (StreamSummary, error) {
+	file, err := openImportFile(filename)
+	if err != nil {
+		return StreamSummary{}, err
+	}
+	defer file.Close()
+
+	read := func(emit func(item interface{}, line int), reject func(Reject)) error {
+		return readLines(file, func(line string, number int) {
+			emit(IP{ID: line, ProgramID: programID}, number)
+		})
+	}
+	send := func(batch []interface{}) error {
+		ips := make([]IP, len(batch))
+		for i, item := range batch {
+			ips[i] = item.(IP)
+		}
+		_, err := c.CreateIPs(ips)
+		return err
+	}
+	return streamImport(options, read, send), nil
 }
 
 // UpdateIP will update the specified ip
@@ -174,13 +429,24 @@ func printIP(ipID string, outputFormat string, c Client) {
 
 	} else {
 		fmt.Println(ip.ID)
+		var programs []string
+		for _, program := range ip.Programs {
+			programs = append(programs, program.ID)
+		}
+		fmt.Println("Programs:", strings.Join(programs, ", "))
+		if ip.ASN != 0 {
+			fmt.Println("ASN:", ip.ASN, ip.ASNName)
+		}
+		for _, port := range ip.Ports {
+			printPort(port)
+		}
 	}
 }
 
 // IPsCLI handles the ips subcommand CLI
 func IPsCLI(c Client) {
 	if len(os.Args) < 3 {
-		fmt.Println("Invalid arguments. Hint: ./hakstore-client ips {list|create|delete}")
+		fmt.Println("Invalid arguments. Hint: ./hakstore-client ips {list|create|delete|subdomains|ports|ranges|addrange|deleterange}")
 		return
 	}
 	switch os.Args[2] {
@@ -189,6 +455,7 @@ func IPsCLI(c Client) {
 		ipID := ipsFlagSet.String("id", "", "ID of ip")
 		outputFormat := ipsFlagSet.String("output", "", "output format")
 		programID := ipsFlagSet.String("program", "", "ID of program")
+		cidr := ipsFlagSet.String("cidr", "", "only list ips inside this CIDR range, e.g. 10.0.0.0/8")
 		ipsFlagSet.Parse(os.Args[3:])
 		if isFlagPassed("id", ipsFlagSet) {
 			// show single ip
@@ -196,6 +463,12 @@ func IPsCLI(c Client) {
 
 		} else if isFlagPassed("program", ipsFlagSet) {
 			PrintAssociatedIPs(*programID, *outputFormat, c)
+		} else if isFlagPassed("cidr", ipsFlagSet) {
+			ips, err := c.GetIPsInRange(*cidr)
+			if err != nil {
+				fmt.Println("Error retreiving ips: ", err)
+			}
+			printIPs(*outputFormat, ips)
 		} else {
 			// list ips
 			ips, err := c.GetIPs()
@@ -206,12 +479,24 @@ func IPsCLI(c Client) {
 		}
 	case "create":
 		ipsFlagSet := flag.NewFlagSet("ips create", flag.ExitOnError)
-		ipID := ipsFlagSet.String("id", "", "ID of ip, e.g. api.example.com")
-		programID := ipsFlagSet.String("program", "", "Program that the ip will be associated with, e.g. tesla")
+		ipID := ipsFlagSet.String("id", "", "ID of ip, e.g. 192.0.2.1 or 2001:db8::1")
+		programID := ipsFlagSet.String("program", "", "Program that the ip will be associated with, e.g. tesla. Leave out to let the ip's subdomains and ranges decide.")
+		file := ipsFlagSet.String("file", "", "File holding one ip per line to create instead of -id, or - for stdin")
+		outputFormat := ipsFlagSet.String("output", "", "output format")
+		stream := addStreamFlags(ipsFlagSet)
 		ipsFlagSet.Parse(os.Args[3:])
+		if filename := importFilename(*file, ipsFlagSet); filename != "" && *ipID == "" {
+			summary, err := ImportIPsFromFile(filename, *programID, stream.options(), c)
+			if err != nil {
+				fmt.Println("Error opening file: ", err)
+				os.Exit(1)
+			}
+			finishStreamImport(*outputFormat, summary)
+			return
+		}
 		// create/update ip
-		if *ipID == "" || *programID == "" {
-			fmt.Println("You need to specify a -id and a -program to create the ip.")
+		if *ipID == "" {
+			fmt.Println("You need to specify a -id to create the ip, or a -file of ips.")
 			return
 		}
 		ips := []IP{{ID: *ipID, ProgramID: *programID}}
@@ -230,9 +515,108 @@ func IPsCLI(c Client) {
 		}
 		c.DeleteIP(*ipID)
 
+	case "subdomains":
+		ipsFlagSet := flag.NewFlagSet("ips subdomains", flag.ExitOnError)
+		ipID := ipsFlagSet.String("id", "", "ID of ip")
+		outputFormat := ipsFlagSet.String("output", "", "output format")
+		ipsFlagSet.Parse(os.Args[3:])
+		if *ipID == "" {
+			fmt.Println("You need to specify a ip id with -id.")
+			return
+		}
+		subdomains, err := c.GetIPSubdomains(*ipID)
+		if err != nil {
+			fmt.Println("Error retreiving subdomains: ", err)
+			return
+		}
+		if *outputFormat == "json" {
+			subdomainsJSON, err := json.Marshal(subdomains)
+			if err != nil {
+				fmt.Println("Error occured while converting the response to JSON: ", err)
+			}
+			fmt.Println(string(subdomainsJSON))
+			return
+		}
+		for _, subdomain := range subdomains {
+			fmt.Println(subdomain.ID, subdomain.ProgramID)
+		}
+
+	case "ports":
+		ipsFlagSet := flag.NewFlagSet("ips ports", flag.ExitOnError)
+		ipID := ipsFlagSet.String("id", "", "only list ports on this ip")
+		port := ipsFlagSet.Int("port", 0, "only list this port number")
+		service := ipsFlagSet.String("service", "", "only list ports running this service, e.g. ssh")
+		programID := ipsFlagSet.String("program", "", "only list ports on ips in this program")
+		outputFormat := ipsFlagSet.String("output", "", "output format")
+		ipsFlagSet.Parse(os.Args[3:])
+		ports, err := c.GetPorts(PortFilter{IP: *ipID, Port: *port, Service: *service, ProgramID: *programID})
+		if err != nil {
+			fmt.Println("Error retreiving ports: ", err)
+			return
+		}
+		if *outputFormat == "json" {
+			portsJSON, err := json.Marshal(ports)
+			if err != nil {
+				fmt.Println("Error occured while converting the response to JSON: ", err)
+			}
+			fmt.Println(string(portsJSON))
+			return
+		}
+		for _, port := range ports {
+			printPort(port)
+		}
+
+	case "ranges":
+		ipsFlagSet := flag.NewFlagSet("ips ranges", flag.ExitOnError)
+		programID := ipsFlagSet.String("program", "", "only list ranges of this program")
+		ipID := ipsFlagSet.String("ip", "", "only list ranges containing this ip")
+		outputFormat := ipsFlagSet.String("output", "", "output format")
+		ipsFlagSet.Parse(os.Args[3:])
+		ranges, err := c.GetIPRanges(*programID, *ipID)
+		if err != nil {
+			fmt.Println("Error retreiving ip ranges: ", err)
+			return
+		}
+		if *outputFormat == "json" {
+			rangesJSON, err := json.Marshal(ranges)
+			if err != nil {
+				fmt.Println("Error occured while converting the response to JSON: ", err)
+			}
+			fmt.Println(string(rangesJSON))
+			return
+		}
+		for _, ipRange := range ranges {
+			fmt.Println(ipRange.ID, ipRange.CIDR, ipRange.ProgramID, ipRange.Description)
+		}
+
+	case "addrange":
+		ipsFlagSet := flag.NewFlagSet("ips addrange", flag.ExitOnError)
+		cidr := ipsFlagSet.String("cidr", "", "CIDR range, e.g. 192.0.2.0/24")
+		programID := ipsFlagSet.String("program", "", "Program the range belongs to, e.g. tesla")
+		description := ipsFlagSet.String("description", "", "Description of the range, e.g. the ASN it came from")
+		ipsFlagSet.Parse(os.Args[3:])
+		if *cidr == "" || *programID == "" {
+			fmt.Println("You need to specify a -cidr and a -program to add the range.")
+			return
+		}
+		_, err := c.CreateIPRanges([]IPRange{{CIDR: *cidr, ProgramID: *programID, Description: *description}})
+		if err != nil {
+			fmt.Println("An error occured while adding the ip range: ", err)
+		}
+
+	case "deleterange":
+		ipsFlagSet := flag.NewFlagSet("ips deleterange", flag.ExitOnError)
+		rangeID := ipsFlagSet.String("id", "", "ID of ip range")
+		ipsFlagSet.Parse(os.Args[3:])
+		if *rangeID == "" {
+			fmt.Println("You need to specify a ip range id to delete with -id.")
+			return
+		}
+		c.DeleteIPRange(*rangeID)
+
 	// no valid subcommand found - default to showing a message and exiting
 	default:
-		fmt.Println("Invalid subsubcommand, ./hakstore-client ips {list|create|delete}")
+		fmt.Println("Invalid subsubcommand, ./hakstore-client ips {list|create|delete|subdomains|ports|ranges|addrange|deleterange}")
 		os.Exit(1)
 	}
 }
@@ -1,11 +1,13 @@
 package hakstoreclient
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
 )
 
 // Client for interacting with hakstore server
@@ -66,3 +68,52 @@ func isFlagPassed(name string, flagset *flag.FlagSet) bool {
 	})
 	return found
 }
+
+// StatusError is an unsuccessful response from the server
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return e.Message
+}
+
+// responseError turns an unsuccessful response from the server into a *StatusError, using the message it sent if
+// there is one
+func responseError(resp *http.Response) error {
+	var message Message
+	err := json.NewDecoder(resp.Body).Decode(&message)
+	if err != nil || message.Message == "" {
+		return &StatusError{StatusCode: resp.StatusCode, Message: "server responded with " + resp.Status}
+	}
+	return &StatusError{StatusCode: resp.StatusCode, Message: message.Message}
+}
+
+// stringsFlag is a cli flag that can be passed more than once, collecting every value
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// parseKeyValues parses a list of key=value flags into a map
+func parseKeyValues(flagName string, values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	pairs := make(map[string]string)
+	for _, value := range values {
+		pair := strings.SplitN(value, "=", 2)
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("invalid -%s %q, it should look like key=value", flagName, value)
+		}
+		pairs[pair[0]] = pair[1]
+	}
+	return pairs, nil
+}
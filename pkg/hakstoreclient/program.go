@@ -5,10 +5,14 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -16,9 +20,51 @@ import (
 // Program is a structure to store details about bug bounty programs
 type Program struct {
 	gorm.Model
-	ID          string       `json:"id" gorm:"PrimaryKey"`
-	PlatformID  string       `json:"platform"`
-	RootDomains []RootDomain `json:"rootdomains"`
+	ID          string            `json:"id" gorm:"PrimaryKey"`
+	PlatformID  string            `json:"platform"`
+	Name        string            `json:"name"`
+	URL         string            `json:"url"`
+	Policy      string            `json:"policy"`
+	Type        string            `json:"type"`
+	State       string            `json:"state"`
+	SafeHarbour bool              `json:"safeharbour"`
+	LaunchDate  *time.Time        `json:"launchdate"`
+	Bounties    []BountyRange     `json:"bounties"`
+	Metadata    map[string]string `json:"metadata"`
+	RootDomains []RootDomain      `json:"rootdomains"`
+}
+
+// BountyRange is what a program pays for a vuln of a certain severity, 1 being critical and 5 informational
+type BountyRange struct {
+	gorm.Model
+	ProgramID string  `json:"program"`
+	Severity  int     `json:"severity"`
+	Min       float64 `json:"min"`
+	Max       float64 `json:"max"`
+	Currency  string  `json:"currency"`
+}
+
+// ProgramUpdate holds the fields of a program to change with UpdateProgram, fields that are nil are left alone.
+// Bounties replace the existing ones, while metadata is merged in and keys with an empty value are removed.
+type ProgramUpdate struct {
+	PlatformID  *string           `json:"platform,omitempty"`
+	Name        *string           `json:"name,omitempty"`
+	URL         *string           `json:"url,omitempty"`
+	Policy      *string           `json:"policy,omitempty"`
+	Type        *string           `json:"type,omitempty"`
+	State       *string           `json:"state,omitempty"`
+	SafeHarbour *bool             `json:"safeharbour,omitempty"`
+	LaunchDate  *time.Time        `json:"launchdate,omitempty"`
+	Bounties    *[]BountyRange    `json:"bounties,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+// ProgramFilter narrows down the programs returned by GetFilteredPrograms, empty fields don't filter anything
+type ProgramFilter struct {
+	PlatformID string
+	Type       string
+	State      string
+	PaidOnly   bool
 }
 
 // GetPrograms will get all programs from database
@@ -42,6 +88,40 @@ func (c *Client) GetPrograms() ([]Program, error) {
 	return programs, err
 }
 
+// GetFilteredPrograms will get the programs that match the filter
+func (c *Client) GetFilteredPrograms(filter ProgramFilter) ([]Program, error) {
+	query := url.Values{}
+	if filter.PlatformID != "" {
+		query.Set("platform", filter.PlatformID)
+	}
+	if filter.Type != "" {
+		query.Set("type", filter.Type)
+	}
+	if filter.State != "" {
+		query.Set("state", filter.State)
+	}
+	if filter.PaidOnly {
+		query.Set("paid", "true")
+	}
+	rel := &url.URL{Path: "/api/programs", RawQuery: query.Encode()}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var programs []Program
+	err = json.NewDecoder(resp.Body).Decode(&programs)
+	return programs, err
+}
+
 // GetProgram will get a program
 func (c *Client) GetProgram(id string) (Program, error) {
 	var emptyprogram Program
@@ -85,20 +165,23 @@ func (c *Client) CreateProgram(program Program) (Program, error) {
 		return emptyprogram, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return emptyprogram, responseError(resp)
+	}
 	err = json.NewDecoder(resp.Body).Decode(&program)
 	return program, err
 }
 
 // UpdateProgram will update the specified program
-func (c *Client) UpdateProgram(program Program, id string) (Program, error) {
+func (c *Client) UpdateProgram(update ProgramUpdate, id string) (Program, error) {
 	var emptyprogram Program
-	jsonprogram, err := json.Marshal(program)
+	jsonupdate, err := json.Marshal(update)
 	if err != nil {
-		log.Println("Could not convert program to JSON, is it in the correct format?")
+		log.Println("Could not convert program update to JSON, is it in the correct format?")
 	}
 	rel := &url.URL{Path: "/api/programs/" + id}
 	u := c.BaseURL.ResolveReference(rel)
-	req, err := http.NewRequest("PUT", u.String(), bytes.NewBuffer(jsonprogram))
+	req, err := http.NewRequest("PUT", u.String(), bytes.NewBuffer(jsonupdate))
 	if err != nil {
 		return emptyprogram, err
 	}
@@ -110,6 +193,10 @@ func (c *Client) UpdateProgram(program Program, id string) (Program, error) {
 		return emptyprogram, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return emptyprogram, responseError(resp)
+	}
+	var program Program
 	err = json.NewDecoder(resp.Body).Decode(&program)
 	return program, err
 }
@@ -226,7 +313,11 @@ func PrintPrograms(outputFormat string, c Client) {
 	if err != nil {
 		fmt.Println("Error occured while fetching programs.", err)
 	}
+	printProgramList(outputFormat, programs)
+}
 
+// printProgramList prints a list of programs to terminal in desired output format
+func printProgramList(outputFormat string, programs []Program) {
 	// output in desired format
 	if outputFormat == "json" {
 
@@ -265,6 +356,16 @@ func PrintProgram(programID string, outputFormat string, c Client) {
 	} else {
 
 		fmt.Println(program.ID)
+		if program.Name != "" {
+			fmt.Println("Name:", program.Name)
+		}
+		if program.Type != "" {
+			fmt.Println("Type:", program.Type)
+		}
+		fmt.Println("State:", program.State)
+		for _, bounty := range program.Bounties {
+			fmt.Printf("Bounty: %s %.2f-%.2f %s\n", SeverityString(bounty.Severity), bounty.Min, bounty.Max, bounty.Currency)
+		}
 
 	}
 }
@@ -353,11 +454,122 @@ func PrintAssociatedVulns(id string, outputFormat string, c Client) {
 	}
 }
 
+// programFlags are the cli flags shared by programs create and programs update
+type programFlags struct {
+	name        *string
+	url         *string
+	policyFile  *string
+	programType *string
+	state       *string
+	safeHarbour *bool
+	launchDate  *string
+	currency    *string
+	bounties    stringsFlag
+	metadata    stringsFlag
+}
+
+// addProgramFlags defines the flags for the metadata of a program on a flagset
+func addProgramFlags(flagset *flag.FlagSet) *programFlags {
+	f := programFlags{
+		name:        flagset.String("name", "", "Display name of the program"),
+		url:         flagset.String("url", "", "URL of the program on its platform"),
+		policyFile:  flagset.String("policy-file", "", "File holding the program's policy text"),
+		programType: flagset.String("type", "", "Type of program: private, public or vdp"),
+		state:       flagset.String("state", "", "State of the program: active, paused or closed"),
+		safeHarbour: flagset.Bool("safeharbour", false, "Whether the program offers safe harbour"),
+		launchDate:  flagset.String("launch", "", "Date the program launched, e.g. 2021-06-30"),
+		currency:    flagset.String("currency", "USD", "Currency of the -bounty ranges"),
+	}
+	flagset.Var(&f.bounties, "bounty", "Bounty range for a severity, e.g. critical=1000-5000. Can be used more than once.")
+	flagset.Var(&f.metadata, "meta", "Custom metadata as key=value. Can be used more than once.")
+	return &f
+}
+
+// update turns the program flags that were passed into a ProgramUpdate
+func (f *programFlags) update(flagset *flag.FlagSet) (ProgramUpdate, error) {
+	var update ProgramUpdate
+	if isFlagPassed("name", flagset) {
+		update.Name = f.name
+	}
+	if isFlagPassed("url", flagset) {
+		update.URL = f.url
+	}
+	if isFlagPassed("type", flagset) {
+		update.Type = f.programType
+	}
+	if isFlagPassed("state", flagset) {
+		update.State = f.state
+	}
+	if isFlagPassed("safeharbour", flagset) {
+		update.SafeHarbour = f.safeHarbour
+	}
+	if isFlagPassed("policy-file", flagset) {
+		policy, err := ioutil.ReadFile(*f.policyFile)
+		if err != nil {
+			return update, err
+		}
+		policyString := string(policy)
+		update.Policy = &policyString
+	}
+	if isFlagPassed("launch", flagset) {
+		launchDate, err := time.Parse("2006-01-02", *f.launchDate)
+		if err != nil {
+			return update, fmt.Errorf("invalid -launch date, it should look like 2021-06-30")
+		}
+		update.LaunchDate = &launchDate
+	}
+	if len(f.bounties) > 0 {
+		var bounties []BountyRange
+		for _, value := range f.bounties {
+			bounty, err := parseBountyRange(value, *f.currency)
+			if err != nil {
+				return update, err
+			}
+			bounties = append(bounties, bounty)
+		}
+		update.Bounties = &bounties
+	}
+	metadata, err := parseKeyValues("meta", f.metadata)
+	if err != nil {
+		return update, err
+	}
+	update.Metadata = metadata
+	return update, nil
+}
+
+// parseBountyRange parses a bounty range like critical=1000-5000, or high=500 for a fixed amount
+func parseBountyRange(value string, currency string) (BountyRange, error) {
+	var bounty BountyRange
+	pair := strings.SplitN(value, "=", 2)
+	if len(pair) != 2 {
+		return bounty, fmt.Errorf("invalid -bounty %q, it should look like critical=1000-5000", value)
+	}
+	bounty.Severity = SeverityFromString(pair[0])
+	if bounty.Severity == 0 {
+		return bounty, fmt.Errorf("invalid -bounty %q, unknown severity %q", value, pair[0])
+	}
+	amounts := strings.SplitN(pair[1], "-", 2)
+	var err error
+	bounty.Min, err = strconv.ParseFloat(amounts[0], 64)
+	if err != nil {
+		return bounty, fmt.Errorf("invalid -bounty %q, %q is not an amount", value, amounts[0])
+	}
+	bounty.Max = bounty.Min
+	if len(amounts) == 2 {
+		bounty.Max, err = strconv.ParseFloat(amounts[1], 64)
+		if err != nil {
+			return bounty, fmt.Errorf("invalid -bounty %q, %q is not an amount", value, amounts[1])
+		}
+	}
+	bounty.Currency = currency
+	return bounty, nil
+}
+
 // ProgramCLI handles the program subcommand CLI
 func ProgramCLI(c Client) {
 	programsFlagSet := flag.NewFlagSet("programs", flag.ExitOnError)
 	if len(os.Args) < 3 {
-		fmt.Println("Invalid arguments. Hint: ./hakstore-client programs {list|create|delete}")
+		fmt.Println("Invalid arguments. Hint: ./hakstore-client programs {list|create|update|scope|delete}")
 		return
 	}
 	switch os.Args[2] {
@@ -365,11 +577,21 @@ func ProgramCLI(c Client) {
 		programID := programsFlagSet.String("id", "", "ID of program")
 		outputFormat := programsFlagSet.String("output", "", "output format")
 		platformID := programsFlagSet.String("platform", "", "ID of platform")
+		programType := programsFlagSet.String("type", "", "only list programs of this type: private, public or vdp")
+		state := programsFlagSet.String("state", "", "only list programs in this state: active, paused or closed")
+		paid := programsFlagSet.Bool("paid", false, "only list programs that pay bounties")
 		programsFlagSet.Parse(os.Args[3:])
 		if isFlagPassed("id", programsFlagSet) {
 			// show single program
 			PrintProgram(*programID, *outputFormat, c)
 
+		} else if isFlagPassed("type", programsFlagSet) || isFlagPassed("state", programsFlagSet) || isFlagPassed("paid", programsFlagSet) {
+			filter := ProgramFilter{PlatformID: *platformID, Type: *programType, State: *state, PaidOnly: *paid}
+			programs, err := c.GetFilteredPrograms(filter)
+			if err != nil {
+				fmt.Println("Error occured while fetching programs.", err)
+			}
+			printProgramList(*outputFormat, programs)
 		} else if isFlagPassed("platform", programsFlagSet) {
 			PrintAssociatedPrograms(*platformID, *outputFormat, c)
 		} else {
@@ -379,17 +601,78 @@ func ProgramCLI(c Client) {
 	case "create":
 		programID := programsFlagSet.String("id", "", "ID of program")
 		platformID := programsFlagSet.String("platform", "", "Platform that program is associated with")
+		flags := addProgramFlags(programsFlagSet)
 		programsFlagSet.Parse(os.Args[3:])
 		// create/update program
 		if *programID == "" || *platformID == "" {
 			fmt.Println("You need to specify a -id and -platform to create the program.")
 			return
 		}
-		program := Program{ID: *programID, PlatformID: *platformID}
-		_, err := c.CreateProgram(program)
+		update, err := flags.update(programsFlagSet)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		program := Program{ID: *programID, PlatformID: *platformID, Metadata: update.Metadata}
+		if update.Name != nil {
+			program.Name = *update.Name
+		}
+		if update.URL != nil {
+			program.URL = *update.URL
+		}
+		if update.Policy != nil {
+			program.Policy = *update.Policy
+		}
+		if update.Type != nil {
+			program.Type = *update.Type
+		}
+		if update.State != nil {
+			program.State = *update.State
+		}
+		if update.SafeHarbour != nil {
+			program.SafeHarbour = *update.SafeHarbour
+		}
+		program.LaunchDate = update.LaunchDate
+		if update.Bounties != nil {
+			program.Bounties = *update.Bounties
+		}
+		_, err = c.CreateProgram(program)
 		if err != nil {
 			fmt.Println("An error occured while creating the program: ", err)
 		}
+	case "update":
+		programID := programsFlagSet.String("id", "", "ID of program")
+		platformID := programsFlagSet.String("platform", "", "Platform that program is associated with")
+		flags := addProgramFlags(programsFlagSet)
+		programsFlagSet.Parse(os.Args[3:])
+		if *programID == "" {
+			fmt.Println("You need to specify the program to update with -id.")
+			return
+		}
+		update, err := flags.update(programsFlagSet)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if isFlagPassed("platform", programsFlagSet) {
+			update.PlatformID = platformID
+		}
+		_, err = c.UpdateProgram(update, *programID)
+		if err != nil {
+			fmt.Println("An error occured while updating the program: ", err)
+		}
+	case "scope":
+		programID := programsFlagSet.String("id", "", "ID of program")
+		targetType := programsFlagSet.String("type", "", "only show targets of this type: domain, wildcard, cidr or other")
+		inScope := programsFlagSet.String("inscope", "", "true to only show targets in scope, false for the ones out of scope")
+		outputFormat := programsFlagSet.String("output", "", "output format")
+		programsFlagSet.Parse(os.Args[3:])
+		targets, err := c.GetScopeTargets(ScopeFilter{ProgramID: *programID, Type: *targetType, InScope: *inScope})
+		if err != nil {
+			fmt.Println("Error occured while fetching the scope.", err)
+			return
+		}
+		printScopeTargets(*outputFormat, targets)
 	case "delete":
 		programID := programsFlagSet.String("id", "", "ID of program")
 		programsFlagSet.Parse(os.Args[3:])
@@ -402,7 +685,7 @@ func ProgramCLI(c Client) {
 
 	// no valid subcommand found - default to showing a message and exiting
 	default:
-		fmt.Println("Invalid subsubcommand, ./hakstore-client programs {list|create|delete}")
+		fmt.Println("Invalid subsubcommand, ./hakstore-client programs {list|create|update|scope|delete}")
 		os.Exit(1)
 	}
 }
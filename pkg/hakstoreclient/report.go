@@ -0,0 +1,496 @@
+package hakstoreclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Report is a structure to store details about a report submitted to a bug bounty platform, and what it paid out
+type Report struct {
+	gorm.Model
+	ID               int           `json:"id"`
+	ProgramID        string        `json:"program"`
+	PlatformID       string        `json:"platform"`
+	PlatformReportID string        `json:"platformreportid"`
+	SubmittedAt      time.Time     `json:"submittedat"`
+	State            string        `json:"state"`
+	Bounty           float64       `json:"bounty"`
+	Currency         string        `json:"currency"`
+	Bonuses          []ReportBonus `json:"bonuses"`
+	Vulns            []*Vuln       `json:"vulns"`
+}
+
+// ReportBonus is a payout on top of a report's bounty, e.g. for a good writeup or a retest
+type ReportBonus struct {
+	gorm.Model
+	ReportID int       `json:"report"`
+	Amount   float64   `json:"amount"`
+	Currency string    `json:"currency"`
+	Reason   string    `json:"reason"`
+	PaidAt   time.Time `json:"paidat"`
+}
+
+// ReportUpdate holds the fields of a report to change with UpdateReport, fields that are nil are left alone. If Vulns
+// is set, it replaces the vulns linked to the report.
+type ReportUpdate struct {
+	PlatformReportID *string    `json:"platformreportid,omitempty"`
+	SubmittedAt      *time.Time `json:"submittedat,omitempty"`
+	State            *string    `json:"state,omitempty"`
+	Bounty           *float64   `json:"bounty,omitempty"`
+	Currency         *string    `json:"currency,omitempty"`
+	Vulns            *[]*Vuln   `json:"vulns,omitempty"`
+}
+
+// Earnings is the total paid out by a program or platform in one currency
+type Earnings struct {
+	ID       string  `json:"id"`
+	Currency string  `json:"currency"`
+	Reports  int     `json:"reports"`
+	Bounties float64 `json:"bounties"`
+	Bonuses  float64 `json:"bonuses"`
+	Total    float64 `json:"total"`
+}
+
+// ReportStates are the states a report can be in on the platform
+var ReportStates = []string{"new", "triaged", "resolved", "informative", "not_applicable", "duplicate"}
+
+// GetReports will get all reports from database
+func (c *Client) GetReports() ([]Report, error) {
+	rel := &url.URL{Path: "/api/reports"}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var reports []Report
+	err = json.NewDecoder(resp.Body).Decode(&reports)
+	return reports, err
+}
+
+// GetAssociatedReports will get reports belonging to the specified program
+func (c *Client) GetAssociatedReports(programID string) ([]Report, error) {
+	rel := &url.URL{Path: "/api/reports", RawQuery: url.Values{"program": {programID}}.Encode()}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var reports []Report
+	err = json.NewDecoder(resp.Body).Decode(&reports)
+	return reports, err
+}
+
+// GetReport will get a report
+func (c *Client) GetReport(id string) (Report, error) {
+	var emptyreport Report
+	rel := &url.URL{Path: "/api/reports/" + id}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return emptyreport, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return emptyreport, err
+	}
+	defer resp.Body.Close()
+	var report Report
+	err = json.NewDecoder(resp.Body).Decode(&report)
+	return report, err
+}
+
+// CreateReport will create a new report
+func (c *Client) CreateReport(report Report) (Report, error) {
+	var emptyreport Report
+	jsonreport, err := json.Marshal(report)
+	if err != nil {
+		log.Println("Could not convert report to JSON, is it in the correct format?")
+	}
+	rel := &url.URL{Path: "/api/reports"}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("POST", u.String(), bytes.NewBuffer(jsonreport))
+	if err != nil {
+		return emptyreport, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return emptyreport, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return emptyreport, responseError(resp)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&report)
+	return report, err
+}
+
+// UpdateReport will update the specified report
+func (c *Client) UpdateReport(update ReportUpdate, id string) (Report, error) {
+	var emptyreport Report
+	jsonupdate, err := json.Marshal(update)
+	if err != nil {
+		log.Println("Could not convert report update to JSON, is it in the correct format?")
+	}
+	rel := &url.URL{Path: "/api/reports/" + id}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("PUT", u.String(), bytes.NewBuffer(jsonupdate))
+	if err != nil {
+		return emptyreport, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return emptyreport, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return emptyreport, responseError(resp)
+	}
+	var report Report
+	err = json.NewDecoder(resp.Body).Decode(&report)
+	return report, err
+}
+
+// DeleteReport will delete a report
+func (c *Client) DeleteReport(id string) (bool, error) {
+	rel := &url.URL{Path: "/api/reports/" + id}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("DELETE", u.String(), nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	return true, err
+}
+
+// AddReportBonus will add a bonus payout to the specified report
+func (c *Client) AddReportBonus(bonus ReportBonus, id string) (ReportBonus, error) {
+	var emptybonus ReportBonus
+	jsonbonus, err := json.Marshal(bonus)
+	if err != nil {
+		log.Println("Could not convert bonus to JSON, is it in the correct format?")
+	}
+	rel := &url.URL{Path: "/api/reports/" + id + "/bonuses"}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("POST", u.String(), bytes.NewBuffer(jsonbonus))
+	if err != nil {
+		return emptybonus, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return emptybonus, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return emptybonus, responseError(resp)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&bonus)
+	return bonus, err
+}
+
+// GetEarnings will get the totals paid out per program and per platform, in each currency
+func (c *Client) GetEarnings() (programs []Earnings, platforms []Earnings, err error) {
+	rel := &url.URL{Path: "/api/earnings"}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	var earnings struct {
+		Programs  []Earnings `json:"programs"`
+		Platforms []Earnings `json:"platforms"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&earnings)
+	return earnings.Programs, earnings.Platforms, err
+}
+
+// printReports prints multiple reports to terminal in desired output format
+func printReports(outputFormat string, reports []Report) {
+
+	// output in desired format
+	if outputFormat == "json" {
+
+		reportsJSON, err := json.Marshal(reports)
+		if err != nil {
+			fmt.Println("Error occured while converting the response to JSON: ", err)
+		}
+		fmt.Println(string(reportsJSON))
+
+	} else {
+
+		for _, report := range reports {
+			fmt.Println(report.ID, report.ProgramID, report.PlatformReportID, report.State, report.Bounty, report.Currency)
+		}
+
+	}
+}
+
+// printReport prints the report to terminal in desired output format
+func printReport(reportID string, outputFormat string, c Client) {
+	// get the report
+	report, err := c.GetReport(reportID)
+	if err != nil {
+		fmt.Println("Error occured while fetching report.", err)
+	}
+
+	// output in desired format
+	if outputFormat == "json" {
+
+		reportJSON, err := json.Marshal(report)
+		if err != nil {
+			fmt.Println("Error occured while converting the response to JSON: ", err)
+		}
+		fmt.Println(string(reportJSON))
+
+	} else {
+		fmt.Println(report.ID, report.ProgramID, report.PlatformReportID, report.State, report.Bounty, report.Currency)
+		for _, bonus := range report.Bonuses {
+			fmt.Println("Bonus:", bonus.Amount, bonus.Currency, bonus.Reason)
+		}
+		for _, vuln := range report.Vulns {
+			fmt.Println("Vuln:", vuln.ID, vuln.Title)
+		}
+	}
+}
+
+// printEarnings prints earnings totals to terminal in desired output format
+func printEarnings(outputFormat string, earnings []Earnings) {
+	if outputFormat == "json" {
+		earningsJSON, err := json.Marshal(earnings)
+		if err != nil {
+			fmt.Println("Error occured while converting the response to JSON: ", err)
+		}
+		fmt.Println(string(earningsJSON))
+	} else {
+		for _, e := range earnings {
+			fmt.Printf("%s\t%.2f %s (%d reports, %.2f in bonuses)\n", e.ID, e.Total, e.Currency, e.Reports, e.Bonuses)
+		}
+	}
+}
+
+// parseVulnIDs turns a comma separated list of vuln IDs into vulns that can be linked to a report
+func parseVulnIDs(ids string) ([]*Vuln, error) {
+	vulns := []*Vuln{}
+	for _, id := range strings.Split(ids, ",") {
+		if strings.TrimSpace(id) == "" {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(id))
+		if err != nil {
+			return nil, fmt.Errorf("invalid vuln ID %q", id)
+		}
+		vulns = append(vulns, &Vuln{ID: n})
+	}
+	return vulns, nil
+}
+
+// ReportsCLI handles the reports subcommand CLI
+func ReportsCLI(c Client) {
+	if len(os.Args) < 3 {
+		fmt.Println("Invalid arguments. Hint: ./hakstore-client reports {list|create|update|delete|bonus|earnings}")
+		return
+	}
+	switch os.Args[2] {
+	case "list":
+		reportsFlagSet := flag.NewFlagSet("reports list", flag.ExitOnError)
+		reportID := reportsFlagSet.String("id", "", "ID of report")
+		outputFormat := reportsFlagSet.String("output", "", "output format")
+		programID := reportsFlagSet.String("program", "", "ID of program")
+		reportsFlagSet.Parse(os.Args[3:])
+		if isFlagPassed("id", reportsFlagSet) {
+			// show single report
+			printReport(*reportID, *outputFormat, c)
+		} else if isFlagPassed("program", reportsFlagSet) {
+			reports, err := c.GetAssociatedReports(*programID)
+			if err != nil {
+				fmt.Println("Error retreiving reports: ", err)
+			}
+			printReports(*outputFormat, reports)
+		} else {
+			// list reports
+			reports, err := c.GetReports()
+			if err != nil {
+				fmt.Println("Error retreiving reports: ", err)
+			}
+			printReports(*outputFormat, reports)
+		}
+	case "create":
+		reportsFlagSet := flag.NewFlagSet("reports create", flag.ExitOnError)
+		programID := reportsFlagSet.String("program", "", "Program the report was submitted to, e.g. tesla")
+		platformID := reportsFlagSet.String("platform", "", "Platform the report was submitted on, defaults to the program's platform")
+		platformReportID := reportsFlagSet.String("platformid", "", "ID of the report on the platform")
+		vulnIDs := reportsFlagSet.String("vulns", "", "comma separated list of vuln IDs covered by the report")
+		state := reportsFlagSet.String("state", "new", "State of the report, one of "+strings.Join(ReportStates, ", "))
+		submitted := reportsFlagSet.String("submitted", "", "Date the report was submitted, e.g. 2021-06-30. Defaults to now.")
+		bounty := reportsFlagSet.Float64("bounty", 0, "Bounty paid for the report")
+		currency := reportsFlagSet.String("currency", "USD", "Currency of the bounty")
+		reportsFlagSet.Parse(os.Args[3:])
+		if *programID == "" || *vulnIDs == "" {
+			fmt.Println("You need to specify a -program and the -vulns covered by the report to create it.")
+			return
+		}
+		vulns, err := parseVulnIDs(*vulnIDs)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		report := Report{
+			ProgramID:        *programID,
+			PlatformID:       *platformID,
+			PlatformReportID: *platformReportID,
+			State:            *state,
+			Bounty:           *bounty,
+			Currency:         *currency,
+			Vulns:            vulns,
+		}
+		if *submitted != "" {
+			report.SubmittedAt, err = time.Parse("2006-01-02", *submitted)
+			if err != nil {
+				fmt.Println("Invalid -submitted date, it should look like 2021-06-30.")
+				return
+			}
+		}
+		report, err = c.CreateReport(report)
+		if err != nil {
+			fmt.Println("An error occured while creating the report: ", err)
+			return
+		}
+		fmt.Println(report.ID)
+	case "update":
+		reportsFlagSet := flag.NewFlagSet("reports update", flag.ExitOnError)
+		reportID := reportsFlagSet.String("id", "", "ID of report")
+		platformReportID := reportsFlagSet.String("platformid", "", "ID of the report on the platform")
+		vulnIDs := reportsFlagSet.String("vulns", "", "comma separated list of vuln IDs covered by the report, replaces the existing ones")
+		state := reportsFlagSet.String("state", "", "State of the report, one of "+strings.Join(ReportStates, ", "))
+		bounty := reportsFlagSet.Float64("bounty", 0, "Bounty paid for the report")
+		currency := reportsFlagSet.String("currency", "", "Currency of the bounty")
+		reportsFlagSet.Parse(os.Args[3:])
+		if *reportID == "" {
+			fmt.Println("You need to specify the report to update with -id.")
+			return
+		}
+		var update ReportUpdate
+		if isFlagPassed("platformid", reportsFlagSet) {
+			update.PlatformReportID = platformReportID
+		}
+		if isFlagPassed("state", reportsFlagSet) {
+			update.State = state
+		}
+		if isFlagPassed("bounty", reportsFlagSet) {
+			update.Bounty = bounty
+		}
+		if isFlagPassed("currency", reportsFlagSet) {
+			update.Currency = currency
+		}
+		if isFlagPassed("vulns", reportsFlagSet) {
+			vulns, err := parseVulnIDs(*vulnIDs)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			update.Vulns = &vulns
+		}
+		_, err := c.UpdateReport(update, *reportID)
+		if err != nil {
+			fmt.Println("An error occured while updating the report: ", err)
+		}
+	case "delete":
+		reportsFlagSet := flag.NewFlagSet("reports delete", flag.ExitOnError)
+		reportID := reportsFlagSet.String("id", "", "ID of report")
+		reportsFlagSet.Parse(os.Args[3:])
+		// delete report
+		if *reportID == "" {
+			fmt.Println("You need to specify a report id to delete with -id.")
+			return
+		}
+		c.DeleteReport(*reportID)
+	case "bonus":
+		reportsFlagSet := flag.NewFlagSet("reports bonus", flag.ExitOnError)
+		reportID := reportsFlagSet.String("id", "", "ID of report")
+		amount := reportsFlagSet.Float64("amount", 0, "Amount of the bonus")
+		currency := reportsFlagSet.String("currency", "", "Currency of the bonus, defaults to the currency of the report")
+		reason := reportsFlagSet.String("reason", "", "Why the bonus was paid, e.g. retest")
+		reportsFlagSet.Parse(os.Args[3:])
+		if *reportID == "" || *amount <= 0 {
+			fmt.Println("You need to specify a report -id and an -amount to add a bonus.")
+			return
+		}
+		_, err := c.AddReportBonus(ReportBonus{Amount: *amount, Currency: *currency, Reason: *reason}, *reportID)
+		if err != nil {
+			fmt.Println("An error occured while adding the bonus: ", err)
+		}
+	case "earnings":
+		reportsFlagSet := flag.NewFlagSet("reports earnings", flag.ExitOnError)
+		by := reportsFlagSet.String("by", "program", "group earnings by program or platform")
+		outputFormat := reportsFlagSet.String("output", "", "output format")
+		reportsFlagSet.Parse(os.Args[3:])
+		programs, platforms, err := c.GetEarnings()
+		if err != nil {
+			fmt.Println("Error retreiving earnings: ", err)
+			return
+		}
+		if *by == "platform" {
+			printEarnings(*outputFormat, platforms)
+		} else {
+			printEarnings(*outputFormat, programs)
+		}
+
+	// no valid subcommand found - default to showing a message and exiting
+	default:
+		fmt.Println("Invalid subsubcommand, ./hakstore-client reports {list|create|update|delete|bonus|earnings}")
+		os.Exit(1)
+	}
+}
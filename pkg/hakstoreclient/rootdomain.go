@@ -9,6 +9,9 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -16,9 +19,36 @@ import (
 // RootDomain is a structure to store details about bug bounty rootdomains
 type RootDomain struct {
 	gorm.Model
-	ID         string      `json:"id" gorm:"PrimaryKey"`
-	ProgramID  string      `json:"program"`
-	Subdomains []Subdomain `json:"subdomains"`
+	ID              string      `json:"id" gorm:"PrimaryKey"`
+	ProgramID       string      `json:"program"`
+	Registrar       string      `json:"registrar"`
+	RegistrantOrg   string      `json:"registrantorg"`
+	RegistrantEmail string      `json:"registrantemail"`
+	CreationDate    *time.Time  `json:"creationdate"`
+	ExpiryDate      *time.Time  `json:"expirydate"`
+	Nameservers     []string    `json:"nameservers"`
+	WhoisUpdatedAt  *time.Time  `json:"whoisupdatedat"`
+	Subdomains      []Subdomain `json:"subdomains"`
+}
+
+// WhoisRecord is the registration data for a rootdomain, sent to SubmitWhois
+type WhoisRecord struct {
+	RootDomainID    string     `json:"rootdomain"`
+	Registrar       string     `json:"registrar"`
+	RegistrantOrg   string     `json:"registrantorg"`
+	RegistrantEmail string     `json:"registrantemail"`
+	CreationDate    *time.Time `json:"creationdate,omitempty"`
+	ExpiryDate      *time.Time `json:"expirydate,omitempty"`
+	Nameservers     []string   `json:"nameservers"`
+}
+
+// RootDomainFilter narrows down the rootdomains returned by GetFilteredRootDomains, empty fields don't filter anything
+type RootDomainFilter struct {
+	Registrar       string
+	RegistrantOrg   string
+	RegistrantEmail string
+	// ExpiringDays only returns rootdomains that expire within this many days, if it is above zero
+	ExpiringDays int
 }
 
 // GetRootDomains will get all rootdomains from database
@@ -42,6 +72,89 @@ func (c *Client) GetRootDomains() ([]RootDomain, error) {
 	return rootdomains, err
 }
 
+// GetFilteredRootDomains will get the rootdomains that match the filter
+func (c *Client) GetFilteredRootDomains(filter RootDomainFilter) ([]RootDomain, error) {
+	query := url.Values{}
+	if filter.Registrar != "" {
+		query.Set("registrar", filter.Registrar)
+	}
+	if filter.RegistrantOrg != "" {
+		query.Set("registrantorg", filter.RegistrantOrg)
+	}
+	if filter.RegistrantEmail != "" {
+		query.Set("registrantemail", filter.RegistrantEmail)
+	}
+	if filter.ExpiringDays > 0 {
+		query.Set("expiring", strconv.Itoa(filter.ExpiringDays))
+	}
+	return c.getRootDomainList(&url.URL{Path: "/api/rootdomains", RawQuery: query.Encode()})
+}
+
+// GetRelatedRootDomains will get the rootdomains registered to the same organisation or email address as the
+// specified rootdomain
+func (c *Client) GetRelatedRootDomains(id string) ([]RootDomain, error) {
+	return c.getRootDomainList(&url.URL{Path: "/api/rootdomains/" + id + "/related"})
+}
+
+// getRootDomainList fetches a list of rootdomains from an API path
+func (c *Client) getRootDomainList(rel *url.URL) ([]RootDomain, error) {
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+	var rootdomains []RootDomain
+	err = json.NewDecoder(resp.Body).Decode(&rootdomains)
+	return rootdomains, err
+}
+
+// SubmitWhois will store WHOIS data against existing rootdomains. Records the server refused are returned in a
+// *RejectedError.
+func (c *Client) SubmitWhois(records []WhoisRecord) ([]RootDomain, error) {
+	var emptyrootdomains []RootDomain
+	jsonrecords, err := json.Marshal(records)
+	if err != nil {
+		log.Println("Could not convert WHOIS records to JSON, are they in the correct format?")
+	}
+	rel := &url.URL{Path: "/api/whois", RawQuery: "verbose=true"}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("POST", u.String(), bytes.NewBuffer(jsonrecords))
+	if err != nil {
+		return emptyrootdomains, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return emptyrootdomains, err
+	}
+	defer resp.Body.Close()
+	var response struct {
+		Items    []RootDomain `json:"items"`
+		Rejected []Reject     `json:"rejected"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return emptyrootdomains, err
+	}
+	if len(response.Rejected) > 0 {
+		return response.Items, &RejectedError{Rejected: response.Rejected}
+	}
+	return response.Items, nil
+}
+
 // GetRootDomain will get a rootdomain
 func (c *Client) GetRootDomain(id string) (RootDomain, error) {
 	var emptyrootdomain RootDomain
@@ -163,7 +276,11 @@ func PrintRootDomains(outputFormat string, c Client) {
 	if err != nil {
 		fmt.Println("Error occured while fetching rootdomains.", err)
 	}
+	printRootDomainList(outputFormat, rootdomains)
+}
 
+// printRootDomainList prints a list of rootdomains to terminal in desired output format
+func printRootDomainList(outputFormat string, rootdomains []RootDomain) {
 	// output in desired format
 	if outputFormat == "json" {
 
@@ -176,7 +293,11 @@ func PrintRootDomains(outputFormat string, c Client) {
 	} else {
 
 		for _, rootdomain := range rootdomains {
-			fmt.Println(rootdomain.ID)
+			if rootdomain.ExpiryDate != nil {
+				fmt.Println(rootdomain.ID, rootdomain.ExpiryDate.Format("2006-01-02"))
+			} else {
+				fmt.Println(rootdomain.ID)
+			}
 		}
 
 	}
@@ -201,6 +322,18 @@ func PrintRootDomain(rootdomainID string, outputFormat string, c Client) {
 
 	} else {
 		fmt.Println(rootdomain.ID)
+		if rootdomain.WhoisUpdatedAt == nil {
+			return
+		}
+		fmt.Println("Registrar:", rootdomain.Registrar)
+		fmt.Println("Registrant:", rootdomain.RegistrantOrg, rootdomain.RegistrantEmail)
+		if rootdomain.CreationDate != nil {
+			fmt.Println("Created:", rootdomain.CreationDate.Format("2006-01-02"))
+		}
+		if rootdomain.ExpiryDate != nil {
+			fmt.Println("Expires:", rootdomain.ExpiryDate.Format("2006-01-02"))
+		}
+		fmt.Println("Nameservers:", strings.Join(rootdomain.Nameservers, ", "))
 	}
 }
 
@@ -225,10 +358,22 @@ func PrintAssociatedSubdomains(id string, outputFormat string, c Client) {
 	}
 }
 
+// parseDateFlag parses an optional date flag like 2021-06-30, returning nil if it wasn't set
+func parseDateFlag(name string, value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -%s date, it should look like 2021-06-30", name)
+	}
+	return &date, nil
+}
+
 // RootdomainsCLI handles the rootdomain subcommand CLI
 func RootdomainsCLI(c Client) {
 	if len(os.Args) < 3 {
-		fmt.Println("Invalid arguments. Hint: ./hakstore-client rootdomains {list|create|delete}")
+		fmt.Println("Invalid arguments. Hint: ./hakstore-client rootdomains {list|create|whois|delete}")
 		return
 	}
 	switch os.Args[2] {
@@ -237,11 +382,29 @@ func RootdomainsCLI(c Client) {
 		rootdomainID := rootdomainsFlagSet.String("id", "", "ID of rootdomain")
 		outputFormat := rootdomainsFlagSet.String("output", "", "output format")
 		programID := rootdomainsFlagSet.String("program", "", "ID of program")
+		related := rootdomainsFlagSet.String("related", "", "list rootdomains with the same registrant as this rootdomain")
+		registrar := rootdomainsFlagSet.String("registrar", "", "only list rootdomains with this registrar")
+		org := rootdomainsFlagSet.String("org", "", "only list rootdomains registered to this organisation")
+		email := rootdomainsFlagSet.String("email", "", "only list rootdomains registered to this email address")
+		expiring := rootdomainsFlagSet.Int("expiring", 0, "only list rootdomains that expire within this many days")
 		rootdomainsFlagSet.Parse(os.Args[3:])
 		if isFlagPassed("id", rootdomainsFlagSet) {
 			// show single rootdomain
 			PrintRootDomain(*rootdomainID, *outputFormat, c)
 
+		} else if isFlagPassed("related", rootdomainsFlagSet) {
+			rootdomains, err := c.GetRelatedRootDomains(*related)
+			if err != nil {
+				fmt.Println("Error occured while fetching rootdomains.", err)
+			}
+			printRootDomainList(*outputFormat, rootdomains)
+		} else if *registrar != "" || *org != "" || *email != "" || *expiring > 0 {
+			filter := RootDomainFilter{Registrar: *registrar, RegistrantOrg: *org, RegistrantEmail: *email, ExpiringDays: *expiring}
+			rootdomains, err := c.GetFilteredRootDomains(filter)
+			if err != nil {
+				fmt.Println("Error occured while fetching rootdomains.", err)
+			}
+			printRootDomainList(*outputFormat, rootdomains)
 		} else if isFlagPassed("program", rootdomainsFlagSet) {
 			PrintAssociatedRootDomains(*programID, *outputFormat, c)
 		} else {
@@ -263,6 +426,43 @@ func RootdomainsCLI(c Client) {
 		if err != nil {
 			fmt.Println("An error occured while creating the rootdomain: ", err)
 		}
+	case "whois":
+		rootdomainsFlagSet := flag.NewFlagSet("rootdomains whois", flag.ExitOnError)
+		rootdomainID := rootdomainsFlagSet.String("id", "", "ID of rootdomain")
+		registrar := rootdomainsFlagSet.String("registrar", "", "Registrar of the rootdomain")
+		org := rootdomainsFlagSet.String("org", "", "Organisation the rootdomain is registered to")
+		email := rootdomainsFlagSet.String("email", "", "Email address the rootdomain is registered to")
+		created := rootdomainsFlagSet.String("created", "", "Date the rootdomain was registered, e.g. 2010-06-30")
+		expires := rootdomainsFlagSet.String("expires", "", "Date the rootdomain registration expires, e.g. 2022-06-30")
+		var nameservers stringsFlag
+		rootdomainsFlagSet.Var(&nameservers, "ns", "Nameserver of the rootdomain. Can be used more than once.")
+		rootdomainsFlagSet.Parse(os.Args[3:])
+		if *rootdomainID == "" {
+			fmt.Println("You need to specify the rootdomain with -id.")
+			return
+		}
+		record := WhoisRecord{
+			RootDomainID:    *rootdomainID,
+			Registrar:       *registrar,
+			RegistrantOrg:   *org,
+			RegistrantEmail: *email,
+			Nameservers:     nameservers,
+		}
+		var err error
+		record.CreationDate, err = parseDateFlag("created", *created)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		record.ExpiryDate, err = parseDateFlag("expires", *expires)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		_, err = c.SubmitWhois([]WhoisRecord{record})
+		if err != nil {
+			fmt.Println("An error occured while storing the WHOIS data: ", err)
+		}
 	case "delete":
 		rootdomainsFlagSet := flag.NewFlagSet("rootdomains delete", flag.ExitOnError)
 		rootdomainID := rootdomainsFlagSet.String("id", "", "ID of rootdomain")
@@ -276,7 +476,7 @@ func RootdomainsCLI(c Client) {
 
 	// no valid subcommand found - default to showing a message and exiting
 	default:
-		fmt.Println("Invalid subsubcommand, ./hakstore-client rootdomains {list|create|delete}")
+		fmt.Println("Invalid subsubcommand, ./hakstore-client rootdomains {list|create|whois|delete}")
 		os.Exit(1)
 	}
 }
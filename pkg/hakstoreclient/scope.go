@@ -0,0 +1,96 @@
+package hakstoreclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"gorm.io/gorm"
+)
+
+// ScopeTarget is an entry in a program's scope as the platform lists it, e.g. *.tesla.com or 10.0.0.0/8. Type is
+// domain, wildcard, cidr or other.
+type ScopeTarget struct {
+	gorm.Model
+	ID          int    `json:"id"`
+	ProgramID   string `json:"program"`
+	Target      string `json:"target"`
+	Type        string `json:"type"`
+	InScope     bool   `json:"inscope"`
+	Bounty      bool   `json:"bounty"`
+	Description string `json:"description"`
+}
+
+// ScopeChange is a difference a scope import found between a program's stored scope and the platform's. Change is
+// added, changed or removed.
+type ScopeChange struct {
+	Program string `json:"program"`
+	Target  string `json:"target"`
+	Type    string `json:"type"`
+	InScope bool   `json:"inscope"`
+	Change  string `json:"change"`
+}
+
+// ScopeFilter narrows down the scope targets returned by GetScopeTargets, empty fields don't filter anything.
+// InScope is "true" or "false".
+type ScopeFilter struct {
+	ProgramID string
+	Type      string
+	InScope   string
+}
+
+// GetScopeTargets will get the scope targets matching the filter
+func (c *Client) GetScopeTargets(filter ScopeFilter) ([]ScopeTarget, error) {
+	query := url.Values{}
+	if filter.ProgramID != "" {
+		query.Set("program", filter.ProgramID)
+	}
+	if filter.Type != "" {
+		query.Set("type", filter.Type)
+	}
+	if filter.InScope != "" {
+		query.Set("inscope", filter.InScope)
+	}
+	rel := &url.URL{Path: "/api/scope", RawQuery: query.Encode()}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+	var targets []ScopeTarget
+	err = json.NewDecoder(resp.Body).Decode(&targets)
+	return targets, err
+}
+
+// printScopeTargets prints a program's scope, one target per line, or the targets as JSON
+func printScopeTargets(outputFormat string, targets []ScopeTarget) {
+	if outputFormat == "json" {
+		targetsJSON, err := json.Marshal(targets)
+		if err != nil {
+			fmt.Println("Error occured while converting the response to JSON: ", err)
+		}
+		fmt.Println(string(targetsJSON))
+		return
+	}
+	for _, target := range targets {
+		scope := "in scope"
+		if !target.InScope {
+			scope = "out of scope"
+		} else if !target.Bounty {
+			scope = "in scope, no bounty"
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\n", target.ProgramID, target.Target, target.Type, scope)
+	}
+}
@@ -0,0 +1,270 @@
+package hakstoreclient
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StreamOptions controls how the file imports send what they read to the server
+type StreamOptions struct {
+	// BatchSize is how many items are sent in each request, 500 if it isn't set
+	BatchSize int
+	// Concurrency is how many requests are sent at the same time, 4 if it isn't set
+	Concurrency int
+	// Retries is how many more times a request is tried when the server can't be reached or is too busy
+	Retries int
+	// Progress has a running count of what has been read and stored written to it, nil for none
+	Progress io.Writer
+}
+
+// StreamSummary is what a file import read, stored and couldn't store. Rejected items were refused by the server,
+// e.g. because they are invalid, while failed items were in requests that still didn't work after every retry.
+type StreamSummary struct {
+	Read     int      `json:"read"`
+	Stored   int      `json:"stored"`
+	Rejected []Reject `json:"rejected"`
+	Failed   int      `json:"failed"`
+	Errors   []string `json:"errors"`
+}
+
+// Failures reports whether anything went wrong that means items weren't stored, other than the server rejecting
+// individual items
+func (s StreamSummary) Failures() bool {
+	return s.Failed > 0 || len(s.Errors) > 0
+}
+
+// streamItem is an item read from the input along with the line it was read from
+type streamItem struct {
+	item interface{}
+	line int
+}
+
+// streamImport reads items with read and sends them to the server in batches with send, several batches at a time.
+// read is given a function to call with each item and the line it came from, and one to call with the lines it can't
+// read, which are counted as rejected. Requests that fail because the server can't be reached or has an error of its
+// own are retried with a growing delay, items the server rejects aren't.
+func streamImport(options StreamOptions, read func(emit func(item interface{}, line int), reject func(Reject)) error, send func(batch []interface{}) error) StreamSummary {
+	if options.BatchSize < 1 {
+		options.BatchSize = 500
+	}
+	if options.Concurrency < 1 {
+		options.Concurrency = 4
+	}
+	if options.Retries < 0 {
+		options.Retries = 0
+	}
+
+	var summary StreamSummary
+	var mutex sync.Mutex
+	items := make(chan streamItem, options.BatchSize)
+	batches := make(chan []streamItem, options.Concurrency)
+
+	go func() {
+		err := read(func(item interface{}, line int) {
+			items <- streamItem{item: item, line: line}
+		}, func(reject Reject) {
+			mutex.Lock()
+			summary.Read++
+			summary.Rejected = append(summary.Rejected, reject)
+			mutex.Unlock()
+		})
+		if err != nil {
+			mutex.Lock()
+			summary.Errors = append(summary.Errors, "reading input: "+err.Error())
+			mutex.Unlock()
+		}
+		close(items)
+	}()
+
+	go func() {
+		var batch []streamItem
+		for item := range items {
+			mutex.Lock()
+			summary.Read++
+			mutex.Unlock()
+			batch = append(batch, item)
+			if len(batch) >= options.BatchSize {
+				batches <- batch
+				batch = nil
+			}
+		}
+		if len(batch) > 0 {
+			batches <- batch
+		}
+		close(batches)
+	}()
+
+	done := make(chan struct{})
+	if options.Progress != nil {
+		go func() {
+			ticker := time.NewTicker(time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					mutex.Lock()
+					fmt.Fprintf(options.Progress, "\rRead %d, stored %d, rejected %d, failed %d", summary.Read, summary.Stored, len(summary.Rejected), summary.Failed)
+					mutex.Unlock()
+				}
+			}
+		}()
+	}
+
+	var workers sync.WaitGroup
+	for i := 0; i < options.Concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for batch := range batches {
+				values := make([]interface{}, len(batch))
+				for i, item := range batch {
+					values[i] = item.item
+				}
+				rejected, err := sendWithRetries(send, values, options.Retries)
+				mutex.Lock()
+				if err != nil {
+					summary.Failed += len(batch)
+					summary.Errors = append(summary.Errors, fmt.Sprintf("lines %d-%d: %v", batch[0].line, batch[len(batch)-1].line, err))
+				} else {
+					summary.Stored += len(batch) - len(rejected)
+					summary.Rejected = append(summary.Rejected, rejected...)
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	workers.Wait()
+	close(done)
+	if options.Progress != nil {
+		fmt.Fprintf(options.Progress, "\rRead %d, stored %d, rejected %d, failed %d\n", summary.Read, summary.Stored, len(summary.Rejected), summary.Failed)
+	}
+	return summary
+}
+
+// sendWithRetries sends a batch, trying again when the error might go away. The items the server rejected are
+// returned rather than treated as an error.
+func sendWithRetries(send func(batch []interface{}) error, batch []interface{}, retries int) ([]Reject, error) {
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(1<<uint(attempt-1)) * time.Second)
+		}
+		err = send(batch)
+		var rejectedErr *RejectedError
+		if errors.As(err, &rejectedErr) {
+			return rejectedErr.Rejected, nil
+		}
+		if err == nil || !retryable(err) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// retryable reports whether a failed request is worth trying again. Only failures where the batch can't have been
+// stored are retried: the connection couldn't be made so nothing was sent, or the server turned the request away as
+// too busy. Anything else, like a timeout waiting for the response or a server error part way through, may have come
+// after some of the batch was stored, and sending it again could store it twice.
+func retryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode == http.StatusServiceUnavailable
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
+
+// readLines calls emit with each non-empty line of a reader, trimmed
+func readLines(reader io.Reader, emit func(line string, number int)) error {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	number := 0
+	for scanner.Scan() {
+		number++
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			emit(line, number)
+		}
+	}
+	return scanner.Err()
+}
+
+// streamFlags are the flags shared by the file imports
+type streamFlags struct {
+	batchSize   *int
+	concurrency *int
+	retries     *int
+	progress    *bool
+}
+
+// addStreamFlags defines the flags for how a file import sends what it reads on a flagset
+func addStreamFlags(flagset *flag.FlagSet) *streamFlags {
+	return &streamFlags{
+		batchSize:   flagset.Int("batch", 500, "Number of items to send to the server in each request"),
+		concurrency: flagset.Int("concurrency", 4, "Number of requests to send at the same time"),
+		retries:     flagset.Int("retries", 3, "Number of times to retry a request when the server can't be reached or is too busy"),
+		progress:    flagset.Bool("progress", isTerminal(os.Stderr), "Show progress on stderr, on by default when stderr is a terminal"),
+	}
+}
+
+// options turns the stream flags into StreamOptions
+func (f *streamFlags) options() StreamOptions {
+	options := StreamOptions{BatchSize: *f.batchSize, Concurrency: *f.concurrency, Retries: *f.retries}
+	if *f.progress {
+		options.Progress = os.Stderr
+	}
+	return options
+}
+
+// isTerminal reports whether a file is a terminal rather than a pipe or a regular file
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// importFilename is the file a file import reads, given with -file or as the first argument, e.g. - for stdin
+func importFilename(filename string, flagset *flag.FlagSet) string {
+	if filename == "" && flagset.NArg() > 0 {
+		return flagset.Arg(0)
+	}
+	return filename
+}
+
+// finishStreamImport prints what a file import did to stderr, so it doesn't mix with output on stdout, or as JSON on
+// stdout. It exits with a non-zero status if anything couldn't be stored.
+func finishStreamImport(outputFormat string, summary StreamSummary) {
+	if outputFormat == "json" {
+		summaryJSON, err := json.Marshal(summary)
+		if err != nil {
+			fmt.Println("Error occured while converting the response to JSON: ", err)
+		}
+		fmt.Println(string(summaryJSON))
+	} else {
+		for _, reject := range summary.Rejected {
+			fmt.Fprintln(os.Stderr, "Rejected", reject.Item+":", reject.Reason)
+		}
+		for _, message := range summary.Errors {
+			fmt.Fprintln(os.Stderr, "Error", message)
+		}
+		fmt.Fprintf(os.Stderr, "Read %d, stored %d, rejected %d, failed %d\n", summary.Read, summary.Stored, len(summary.Rejected), summary.Failed)
+	}
+	if summary.Failures() {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,37 @@
+package hakstoreclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "connection refused", err: &url.Error{Op: "Post", URL: "http://localhost/api/ips", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}, want: true},
+		{name: "unknown host", err: &url.Error{Op: "Post", URL: "http://hakstore/api/ips", Err: &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "hakstore", IsNotFound: true}}}, want: true},
+		{name: "connection reset while reading", err: &url.Error{Op: "Post", URL: "http://localhost/api/ips", Err: &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}}},
+		{name: "client timeout", err: &url.Error{Op: "Post", URL: "http://localhost/api/ips", Err: errors.New("context deadline exceeded (Client.Timeout exceeded while awaiting headers)")}},
+		{name: "invalid response", err: &json.SyntaxError{}},
+		{name: "too many requests", err: &StatusError{StatusCode: http.StatusTooManyRequests}, want: true},
+		{name: "unavailable", err: fmt.Errorf("sending batch: %w", &StatusError{StatusCode: http.StatusServiceUnavailable}), want: true},
+		{name: "server error", err: &StatusError{StatusCode: http.StatusInternalServerError}},
+		{name: "gateway timeout", err: &StatusError{StatusCode: http.StatusGatewayTimeout}},
+		{name: "bad request", err: &StatusError{StatusCode: http.StatusBadRequest}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := retryable(test.err); got != test.want {
+				t.Errorf("retryable(%v) = %v, want %v", test.err, got, test.want)
+			}
+		})
+	}
+}
@@ -1,7 +1,6 @@
 package hakstoreclient
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/json"
 	"flag"
@@ -12,6 +11,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -19,11 +19,33 @@ import (
 // Subdomain is a structure to store details about bug bounty subdomains
 type Subdomain struct {
 	gorm.Model
-	ID           string `json:"id" gorm:"PrimaryKey"`
-	RootDomainID string `json:"rootdomain"`
-	CNAME        string `json:"cname"`
-	Nameservers  string `json:"nameservers"`
-	IPs          []*IP  `json:"ips" gorm:"many2many:subdomain_ips;"`
+	ID           string     `json:"id" gorm:"PrimaryKey"`
+	ProgramID    string     `json:"program"`
+	RootDomainID string     `json:"rootdomain"`
+	Wildcard     bool       `json:"wildcard"`
+	CNAME        string     `json:"cname"`
+	Nameservers  string     `json:"nameservers"`
+	FirstSeen    time.Time  `json:"firstseen"`
+	LastSeen     time.Time  `json:"lastseen"`
+	LastResolved *time.Time `json:"lastresolved"`
+	Resolution   string     `json:"resolution"`
+	Stale        bool       `json:"stale"`
+	Sources      []string   `json:"sources"`
+	IPs          []*IP      `json:"ips" gorm:"many2many:subdomain_ips;"`
+}
+
+// Resolutions are the results the last DNS lookup of a subdomain can have
+var Resolutions = []string{"unknown", "resolves", "nxdomain", "servfail", "timeout"}
+
+// SubdomainFilter narrows down the subdomains returned by GetFilteredSubdomains, empty fields don't filter anything
+type SubdomainFilter struct {
+	ProgramID   string
+	Resolutions []string
+	// Alive only returns subdomains that resolved on their last lookup if true, or failed to if false
+	Alive *bool
+	Stale *bool
+	// Source only returns subdomains found by this source, e.g. amass:crtsh
+	Source string
 }
 
 // GetSubdomains will get all subdomains from database
@@ -47,6 +69,185 @@ func (c *Client) GetSubdomains() ([]Subdomain, error) {
 	return subdomains, err
 }
 
+// GetFilteredSubdomains will get the subdomains that match the filter
+func (c *Client) GetFilteredSubdomains(filter SubdomainFilter) ([]Subdomain, error) {
+	query := url.Values{}
+	if filter.ProgramID != "" {
+		query.Set("program", filter.ProgramID)
+	}
+	if len(filter.Resolutions) > 0 {
+		query.Set("resolution", strings.Join(filter.Resolutions, ","))
+	}
+	if filter.Alive != nil {
+		query.Set("alive", strconv.FormatBool(*filter.Alive))
+	}
+	if filter.Source != "" {
+		query.Set("source", filter.Source)
+	}
+	if filter.Stale != nil {
+		query.Set("stale", strconv.FormatBool(*filter.Stale))
+	}
+	rel := &url.URL{Path: "/api/subdomains", RawQuery: query.Encode()}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+	var subdomains []Subdomain
+	err = json.NewDecoder(resp.Body).Decode(&subdomains)
+	return subdomains, err
+}
+
+// RefreshSubdomainDNS will have the server look up the DNS records of a subdomain now
+func (c *Client) RefreshSubdomainDNS(id string) (Subdomain, error) {
+	var subdomain Subdomain
+	rel := &url.URL{Path: "/api/subdomains/" + id + "/dns"}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("POST", u.String(), nil)
+	if err != nil {
+		return subdomain, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return subdomain, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return subdomain, responseError(resp)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&subdomain)
+	return subdomain, err
+}
+
+// TakeoverResult is the outcome of checking a subdomain for a takeover
+type TakeoverResult struct {
+	Subdomain  string `json:"subdomain"`
+	CNAME      string `json:"cname"`
+	Service    string `json:"service"`
+	Vulnerable bool   `json:"vulnerable"`
+	Evidence   string `json:"evidence"`
+	Vuln       *Vuln  `json:"vuln,omitempty"`
+}
+
+// CheckTakeover will have the server check a subdomain's CNAME for a takeover now. A vuln is created on the server
+// if it is vulnerable.
+func (c *Client) CheckTakeover(id string) (TakeoverResult, error) {
+	var result TakeoverResult
+	rel := &url.URL{Path: "/api/subdomains/" + id + "/takeover"}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("POST", u.String(), nil)
+	if err != nil {
+		return result, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return result, responseError(resp)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	return result, err
+}
+
+// TakeoverJob is a takeover check of many subdomains running in the background on the server. Status is running or
+// done, and only subdomains with a CNAME to a known service are in the results.
+type TakeoverJob struct {
+	ID         string           `json:"id"`
+	Program    string           `json:"program"`
+	Status     string           `json:"status"`
+	Total      int              `json:"total"`
+	Checked    int              `json:"checked"`
+	Vulnerable int              `json:"vulnerable"`
+	Results    []TakeoverResult `json:"results"`
+	StartedAt  time.Time        `json:"startedat"`
+	FinishedAt *time.Time       `json:"finishedat"`
+}
+
+// CheckTakeovers will have the server start checking every subdomain with a CNAME for takeovers, or only the ones in
+// a program if it isn't empty. The checks run in the background, follow them with GetTakeoverJob.
+func (c *Client) CheckTakeovers(program string) (TakeoverJob, error) {
+	var job TakeoverJob
+	query := url.Values{}
+	if program != "" {
+		query.Set("program", program)
+	}
+	rel := &url.URL{Path: "/api/takeover", RawQuery: query.Encode()}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("POST", u.String(), nil)
+	if err != nil {
+		return job, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return job, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return job, responseError(resp)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&job)
+	return job, err
+}
+
+// GetTakeoverJob will get a takeover job with the results of the subdomains checked so far
+func (c *Client) GetTakeoverJob(id string) (TakeoverJob, error) {
+	var job TakeoverJob
+	rel := &url.URL{Path: "/api/takeover/jobs/" + id}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return job, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return job, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return job, responseError(resp)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&job)
+	return job, err
+}
+
+// printTakeoverResult prints the outcome of a takeover check
+func printTakeoverResult(result TakeoverResult) {
+	if result.Service == "" {
+		fmt.Println(result.Subdomain, "not a known takeover service")
+		return
+	}
+	if !result.Vulnerable {
+		fmt.Println(result.Subdomain, result.CNAME, result.Service, "not vulnerable")
+		return
+	}
+	fmt.Println(result.Subdomain, result.CNAME, result.Service, "VULNERABLE:", result.Evidence)
+}
+
 // GetSubdomain will get a subdomain
 func (c *Client) GetSubdomain(id string) (Subdomain, error) {
 
@@ -69,7 +270,9 @@ func (c *Client) GetSubdomain(id string) (Subdomain, error) {
 	return subdomain, err
 }
 
-// CreateSubdomains will create a new subdomain
+// CreateSubdomains will create new subdomains. The server normalises the names, so the returned subdomains may not
+// match the ones passed in. If the server rejects any of them, the stored subdomains are returned along with a
+// *RejectedError describing the rest.
 func (c *Client) CreateSubdomains(subdomains []Subdomain) ([]Subdomain, error) {
 	var emptysubdomain []Subdomain
 
@@ -77,7 +280,7 @@ func (c *Client) CreateSubdomains(subdomains []Subdomain) ([]Subdomain, error) {
 	if err != nil {
 		log.Println("Could not convert subdomain to JSON, is it in the correct format?")
 	}
-	rel := &url.URL{Path: "/api/subdomains"}
+	rel := &url.URL{Path: "/api/subdomains", RawQuery: "verbose=true"}
 	u := c.BaseURL.ResolveReference(rel)
 	req, err := http.NewRequest("POST", u.String(), bytes.NewBuffer(jsonsubdomains))
 	if err != nil {
@@ -91,8 +294,21 @@ func (c *Client) CreateSubdomains(subdomains []Subdomain) ([]Subdomain, error) {
 		return emptysubdomain, err
 	}
 	defer resp.Body.Close()
-	err = json.NewDecoder(resp.Body).Decode(&subdomains)
-	return subdomains, err
+	if resp.StatusCode != http.StatusOK {
+		return emptysubdomain, responseError(resp)
+	}
+	var response struct {
+		Items    []Subdomain `json:"items"`
+		Rejected []Reject    `json:"rejected"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return emptysubdomain, err
+	}
+	if len(response.Rejected) > 0 {
+		return response.Items, &RejectedError{Rejected: response.Rejected}
+	}
+	return response.Items, nil
 }
 
 // UpdateSubdomains updates all subdomains in a list. It simply calls UpdateSubdomain multiple times
@@ -207,37 +423,46 @@ func PrintSubdomain(subdomainID string, outputFormat string, c Client) {
 
 	} else {
 		fmt.Println(subdomain.ID)
+		fmt.Println("Resolution:", subdomain.Resolution)
+		fmt.Println("First seen:", subdomain.FirstSeen.Format(time.RFC3339))
+		fmt.Println("Last seen:", subdomain.LastSeen.Format(time.RFC3339))
+		if subdomain.LastResolved != nil {
+			fmt.Println("Last resolved:", subdomain.LastResolved.Format(time.RFC3339))
+		}
+		if subdomain.Stale {
+			fmt.Println("Stale: yes")
+		}
 	}
 }
 
-// ImportSubdomainsFromFile adds each line of a file full of subdomains and associates it with the provided rootdomain
-func ImportSubdomainsFromFile(filename string, rootdomain string, c Client) {
-	var subdomains []Subdomain
-	file, err := os.Open(filename)
+// ImportSubdomainsFromFile adds each line of a file full of subdomains, or stdin if the filename is -, and associates
+// them with the provided rootdomain. If rootdomain is empty, the server works out the rootdomain of each subdomain
+// itself. The file is read a line at a time and sent in batches, so it can be as large as needed.
+func ImportSubdomainsFromFile(filename string, rootdomain string, options StreamOptions, c Client) (StreamSummary, error) {
+	file, err := openImportFile(filename)
 	if err != nil {
-		log.Fatal("Error opening file: ", err)
+		return StreamSummary{}, err
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	var newSubdomain Subdomain
-	for scanner.Scan() {
-		newSubdomain = Subdomain{
-			ID:           scanner.Text(),
-			RootDomainID: rootdomain,
-		}
-		subdomains = append(subdomains, newSubdomain)
+	read := func(emit func(item interface{}, line int), reject func(Reject)) error {
+		return readLines(file, func(line string, number int) {
+			emit(Subdomain{ID: line, RootDomainID: rootdomain}, number)
+		})
 	}
-
-	c.CreateSubdomains(subdomains)
-
-	if err := scanner.Err(); err != nil {
-		log.Fatal("Error scanning file:", err)
+	send := func(batch []interface{}) error {
+		subdomains := make([]Subdomain, len(batch))
+		for i, item := range batch {
+			subdomains[i] = item.(Subdomain)
+		}
+		_, err := c.CreateSubdomains(subdomains)
+		return err
 	}
-
+	return streamImport(options, read, send), nil
 }
 
-// AssociateIPWithSubdomain will create new IPs and associate them with the given subdomain
+// AssociateIPWithSubdomain will create new IPs and associate them with the given subdomain. If the server rejects any
+// of them, the associated IPs are returned along with a *RejectedError describing the rest.
 func (c *Client) AssociateIPWithSubdomain(ips []IP, subdomain Subdomain) ([]IP, error) {
 	var emptyip []IP
 
@@ -245,7 +470,7 @@ func (c *Client) AssociateIPWithSubdomain(ips []IP, subdomain Subdomain) ([]IP,
 	if err != nil {
 		log.Println("Could not convert ip to JSON, is it in the correct format?", err)
 	}
-	rel := &url.URL{Path: "/api/subdomains/" + subdomain.ID + "/ips"}
+	rel := &url.URL{Path: "/api/subdomains/" + subdomain.ID + "/ips", RawQuery: "verbose=true"}
 	u := c.BaseURL.ResolveReference(rel)
 	req, err := http.NewRequest("POST", u.String(), bytes.NewBuffer(jsonips))
 	if err != nil {
@@ -259,14 +484,27 @@ func (c *Client) AssociateIPWithSubdomain(ips []IP, subdomain Subdomain) ([]IP,
 		return emptyip, err
 	}
 	defer resp.Body.Close()
-	err = json.NewDecoder(resp.Body).Decode(&ips)
-	return ips, err
+	if resp.StatusCode != http.StatusOK {
+		return emptyip, responseError(resp)
+	}
+	var response struct {
+		Items    []IP     `json:"items"`
+		Rejected []Reject `json:"rejected"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return emptyip, err
+	}
+	if len(response.Rejected) > 0 {
+		return response.Items, &RejectedError{Rejected: response.Rejected}
+	}
+	return response.Items, nil
 }
 
 // SubdomainsCLI handles the subdomains subcommand CLI
 func SubdomainsCLI(c Client) {
 	if len(os.Args) < 3 {
-		fmt.Println("Invalid arguments. Hint: ./hakstore-client subdomains {list|create|delete|associateips|import}")
+		fmt.Println("Invalid arguments. Hint: ./hakstore-client subdomains {list|create|delete|associateips|resolve|takeover|records|import}")
 		return
 	}
 	switch os.Args[2] {
@@ -277,11 +515,32 @@ func SubdomainsCLI(c Client) {
 		rootdomainID := subdomainsFlagSet.String("rootdomain", "", "ID of rootdomain")
 		programID := subdomainsFlagSet.String("program", "", "ID of program")
 		recent := subdomainsFlagSet.Int("recent", 0, "number of minutes")
+		resolution := subdomainsFlagSet.String("resolution", "", "only list subdomains whose last lookup had these comma separated results: "+strings.Join(Resolutions, ", "))
+		alive := subdomainsFlagSet.Bool("alive", false, "only list subdomains that resolved on their last lookup")
+		dead := subdomainsFlagSet.Bool("dead", false, "only list subdomains that failed to resolve on their last lookup")
+		stale := subdomainsFlagSet.Bool("stale", false, "only list subdomains that haven't been seen for a while")
+		source := subdomainsFlagSet.String("source", "", "only list subdomains found by this source, e.g. amass:crtsh")
 		subdomainsFlagSet.Parse(os.Args[3:])
 		if isFlagPassed("id", subdomainsFlagSet) {
 			// show single subdomain
 			PrintSubdomain(*subdomainID, *outputFormat, c)
 
+		} else if *resolution != "" || *alive || *dead || isFlagPassed("stale", subdomainsFlagSet) || *source != "" {
+			filter := SubdomainFilter{ProgramID: *programID, Source: *source}
+			if *resolution != "" {
+				filter.Resolutions = strings.Split(*resolution, ",")
+			}
+			if *alive || *dead {
+				filter.Alive = alive
+			}
+			if isFlagPassed("stale", subdomainsFlagSet) {
+				filter.Stale = stale
+			}
+			subdomains, err := c.GetFilteredSubdomains(filter)
+			if err != nil {
+				fmt.Println("Error retreiving subdomains: ", err)
+			}
+			PrintSubdomains(*outputFormat, subdomains)
 		} else if isFlagPassed("rootdomain", subdomainsFlagSet) {
 			PrintAssociatedSubdomains(*rootdomainID, *outputFormat, c)
 		} else if isFlagPassed("program", subdomainsFlagSet) {
@@ -307,7 +566,7 @@ func SubdomainsCLI(c Client) {
 		subdomainsFlagSet.Parse(os.Args[3:])
 		// create/update subdomain
 		if *subdomainID == "" {
-			fmt.Println("You need to specify a -id and a -rootdomain to create the subdomain.")
+			fmt.Println("You need to specify a -id to create the subdomain.")
 			return
 		}
 		subdomains := []Subdomain{{ID: *subdomainID, RootDomainID: *rootdomainID}}
@@ -336,31 +595,118 @@ func SubdomainsCLI(c Client) {
 		if err != nil {
 			log.Fatal("No subdomain exists with the specified ID.", err)
 		}
-		rootdomain, err := c.GetRootDomain(subdomain.RootDomainID)
-		if err != nil {
-			log.Fatal("Not able to fetch root domain belonging to the specified subdomain.", err)
-		}
-		// create IP objects out of the comma separated string
+		// create IP objects out of the comma separated string, the server adds them to the subdomain's program
 		ipStrings := strings.Split(*ipString, ",")
 		for _, ip := range ipStrings {
-			ips = append(ips, IP{ID: ip, ProgramID: rootdomain.ProgramID})
+			ips = append(ips, IP{ID: ip})
+		}
+		_, err = c.AssociateIPWithSubdomain(ips, subdomain)
+		if err != nil {
+			fmt.Println("An error occured while associating the ips: ", err)
 		}
-		c.AssociateIPWithSubdomain(ips, subdomain)
 
-	case "import":
-		subdomainsFlagSet := flag.NewFlagSet("platforms", flag.ExitOnError)
-		file := subdomainsFlagSet.String("file", "", "File that you wish to import from")
-		rootdomain := subdomainsFlagSet.String("rootdomain", "", "Root domain of the subdomains to import")
+	case "resolve":
+		subdomainsFlagSet := flag.NewFlagSet("subdomains resolve", flag.ExitOnError)
+		subdomainID := subdomainsFlagSet.String("id", "", "ID of subdomain")
 		subdomainsFlagSet.Parse(os.Args[3:])
-		if isFlagPassed("file", subdomainsFlagSet) && isFlagPassed("rootdomain", subdomainsFlagSet) {
-			ImportSubdomainsFromFile(*file, *rootdomain, c)
+		if *subdomainID == "" {
+			fmt.Println("You need to specify the subdomain to resolve with -id.")
+			return
+		}
+		subdomain, err := c.RefreshSubdomainDNS(*subdomainID)
+		if err != nil {
+			fmt.Println("An error occured while resolving the subdomain: ", err)
+			return
+		}
+		fmt.Println(subdomain.ID, subdomain.Resolution)
+
+	case "takeover":
+		subdomainsFlagSet := flag.NewFlagSet("subdomains takeover", flag.ExitOnError)
+		subdomainID := subdomainsFlagSet.String("id", "", "ID of subdomain to check, leave out to check every subdomain with a CNAME")
+		programID := subdomainsFlagSet.String("program", "", "only check subdomains in this program")
+		jobID := subdomainsFlagSet.String("job", "", "show the results of a takeover job started earlier")
+		wait := subdomainsFlagSet.Bool("wait", false, "wait for the checks of every subdomain to finish and show the results")
+		outputFormat := subdomainsFlagSet.String("output", "", "output format")
+		subdomainsFlagSet.Parse(os.Args[3:])
+		var results []TakeoverResult
+		if *subdomainID != "" {
+			result, err := c.CheckTakeover(*subdomainID)
+			if err != nil {
+				fmt.Println("An error occured while checking for a takeover: ", err)
+				return
+			}
+			results = append(results, result)
 		} else {
-			fmt.Println("Usage: hakstore-client subdomains import -file <./subs.txt> -rootdomain example.com")
+			var job TakeoverJob
+			var err error
+			if *jobID != "" {
+				job, err = c.GetTakeoverJob(*jobID)
+			} else {
+				job, err = c.CheckTakeovers(*programID)
+			}
+			for err == nil && *wait && job.Status == "running" {
+				time.Sleep(2 * time.Second)
+				job, err = c.GetTakeoverJob(job.ID)
+			}
+			if err != nil {
+				fmt.Println("An error occured while checking for takeovers: ", err)
+				return
+			}
+			if job.Status == "running" {
+				fmt.Printf("Takeover job %s is running, %d of %d subdomains checked. Follow it with -job %s\n", job.ID, job.Checked, job.Total, job.ID)
+				return
+			}
+			results = job.Results
+		}
+		if *outputFormat == "json" {
+			resultsJSON, err := json.Marshal(results)
+			if err != nil {
+				fmt.Println("Error occured while converting the response to JSON: ", err)
+			}
+			fmt.Println(string(resultsJSON))
+			return
+		}
+		for _, result := range results {
+			printTakeoverResult(result)
+		}
+
+	case "records":
+		subdomainsFlagSet := flag.NewFlagSet("subdomains records", flag.ExitOnError)
+		subdomainID := subdomainsFlagSet.String("id", "", "ID of subdomain")
+		programID := subdomainsFlagSet.String("program", "", "only show records of this program's subdomains")
+		recordType := subdomainsFlagSet.String("type", "", "only show records of this type, e.g. MX")
+		value := subdomainsFlagSet.String("value", "", "only show records with this value, e.g. an IP")
+		outputFormat := subdomainsFlagSet.String("output", "", "output format")
+		subdomainsFlagSet.Parse(os.Args[3:])
+		records, err := c.GetDNSRecords(DNSRecordFilter{SubdomainID: *subdomainID, ProgramID: *programID, Type: *recordType, Value: *value})
+		if err != nil {
+			fmt.Println("Error retreiving DNS records: ", err)
+			return
+		}
+		printDNSRecords(*outputFormat, records)
+
+	case "import":
+		subdomainsFlagSet := flag.NewFlagSet("subdomains import", flag.ExitOnError)
+		file := subdomainsFlagSet.String("file", "", "File that you wish to import from, or - for stdin")
+		rootdomain := subdomainsFlagSet.String("rootdomain", "", "Root domain of the subdomains to import. If you don't specify a rootdomain, it will be worked out for each subdomain.")
+		outputFormat := subdomainsFlagSet.String("output", "", "output format")
+		stream := addStreamFlags(subdomainsFlagSet)
+		subdomainsFlagSet.Parse(os.Args[3:])
+		filename := importFilename(*file, subdomainsFlagSet)
+		if filename == "" {
+			fmt.Println("Usage: hakstore-client subdomains import [-file] <./subs.txt|-> [-rootdomain example.com] [-batch 500] [-concurrency 4] [-retries 3]")
+			return
+		}
+		summary, err := ImportSubdomainsFromFile(filename, *rootdomain, stream.options(), c)
+		if err != nil {
+			fmt.Println("Error opening file: ", err)
+			os.Exit(1)
 		}
+		finishStreamImport(*outputFormat, summary)
 
 	// no valid subcommand found - default to showing a message and exiting
 	default:
-		fmt.Println("Invalid subsubcommand, ./hakstore-client subdomains {list|create|delete}")
+		fmt.Println("Invalid subsubcommand, ./hakstore-client subdomains {list|create|delete|associateips|resolve|takeover|records|import}")
 		os.Exit(1)
 	}
 }
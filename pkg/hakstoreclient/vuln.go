@@ -1,14 +1,18 @@
 package hakstoreclient
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -18,12 +22,93 @@ import (
 type Vuln struct {
 	gorm.Model
 	//ID         string       `json:"id" gorm:"PrimaryKey;autoIncrement"`
-	ID          int          `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
-	Subdomains  []*Subdomain `json:"subdomains" gorm:"many2many:subdomain_vulns;"`
-	IPs         []*IP        `json:"vulns" gorm:"many2many:subdomain_vulns;"`
-	Description string       `json:"description"`
-	ProgramID   string       `json:"program"`
-	Severity    int          `json:"severity"`
+	ID            int                `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	Subdomains    []*Subdomain       `json:"subdomains" gorm:"many2many:subdomain_vulns;"`
+	IPs           []*IP              `json:"ips" gorm:"many2many:ip_vulns;"`
+	CloudAssets   []*CloudAsset      `json:"cloudassets" gorm:"many2many:cloud_asset_vulns;"`
+	Description   string             `json:"description"`
+	ProgramID     string             `json:"program"`
+	Severity      int                `json:"severity"`
+	Status        string             `json:"status"`
+	AssigneeID    string             `json:"assignee"`
+	StatusChanges []VulnStatusChange `json:"history"`
+	CheckID       string             `json:"checkid"`
+	MatchedAt     string             `json:"matchedat"`
+	Fingerprint   string             `json:"fingerprint"`
+	LastSeen      time.Time          `json:"lastseen"`
+	Occurrences   int                `json:"occurrences"`
+	Title         string             `json:"title"`
+	CVSSVector    string             `json:"cvssvector"`
+	CVSSScore     float64            `json:"cvssscore"`
+	CWE           string             `json:"cwe"`
+	CVEs          []string           `json:"cves"`
+	References    []string           `json:"references"`
+	URL           string             `json:"url"`
+	Parameter     string             `json:"parameter"`
+	Request       string             `json:"request"`
+	Response      string             `json:"response"`
+	PoC           string             `json:"poc"`
+}
+
+// VulnStatusChange records a vuln moving from one status to another, when it happened and who did it
+type VulnStatusChange struct {
+	gorm.Model
+	VulnID int    `json:"vuln"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	UserID string `json:"user"`
+}
+
+// VulnStatuses are the statuses a vuln can have during triage, in workflow order
+var VulnStatuses = []string{"new", "triaging", "confirmed", "reported", "resolved", "duplicate", "false_positive", "wont_fix"}
+
+// VulnUpdate holds the fields of a vuln to change with UpdateVuln, fields that are nil are left alone
+type VulnUpdate struct {
+	Description *string `json:"description,omitempty"`
+	Severity    *int    `json:"severity,omitempty"`
+	Status      *string `json:"status,omitempty"`
+	AssigneeID  *string `json:"assignee,omitempty"`
+}
+
+// VulnFilter narrows down the vulns returned by GetFilteredVulns, empty fields don't filter anything
+type VulnFilter struct {
+	Statuses []string
+	Assignee string
+}
+
+// SeverityFromString turns a severity name like critical or info into hakstore's scale, where 1 is critical and 5 is
+// informational. The numbers themselves are accepted too. It returns 0 for anything it doesn't recognise.
+func SeverityFromString(severity string) int {
+	switch strings.ToLower(strings.TrimSpace(severity)) {
+	case "critical", "1":
+		return 1
+	case "high", "2":
+		return 2
+	case "medium", "3":
+		return 3
+	case "low", "4":
+		return 4
+	case "informational", "info", "information", "5":
+		return 5
+	}
+	return 0
+}
+
+// SeverityString turns a severity from 1-5 into its name
+func SeverityString(severity int) string {
+	switch severity {
+	case 1:
+		return "critical"
+	case 2:
+		return "high"
+	case 3:
+		return "medium"
+	case 4:
+		return "low"
+	case 5:
+		return "informational"
+	}
+	return "unknown"
 }
 
 // GetVulns will get all vulns from database
@@ -47,6 +132,37 @@ func (c *Client) GetVulns() ([]Vuln, error) {
 	return vulns, err
 }
 
+// GetFilteredVulns will get the vulns that match the filter
+func (c *Client) GetFilteredVulns(filter VulnFilter) ([]Vuln, error) {
+	query := url.Values{}
+	if len(filter.Statuses) > 0 {
+		query.Set("status", strings.Join(filter.Statuses, ","))
+	}
+	if filter.Assignee != "" {
+		query.Set("assignee", filter.Assignee)
+	}
+	rel := &url.URL{Path: "/api/vulns", RawQuery: query.Encode()}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+	var vulns []Vuln
+	err = json.NewDecoder(resp.Body).Decode(&vulns)
+	return vulns, err
+}
+
 // GetVuln will get a vuln
 func (c *Client) GetVuln(id string) (Vuln, error) {
 	var emptyvuln Vuln
@@ -69,7 +185,9 @@ func (c *Client) GetVuln(id string) (Vuln, error) {
 	return vuln, err
 }
 
-// CreateVulns will create new Vulns
+// CreateVulns will create new Vulns. Vulns that have been seen before (going by their fingerprint) aren't duplicated,
+// the existing vuln is returned instead. If the server rejects any of them, the stored vulns are returned along with a
+// *RejectedError describing the rest.
 func (c *Client) CreateVulns(vulns []Vuln) ([]Vuln, error) {
 	var emptyvuln []Vuln
 
@@ -77,7 +195,7 @@ func (c *Client) CreateVulns(vulns []Vuln) ([]Vuln, error) {
 	if err != nil {
 		log.Println("Could not convert vuln to JSON, is it in the correct format?")
 	}
-	rel := &url.URL{Path: "/api/vulns"}
+	rel := &url.URL{Path: "/api/vulns", RawQuery: "verbose=true"}
 	u := c.BaseURL.ResolveReference(rel)
 	req, err := http.NewRequest("POST", u.String(), bytes.NewBuffer(jsonvulns))
 	if err != nil {
@@ -91,20 +209,34 @@ func (c *Client) CreateVulns(vulns []Vuln) ([]Vuln, error) {
 		return emptyvuln, err
 	}
 	defer resp.Body.Close()
-	err = json.NewDecoder(resp.Body).Decode(&vulns)
-	return vulns, err
+	if resp.StatusCode != http.StatusOK {
+		return emptyvuln, responseError(resp)
+	}
+	var response struct {
+		Items    []Vuln   `json:"items"`
+		Rejected []Reject `json:"rejected"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return emptyvuln, err
+	}
+	if len(response.Rejected) > 0 {
+		return response.Items, &RejectedError{Rejected: response.Rejected}
+	}
+	return response.Items, nil
 }
 
-// UpdateVuln will update the specified vuln
-func (c *Client) UpdateVuln(vuln Vuln, id string) (Vuln, error) {
+// UpdateVuln will update the specified vuln. Only the fields set in the update are changed, and status changes have
+// to follow the server's triage workflow.
+func (c *Client) UpdateVuln(update VulnUpdate, id string) (Vuln, error) {
 	var emptyvuln Vuln
-	jsonvuln, err := json.Marshal(vuln)
+	jsonupdate, err := json.Marshal(update)
 	if err != nil {
-		log.Println("Could not convert vuln to JSON, is it in the correct format?")
+		log.Println("Could not convert vuln update to JSON, is it in the correct format?")
 	}
 	rel := &url.URL{Path: "/api/vulns/" + id}
 	u := c.BaseURL.ResolveReference(rel)
-	req, err := http.NewRequest("PUT", u.String(), bytes.NewBuffer(jsonvuln))
+	req, err := http.NewRequest("PUT", u.String(), bytes.NewBuffer(jsonupdate))
 	if err != nil {
 		return emptyvuln, err
 	}
@@ -116,10 +248,24 @@ func (c *Client) UpdateVuln(vuln Vuln, id string) (Vuln, error) {
 		return emptyvuln, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return emptyvuln, responseError(resp)
+	}
+	var vuln Vuln
 	err = json.NewDecoder(resp.Body).Decode(&vuln)
 	return vuln, err
 }
 
+// SetVulnStatus will move the specified vuln to a new status
+func (c *Client) SetVulnStatus(id string, status string) (Vuln, error) {
+	return c.UpdateVuln(VulnUpdate{Status: &status}, id)
+}
+
+// AssignVuln will assign the specified vuln to a user, or unassign it if user is empty
+func (c *Client) AssignVuln(id string, user string) (Vuln, error) {
+	return c.UpdateVuln(VulnUpdate{AssigneeID: &user}, id)
+}
+
 // DeleteVuln will delete a vuln
 func (c *Client) DeleteVuln(id string) (bool, error) {
 	rel := &url.URL{Path: "/api/vulns/" + id}
@@ -179,13 +325,92 @@ func printVuln(vulnID string, outputFormat string, c Client) {
 
 	} else {
 		fmt.Println(vuln.ID)
+		fmt.Println("Status:", vuln.Status)
+		if vuln.AssigneeID != "" {
+			fmt.Println("Assignee:", vuln.AssigneeID)
+		}
+		for _, change := range vuln.StatusChanges {
+			fmt.Println(change.CreatedAt.Format("2006-01-02 15:04:05"), change.From, "->", change.To, "by", change.UserID)
+		}
+	}
+}
+
+// ImportVulnsFromFile reads vulns from a JSON file, or stdin if the filename is -, and stores them in batches. The
+// file can hold a single vuln, an array of vulns, or one vuln per line (NDJSON). Arrays are decoded one vuln at a
+// time, and NDJSON lines that aren't valid JSON are rejected without stopping the import.
+func ImportVulnsFromFile(filename string, options StreamOptions, c Client) (StreamSummary, error) {
+	file, err := openImportFile(filename)
+	if err != nil {
+		return StreamSummary{}, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	read := func(emit func(item interface{}, line int), reject func(Reject)) error {
+		first, err := firstNonSpace(reader)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if first != '[' {
+			return readLines(reader, func(line string, number int) {
+				var vuln Vuln
+				err := json.Unmarshal([]byte(line), &vuln)
+				if err != nil {
+					reject(Reject{Item: fmt.Sprintf("line %d", number), Reason: err.Error()})
+					return
+				}
+				emit(vuln, number)
+			})
+		}
+
+		decoder := json.NewDecoder(reader)
+		_, err = decoder.Token()
+		if err != nil {
+			return err
+		}
+		for number := 1; decoder.More(); number++ {
+			var vuln Vuln
+			err := decoder.Decode(&vuln)
+			if err != nil {
+				return fmt.Errorf("vuln %d: %v", number, err)
+			}
+			emit(vuln, number)
+		}
+		return nil
+	}
+	send := func(batch []interface{}) error {
+		vulns := make([]Vuln, len(batch))
+		for i, item := range batch {
+			vulns[i] = item.(Vuln)
+		}
+		_, err := c.CreateVulns(vulns)
+		return err
+	}
+	return streamImport(options, read, send), nil
+}
+
+// firstNonSpace skips past the whitespace at the start of a reader and returns the next byte without reading it
+func firstNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		next, err := reader.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		switch next[0] {
+		case ' ', '\t', '\r', '\n':
+			reader.ReadByte()
+		default:
+			return next[0], nil
+		}
 	}
 }
 
 // VulnsCLI handles the vulns subcommand CLI
 func VulnsCLI(c Client) {
 	if len(os.Args) < 3 {
-		fmt.Println("Invalid arguments. Hint: ./hakstore-client vulns {list|create|delete}")
+		fmt.Println("Invalid arguments. Hint: ./hakstore-client vulns {list|create|import|delete|triage|assign|status}")
 		return
 	}
 	switch os.Args[2] {
@@ -194,6 +419,8 @@ func VulnsCLI(c Client) {
 		vulnID := vulnsFlagSet.String("id", "", "ID of vuln")
 		outputFormat := vulnsFlagSet.String("output", "", "output format")
 		programID := vulnsFlagSet.String("program", "", "ID of program")
+		status := vulnsFlagSet.String("status", "", "comma separated list of statuses to show, e.g. new,triaging")
+		assignee := vulnsFlagSet.String("assignee", "", "only show vulns assigned to this user")
 
 		vulnsFlagSet.Parse(os.Args[3:])
 		if isFlagPassed("id", vulnsFlagSet) {
@@ -202,6 +429,16 @@ func VulnsCLI(c Client) {
 
 		} else if isFlagPassed("program", vulnsFlagSet) {
 			PrintAssociatedVulns(*programID, *outputFormat, c)
+		} else if isFlagPassed("status", vulnsFlagSet) || isFlagPassed("assignee", vulnsFlagSet) {
+			filter := VulnFilter{Assignee: *assignee}
+			if *status != "" {
+				filter.Statuses = strings.Split(*status, ",")
+			}
+			vulns, err := c.GetFilteredVulns(filter)
+			if err != nil {
+				fmt.Println("Error retreiving vulns: ", err)
+			}
+			printVulns(*outputFormat, vulns)
 		} else {
 			// list vulns
 			vulns, err := c.GetVulns()
@@ -217,33 +454,75 @@ func VulnsCLI(c Client) {
 		severity := vulnsFlagSet.Int("severity", 1, "Severity of vulnerability from 1-5, 1 is critical, 5 is informational.")
 		subdomain := vulnsFlagSet.String("subdomain", "", "Subdomain that vuln is associated with")
 		ip := vulnsFlagSet.String("ip", "", "IP that vuln is associated with")
+		cloudAsset := vulnsFlagSet.String("cloudasset", "", "Cloud asset that vuln is associated with, its ID or provider/kind/identifier like aws/s3/tesla-assets")
+		checkID := vulnsFlagSet.String("checkid", "", "ID of the check or template that found the vuln, used to recognise it when it is found again")
+		matchedAt := vulnsFlagSet.String("matchedat", "", "Where the check matched, e.g. a URL")
+		fromJSON := vulnsFlagSet.String("from-json", "", "JSON file holding a vuln or an array of vulns with all of their fields, use - for stdin")
 
 		vulnsFlagSet.Parse(os.Args[3:])
+		if isFlagPassed("from-json", vulnsFlagSet) {
+			summary, err := ImportVulnsFromFile(*fromJSON, StreamOptions{}, c)
+			if err != nil {
+				fmt.Println("Error reading vulns from JSON: ", err)
+				os.Exit(1)
+			}
+			finishStreamImport("", summary)
+			return
+		}
+
 		// create/update vuln
 		if *description == "" || *programID == "" || *severity == 0 {
-			fmt.Println("You need to specify a -description, -program, -severity and -subdomain or -ip to create the vuln.")
+			fmt.Println("You need to specify a -description, -program, -severity and -subdomain, -ip or -cloudasset to create the vuln.")
 			return
 		}
 
-		if *subdomain == "" && *ip == "" {
-			fmt.Println("You need to specify either a -subdomain or an -ip to associate the vuln with")
+		if *subdomain == "" && *ip == "" && *cloudAsset == "" {
+			fmt.Println("You need to specify a -subdomain, an -ip or a -cloudasset to associate the vuln with")
+			return
 		}
 
-		vulns := []Vuln{{
+		vuln := Vuln{
 			Description: *description,
 			ProgramID:   *programID,
 			Severity:    *severity,
-			Subdomains: []*Subdomain{
-				{ID: *subdomain},
-			},
-			IPs: []*IP{
-				{ID: *ip},
-			},
-		}}
-		_, err := c.CreateVulns(vulns)
+			CheckID:     *checkID,
+			MatchedAt:   *matchedAt,
+		}
+		if *subdomain != "" {
+			vuln.Subdomains = []*Subdomain{{ID: *subdomain}}
+		}
+		if *ip != "" {
+			vuln.IPs = []*IP{{ID: *ip}}
+		}
+		if *cloudAsset != "" {
+			asset, err := parseCloudAssetRef(*cloudAsset)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			vuln.CloudAssets = []*CloudAsset{asset}
+		}
+		_, err := c.CreateVulns([]Vuln{vuln})
 		if err != nil {
 			fmt.Println("An error occured while creating the vuln: ", err)
 		}
+	case "import":
+		vulnsFlagSet := flag.NewFlagSet("vulns import", flag.ExitOnError)
+		file := vulnsFlagSet.String("file", "", "JSON file holding vulns, as an array or one per line, or - for stdin")
+		outputFormat := vulnsFlagSet.String("output", "", "output format")
+		stream := addStreamFlags(vulnsFlagSet)
+		vulnsFlagSet.Parse(os.Args[3:])
+		filename := importFilename(*file, vulnsFlagSet)
+		if filename == "" {
+			fmt.Println("Usage: hakstore-client vulns import [-file] <./vulns.jsonl|-> [-batch 500] [-concurrency 4] [-retries 3]")
+			return
+		}
+		summary, err := ImportVulnsFromFile(filename, stream.options(), c)
+		if err != nil {
+			fmt.Println("Error opening file: ", err)
+			os.Exit(1)
+		}
+		finishStreamImport(*outputFormat, summary)
 	case "delete":
 		vulnsFlagSet := flag.NewFlagSet("vulns delete", flag.ExitOnError)
 		vulnID := vulnsFlagSet.String("id", "", "ID of vuln")
@@ -255,9 +534,56 @@ func VulnsCLI(c Client) {
 		}
 		c.DeleteVuln(*vulnID)
 
+	case "triage":
+		vulnsFlagSet := flag.NewFlagSet("vulns triage", flag.ExitOnError)
+		vulnID := vulnsFlagSet.String("id", "", "ID of vuln")
+		assignee := vulnsFlagSet.String("assignee", "", "User to assign the vuln to while it is triaged")
+		vulnsFlagSet.Parse(os.Args[3:])
+		if *vulnID == "" {
+			fmt.Println("You need to specify the vuln to triage with -id.")
+			return
+		}
+		status := "triaging"
+		update := VulnUpdate{Status: &status}
+		if isFlagPassed("assignee", vulnsFlagSet) {
+			update.AssigneeID = assignee
+		}
+		_, err := c.UpdateVuln(update, *vulnID)
+		if err != nil {
+			fmt.Println("An error occured while triaging the vuln: ", err)
+		}
+
+	case "assign":
+		vulnsFlagSet := flag.NewFlagSet("vulns assign", flag.ExitOnError)
+		vulnID := vulnsFlagSet.String("id", "", "ID of vuln")
+		user := vulnsFlagSet.String("user", "", "User to assign the vuln to, leave empty to unassign it")
+		vulnsFlagSet.Parse(os.Args[3:])
+		if *vulnID == "" {
+			fmt.Println("You need to specify the vuln to assign with -id.")
+			return
+		}
+		_, err := c.AssignVuln(*vulnID, *user)
+		if err != nil {
+			fmt.Println("An error occured while assigning the vuln: ", err)
+		}
+
+	case "status":
+		vulnsFlagSet := flag.NewFlagSet("vulns status", flag.ExitOnError)
+		vulnID := vulnsFlagSet.String("id", "", "ID of vuln")
+		status := vulnsFlagSet.String("status", "", "New status of the vuln, one of "+strings.Join(VulnStatuses, ", "))
+		vulnsFlagSet.Parse(os.Args[3:])
+		if *vulnID == "" || *status == "" {
+			fmt.Println("You need to specify a -id and a -status to change the status of a vuln.")
+			return
+		}
+		_, err := c.SetVulnStatus(*vulnID, *status)
+		if err != nil {
+			fmt.Println("An error occured while changing the status of the vuln: ", err)
+		}
+
 	// no valid subcommand found - default to showing a message and exiting
 	default:
-		fmt.Println("Invalid subsubcommand, ./hakstore-client vulns {list|create|delete}")
+		fmt.Println("Invalid subsubcommand, ./hakstore-client vulns {list|create|import|delete|triage|assign|status}")
 		os.Exit(1)
 	}
 }